@@ -0,0 +1,44 @@
+package cache
+
+import (
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// BACKUP_CHECKS_PER_AGE is how many times per MaxBackupAge the backup age is checked.
+const BACKUP_CHECKS_PER_AGE = 4
+
+// startBackupLoop forces a cloud upload whenever the last successful one is older than
+// MaxBackupAge, a cache that never uploaded counts its age from construction.
+func (c *cacheService) startBackupLoop() {
+	if c.StoreConfig.MaxBackupAge <= 0 {
+		return
+	}
+	c.backupsSince = time.Now()
+	c.backups = newJanitor(c.StoreConfig.MaxBackupAge / BACKUP_CHECKS_PER_AGE)
+	go c.backups.run(c.refreshStaleBackup)
+}
+
+func (c *cacheService) refreshStaleBackup() {
+	age, ok := c.BackupAge()
+	if !ok {
+		age = time.Since(c.backupsSince)
+	}
+	if age < c.StoreConfig.MaxBackupAge {
+		return
+	}
+	c.Info("cloud backup is stale, forcing upload", zap.Duration("age", age), zap.Duration("maxBackupAge", c.StoreConfig.MaxBackupAge))
+	if err := c.syncToCloud(true); err != nil {
+		c.Error("error refreshing stale cloud backup", zap.Error(err))
+	}
+}
+
+// BackupAge returns how long ago the last successful cloud upload was, false if there hasn't been one.
+func (c *cacheService) BackupAge() (time.Duration, bool) {
+	at := c.lastUploadAt.Load()
+	if at == 0 {
+		return 0, false
+	}
+	return time.Since(time.Unix(0, at)), true
+}
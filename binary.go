@@ -0,0 +1,117 @@
+package cache
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"io"
+
+	"github.com/patrickmn/go-cache"
+)
+
+// binaryMagic starts every binary cache file, loads sniff it the same way they do gzip.
+var binaryMagic = []byte("CCBIN")
+
+// MAX_BINARY_RECORD_LEN caps the key and value lengths a binary file can claim,
+// so a damaged length fails the decode instead of allocating it.
+const MAX_BINARY_RECORD_LEN = 1 << 30
+
+// writeBinary writes items as the magic, a uvarint version and then one record per item:
+// uvarint key length, key, varint expiration, uvarint value length and the JSON encoded value.
+func (c *cacheService) writeBinary(w io.Writer, items map[string]cache.Item) error {
+	buf := bufio.NewWriter(w)
+	var scratch [binary.MaxVarintLen64]byte
+	putUvarint := func(v uint64) {
+		buf.Write(scratch[:binary.PutUvarint(scratch[:], v)])
+	}
+
+	buf.Write(binaryMagic)
+	putUvarint(CACHE_FILE_VERSION)
+	for k, item := range items {
+		obj := c.blobs.resolve(item.Object)
+		body, ok := obj.(marshalledValue)
+		if !ok {
+			var err error
+			body, err = json.Marshal(obj)
+			if err != nil {
+				if c.skipUnencodable(k, err) {
+					continue
+				}
+				return err
+			}
+		}
+
+		putUvarint(uint64(len(k)))
+		buf.WriteString(k)
+		buf.Write(scratch[:binary.PutVarint(scratch[:], item.Expiration)])
+		putUvarint(uint64(len(body)))
+		buf.Write(body)
+	}
+	return buf.Flush()
+}
+
+// isBinary reports whether the reader holds a binary cache file without consuming it.
+func isBinary(br *bufio.Reader) bool {
+	head, err := br.Peek(len(binaryMagic))
+	return err == nil && bytes.Equal(head, binaryMagic)
+}
+
+// readRecord reads a length prefixed key or value, growing the buffer as bytes
+// arrive so a length past the end of the file fails without allocating it.
+func readRecord(br *bufio.Reader, n uint64) ([]byte, error) {
+	if n > MAX_BINARY_RECORD_LEN {
+		return nil, ErrBinaryRecordTooLarge
+	}
+	var buf bytes.Buffer
+	if _, err := io.CopyN(&buf, br, int64(n)); err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func decodeBinary(br *bufio.Reader) (int, map[string]cache.Item, error) {
+	if _, err := br.Discard(len(binaryMagic)); err != nil {
+		return 0, nil, err
+	}
+	version, err := binary.ReadUvarint(br)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	items := map[string]cache.Item{}
+	for {
+		keyLen, err := binary.ReadUvarint(br)
+		if err == io.EOF {
+			return int(version), items, nil
+		}
+		if err != nil {
+			return int(version), nil, err
+		}
+		key, err := readRecord(br, keyLen)
+		if err != nil {
+			return int(version), nil, err
+		}
+		exp, err := binary.ReadVarint(br)
+		if err != nil {
+			return int(version), nil, err
+		}
+		valLen, err := binary.ReadUvarint(br)
+		if err != nil {
+			return int(version), nil, err
+		}
+		body, err := readRecord(br, valLen)
+		if err != nil {
+			return int(version), nil, err
+		}
+
+		var obj interface{}
+		if err := json.Unmarshal(body, &obj); err != nil {
+			return int(version), nil, err
+		}
+		items[string(key)] = cache.Item{Object: obj, Expiration: exp}
+	}
+}
@@ -0,0 +1,140 @@
+package cache_test
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	gocache "github.com/patrickmn/go-cache"
+	"github.com/stretchr/testify/require"
+
+	"github.com/comfforts/cache"
+	"github.com/comfforts/logger"
+)
+
+func TestBinaryFile(t *testing.T) {
+	dataDir := t.TempDir()
+	testLogger := logger.NewTestAppLogger(dataDir)
+	cacheCfg := cache.CacheConfig{
+		DataDir:    dataDir,
+		MarshalFn:  UnmarshallTestStruct,
+		BinaryFile: true,
+	}
+	ca, err := cache.NewCacheService(cacheCfg, testLogger)
+	require.NoError(t, err)
+	closeOnCleanup(t, ca)
+
+	expected := map[string]TestStruct{
+		"first":  {Name: "John", Age: 34},
+		"second": {Name: "Jane", Age: 29},
+		"":       {Name: "Empty key", Age: 1},
+		"ünï":    {Name: "Unicode", Age: 2},
+	}
+	for k, v := range expected {
+		err = ca.Set(k, v, 5*time.Minute)
+		require.NoError(t, err)
+	}
+	err = ca.Set("forever", TestStruct{Name: "Forever", Age: 3}, gocache.NoExpiration)
+	require.NoError(t, err)
+	expected["forever"] = TestStruct{Name: "Forever", Age: 3}
+
+	err = ca.Clear()
+	require.NoError(t, err)
+
+	body, err := os.ReadFile(filepath.Join(dataDir, "cache.json"))
+	require.NoError(t, err)
+	var raw json.RawMessage
+	require.Error(t, json.Unmarshal(body, &raw))
+
+	// binary files load whether or not the option is still set
+	for _, binaryFile := range []bool{true, false} {
+		cacheCfg.BinaryFile = binaryFile
+		ca, err = cache.NewCacheService(cacheCfg, testLogger)
+		require.NoError(t, err)
+		closeOnCleanup(t, ca)
+		require.Equal(t, len(expected), ca.ItemCount())
+		for k, v := range expected {
+			cVal, _ := ca.Get(k)
+			require.Equal(t, v, cVal, k)
+		}
+	}
+}
+
+func BenchmarkFileFormat(b *testing.B) {
+	for _, binaryFile := range []bool{false, true} {
+		b.Run(fmt.Sprintf("BinaryFile=%t", binaryFile), func(b *testing.B) {
+			dataDir := b.TempDir()
+			testLogger := logger.NewTestAppLogger(dataDir)
+			cacheCfg := cache.CacheConfig{
+				DataDir:    dataDir,
+				MarshalFn:  UnmarshallTestStruct,
+				BinaryFile: binaryFile,
+			}
+			ca, err := cache.NewCacheService(cacheCfg, testLogger)
+			require.NoError(b, err)
+			closeOnCleanup(b, ca)
+			for i := 0; i < 100000; i++ {
+				err = ca.Set(fmt.Sprintf("k%d", i), TestStruct{Name: "x", Age: i}, 5*time.Minute)
+				require.NoError(b, err)
+			}
+			err = ca.Purge()
+			require.NoError(b, err)
+
+			fStats, err := os.Stat(filepath.Join(dataDir, "cache.json"))
+			require.NoError(b, err)
+
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				loaded, err := cache.NewCacheService(cacheCfg, testLogger)
+				require.NoError(b, err)
+				closeOnCleanup(b, loaded)
+			}
+			b.ReportMetric(float64(fStats.Size()), "file-bytes")
+		})
+	}
+}
+
+func TestBinaryFileCorruptLengths(t *testing.T) {
+	header := append([]byte("CCBIN"), binary.AppendUvarint(nil, cache.CACHE_FILE_VERSION)...)
+	record := func(b []byte, key string, valLen uint64, val string) []byte {
+		b = binary.AppendUvarint(b, uint64(len(key)))
+		b = append(b, key...)
+		b = binary.AppendVarint(b, time.Now().Add(5*time.Minute).UnixNano())
+		b = binary.AppendUvarint(b, valLen)
+		return append(b, val...)
+	}
+
+	corrupt := map[string][]byte{
+		"huge key length":       binary.AppendUvarint(header, 1<<63),
+		"key past the end":      binary.AppendUvarint(header, 1<<29),
+		"huge value length":     record(record(header, "first", 2, "34"), "second", 1<<63, ""),
+		"value past the end":    record(record(header, "first", 2, "34"), "second", 1<<29, "12"),
+		"length over max int64": binary.AppendUvarint(header, ^uint64(0)),
+	}
+	for name, body := range corrupt {
+		t.Run(name, func(t *testing.T) {
+			dataDir := t.TempDir()
+			testLogger := logger.NewTestAppLogger(dataDir)
+			cacheCfg := cache.CacheConfig{
+				DataDir:   dataDir,
+				MarshalFn: UnmarshallTestStruct,
+			}
+			err := os.WriteFile(filepath.Join(dataDir, "cache.json"), body, 0644)
+			require.NoError(t, err)
+
+			ca, err := cache.NewCacheService(cacheCfg, testLogger)
+			require.NoError(t, err)
+			closeOnCleanup(t, ca)
+			require.Equal(t, 0, ca.ItemCount())
+
+			cacheCfg.RepairOnLoad = true
+			repaired, err := cache.NewCacheService(cacheCfg, testLogger)
+			require.NoError(t, err)
+			closeOnCleanup(t, repaired)
+		})
+	}
+}
@@ -1,15 +1,26 @@
 package cache
 
 import (
+	"bufio"
+	"bytes"
 	"context"
+	"crypto/cipher"
+	"crypto/sha256"
 	"encoding/json"
 	"fmt"
 	"io"
+	"math/rand"
 	"os"
 	"path/filepath"
+	"reflect"
+	"strconv"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/patrickmn/go-cache"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 	"go.uber.org/zap"
 
 	"github.com/comfforts/cloudstorage"
@@ -21,52 +32,260 @@ const (
 	DEFAULT_CACHE_FILE_NAME  = "cache"
 	DEFAULT_EXPIRATION       = 5 * time.Minute
 	DEFAULT_CLEANUP_INTERVAL = 10 * time.Minute
+
+	// durations passed to Set follow go-cache's conventions
+	USE_DEFAULT_EXPIRATION = cache.DefaultExpiration
+	NO_EXPIRATION          = cache.NoExpiration
+
+	PERSIST_FAILURE_LIMIT = 3
+
+	DEFAULT_MAX_CONCURRENT_FILE_OPS = 1
 )
 
 type CacheService interface {
 	Set(key string, value interface{}, d time.Duration) error
+	Add(key string, value interface{}, d time.Duration) error
+	SetSensitive(key string, value interface{}, d time.Duration) error
+	SetWithGroup(key string, value interface{}, d time.Duration, groups ...string) error
+	SetWithSoftHard(key string, value interface{}, soft, hard time.Duration) error
+	GetWithStaleness(key string) (interface{}, bool, bool)
+	InvalidateGroup(group string) int
 	Get(key string) (interface{}, time.Time)
+	GetWithFound(key string) (interface{}, time.Time, bool)
+	GetWithReason(key string) (interface{}, Reason)
+	GetOrDefault(key string, def interface{}) interface{}
+	GetTyped(key string) (interface{}, time.Time, bool)
+	GetRaw(key string) (json.RawMessage, bool)
+	GetWithContext(ctx context.Context, key string) (interface{}, time.Time, error)
+	GetManyWithExpiration(keys []string) map[string]ItemView
+	SetSource(src Source)
+	SetSink(sink Sink)
+	ReplicateTo(target CacheService)
+	Pending() int
 	Delete(key string)
 	DeleteExpired()
 	ItemCount() int
 	Items() map[string]cache.Item
+	LazyItems() map[string]func() (interface{}, error)
+	ExportCSV(w io.Writer, columns func(key string, value interface{}) []string) error
 	Updated() bool
 	Clear() error
 	ClearFile() error
+	Purge() error
+	SetCloudBucket(bucket string) error
+	Ready() <-chan struct{}
+	WaitReady(ctx context.Context) error
+	DefaultExpiration() time.Duration
+	CleanupInterval() time.Duration
+	PauseCleanup()
+	ResumeCleanup()
+	Peek(key string) (interface{}, time.Time, bool)
+	LoadMerged(paths []string) error
+	LoadFromURL(ctx context.Context, url string) error
+	SetNX(key string, value interface{}, d time.Duration) (bool, error)
+	SetIfStale(key string, value interface{}, d time.Duration, threshold time.Duration) (bool, error)
+	Stats() Stats
+	HitRatio() float64
+	Use(mws ...Middleware) CacheService
+	MetricsJSON() ([]byte, error)
+	Update(key string, value interface{}) error
+	SetUntil(key string, value interface{}, expireAt time.Time) error
+	Transaction(fn func(tx CacheTx) error) error
+	Compact()
+	TransformAll(fn func(key string, value interface{}) (interface{}, bool)) int
+	IncrementFloat(key string, n float64) (float64, error)
+	MergeCounters(key string, deltas map[string]int64, d time.Duration) (map[string]int64, error)
+	Degraded() bool
+	GetMany(ctx context.Context, keys []string) (map[string]interface{}, error)
+	LastAccess(key string) (time.Time, bool)
+	Keys() []string
+	KeysMatching(pattern string) ([]string, error)
+	SyncToCloud() error
+	DownloadBackupTo(ctx context.Context, path string) error
+	Freeze(path string) error
+	FetchFromCloud(ctx context.Context, key string) (interface{}, bool, error)
+	ExpiringBefore(t time.Time) int
+	RecentCloudSyncs() []CloudSyncEvent
+	RecentDeletions() []DeletionRecord
+	BackupAge() (time.Duration, bool)
+	DeleteMatching(pattern string) (int, error)
+	ReplaceAll(items map[string]interface{}, d time.Duration)
+	Reset(removeFile bool) error
+	PreviewPersist() (PersistPreview, error)
 }
 
 type CacheConfig struct {
 	DataDir       string
 	CacheFileName string
 	MarshalFn
+	MarshalFns             []MarshalFn
 	DefaultExpiration      time.Duration
 	DefaultCleanupInterval time.Duration
+	WriteBehindQueueSize   int
+	WriteBehindBatchSize   int
+	WriteBehindInterval    time.Duration
+	WriteBehindRetries     int
+	LoadKeyMigrate         KeyMigrateFn
+	AsyncRestore           bool
+	TracerProvider         trace.TracerProvider
+	// CleanupBatchSize has the janitor remove expired items this many at a time,
+	// yielding the lock between batches so a mass expiry doesn't stall callers.
+	CleanupBatchSize int
+	// MaxItems bounds the item count, least recently used items are evicted
+	// to make room unless RejectOnFull is set.
+	MaxItems     int
+	RejectOnFull bool
+	// HotCacheSize fronts the store with a lock free cache of that many
+	// recently read keys, it's ignored with MaxItems or SlidingExpiration
+	// since those track every read.
+	HotCacheSize int
+	// SlidingExpiration extends an item's ttl every time it's read.
+	SlidingExpiration bool
+	// StaleWhileRevalidate serves expired items for up to this long past
+	// expiration while the source refreshes them in the background.
+	StaleWhileRevalidate time.Duration
+	// DedupValues stores identical values once, in memory and in the cache file.
+	DedupValues bool
+	// MaxFileBytes rejects saves whose encoded size exceeds it.
+	MaxFileBytes int64
+	// NewEncoder and NewDecoder replace encoding/json for the cache file.
+	NewEncoder func(w io.Writer) Encoder
+	NewDecoder func(r io.Reader) Decoder
+	// FallbackToMemory keeps serving from memory once persisting has
+	// failed PERSIST_FAILURE_LIMIT times in a row.
+	FallbackToMemory bool
+	// StoreMarshalled keeps values JSON encoded, trading decoding on every
+	// read for saves that don't marshal the whole cache.
+	StoreMarshalled bool
+	// BinaryFile persists a compact length-prefixed binary file instead of JSON,
+	// either format loads regardless of the setting.
+	BinaryFile bool
+	// ValidateFn checks each loaded value after MarshalFn, failing entries are
+	// dropped, or abort the whole load when StrictValidation is set.
+	ValidateFn       ValidateFn
+	StrictValidation bool
+	// MaxConcurrentFileOps bounds how many saves and loads touch the cache
+	// file at once, defaults to DEFAULT_MAX_CONCURRENT_FILE_OPS.
+	MaxConcurrentFileOps int
+	// NormalizeOnSet stores values as MarshalFn returns them after a reload,
+	// so reads get the same type whether a value was set or loaded.
+	NormalizeOnSet bool
+	// OnMarshalError is what Set does when NormalizeOnSet can't marshal a value.
+	OnMarshalError MarshalErrorPolicy
+	// IntegrityCheckInterval saves a checksum sidecar with the cache file and
+	// checks the file against it this often, OnIntegrityFailure is called on mismatch.
+	IntegrityCheckInterval time.Duration
+	OnIntegrityFailure     func(filePath string, err error)
+	// MaxSetsPerSec and MaxGetsPerSec rate limit Set and Get with a token bucket
+	// allowing a second's worth of burst, limited calls fail with ErrRateLimited
+	// after waiting up to RateLimitWait for a token.
+	MaxSetsPerSec float64
+	MaxGetsPerSec float64
+	RateLimitWait time.Duration
+	// EncodeWorkers encodes the items of JSON saves across this many goroutines,
+	// large caches save faster with a few. Binary and custom encoder saves ignore it.
+	EncodeWorkers int
+	// DeletionHistorySize keeps this many recent deletions for RecentDeletions.
+	DeletionHistorySize int
+	// RelativeExpirations loads persisted expirations relative to the file's saved_at
+	// instead of as absolute times, so a file saved on a machine with a skewed clock
+	// keeps the ttls its items had left. Binary and legacy files have no save time
+	// and load as is.
+	RelativeExpirations bool
+	// StrictEncoding fails the whole save when an item can't be encoded,
+	// by default such items are logged and left out of the file.
+	StrictEncoding bool
+	// ExpirationJitter adds a random duration up to it to every expiring item.
+	ExpirationJitter time.Duration
+	// RepairOnLoad salvages the items that still decode from a corrupt
+	// cache file and rewrites it clean, instead of starting fresh.
+	RepairOnLoad bool
+	// EncryptionKey is the AES key values set with SetSensitive are encrypted
+	// with in the cache file, other values stay plaintext.
+	EncryptionKey []byte
+	// RandSource drives jitter and retry backoff, a time seeded source is used when nil.
+	RandSource rand.Source
+	// Clock tells SetUntil the current time, time.Now is used when nil.
+	Clock func() time.Time
 }
 
 type CacheStorageConfig struct {
 	CredsPath   string
 	Bucket      string
 	CloudClient cloudstorage.CloudStorage
+	// SkipCloudOnClear only saves locally on Clear, uploads happen through SyncToCloud.
+	SkipCloudOnClear bool
+	// SkipLocalFile keeps the cache memory only, saves are streamed straight
+	// to the cloud bucket and restores read the backup without a local copy.
+	SkipLocalFile bool
+	// CloudFallbackOnCorrupt loads the cloud backup when the local file fails to load,
+	// the local file is kept alongside with CORRUPT_FILE_SUFFIX appended.
+	CloudFallbackOnCorrupt bool
+	// MaxBackupAge forces an upload once the last successful one is older than it,
+	// whether or not the cache changed since.
+	MaxBackupAge time.Duration
+	// CloudChunkSize uploads backups larger than it in chunks of this many bytes,
+	// when the cloud client implements CloudChunkedUploader.
+	CloudChunkSize int64
 }
 
 type MarshalFn func(p interface{}) (interface{}, error)
 
+// KeyMigrateFn maps a persisted key to its current key scheme during load, returning keep as false drops the item.
+type KeyMigrateFn func(oldKey string) (newKey string, keep bool)
+
+type ValidateFn func(key string, value interface{}) error
+
+type ItemView struct {
+	Value      interface{}
+	Expiration time.Time
+}
+
 type cacheService struct {
 	CacheConfig
-	loadedAt  int64
-	updatedAt int64
-	cache     *cache.Cache
+	// unix nanos, so a write in the same second as a load or upload still counts
+	loadedAt        atomic.Int64
+	updatedAt       atomic.Int64
+	cache           *cache.Cache
+	storeMu         sync.RWMutex
+	defaultExp      time.Duration
+	access          *accessTracker
+	sliding         *slidingTTLs
+	revalidator     *revalidator
+	blobs           *blobStore
+	hot             *hotCache
+	syncHistory     syncHistory
+	deletions       *deletionHistory
+	expiries        *expiryIndex
+	rand            *lockedRand
+	groups          *groupIndex
+	softTTLs        *softTTLs
+	sensitive       *sensitiveKeys
+	aead            cipher.AEAD
+	stats           cacheStats
+	degraded        atomic.Bool
+	persistFailures atomic.Int64
+	janitor         *janitor
+	fileOps         fileOps
+	backups         *janitor
+	integrity       *janitor
+	setLimit        *tokenBucket
+	getLimit        *tokenBucket
+	backupsSince    time.Time
+	lastUploadAt    atomic.Int64
+	marshalFns      []MarshalFn
 	logger.AppLogger
 	StoreConfig CacheStorageConfig
+	mu          sync.RWMutex
+	source      Source
+	writeBehind *writeBehind
+	replica     *replicator
+	ready       chan struct{}
 }
 
 func newCacheService(cfg CacheConfig, l logger.AppLogger) (*cacheService, error) {
-	if cfg.DataDir == "" || l == nil {
-		return nil, errors.NewAppError(errors.ERROR_MISSING_REQUIRED)
-	}
-
-	if cfg.MarshalFn == nil {
-		return nil, errors.NewAppError("missing cache data marshalling function")
+	if err := validateConfig(cfg, l); err != nil {
+		return nil, err
 	}
 
 	defaultExp := cfg.DefaultExpiration
@@ -78,41 +297,101 @@ func newCacheService(cfg CacheConfig, l logger.AppLogger) (*cacheService, error)
 		cleanupInterval = DEFAULT_CLEANUP_INTERVAL
 	}
 
+	maxFileOps := cfg.MaxConcurrentFileOps
+	if maxFileOps <= 0 {
+		maxFileOps = DEFAULT_MAX_CONCURRENT_FILE_OPS
+	}
+
 	if cfg.CacheFileName == "" {
 		cfg.CacheFileName = DEFAULT_CACHE_FILE_NAME
 	}
+	if err := validateCacheFileName(cfg.CacheFileName); err != nil {
+		l.Error(ERROR_INVALID_CACHE_FILE_NAME, zap.String("cacheFileName", cfg.CacheFileName))
+		return nil, err
+	}
 
-	c := cache.New(defaultExp, cleanupInterval)
+	marshalFns := cfg.MarshalFns
+	if cfg.MarshalFn != nil {
+		marshalFns = append([]MarshalFn{cfg.MarshalFn}, marshalFns...)
+	}
 
 	cacheService := &cacheService{
 		CacheConfig: cfg,
-		cache:       c,
+		defaultExp:  defaultExp,
+		janitor:     newJanitor(cleanupInterval),
+		fileOps:     newFileOps(maxFileOps),
+		marshalFns:  marshalFns,
 		AppLogger:   l,
+		ready:       make(chan struct{}),
+		rand:        newLockedRand(cfg.RandSource),
+		groups:      newGroupIndex(),
+		softTTLs:    newSoftTTLs(),
+		expiries:    newExpiryIndex(cfg.CleanupBatchSize > 0),
+		setLimit:    newTokenBucket(cfg.MaxSetsPerSec, cfg.RateLimitWait),
+		getLimit:    newTokenBucket(cfg.MaxGetsPerSec, cfg.RateLimitWait),
+	}
+	if cfg.DeletionHistorySize > 0 {
+		cacheService.deletions = newDeletionHistory(cfg.DeletionHistorySize)
 	}
+	if cfg.MaxItems > 0 {
+		cacheService.access = newAccessTracker()
+	}
+	if cfg.SlidingExpiration {
+		cacheService.sliding = newSlidingTTLs()
+	}
+	if cfg.StaleWhileRevalidate > 0 {
+		cacheService.revalidator = newRevalidator(cfg.StaleWhileRevalidate)
+	}
+	if cfg.DedupValues {
+		cacheService.blobs = newBlobStore()
+	}
+	if len(cfg.EncryptionKey) > 0 {
+		aead, err := newAEAD(cfg.EncryptionKey)
+		if err != nil {
+			l.Error(ERROR_INVALID_ENCRYPTION_KEY, zap.Error(err))
+			return nil, ErrInvalidEncryptionKey
+		}
+		cacheService.aead = aead
+		cacheService.sensitive = newSensitiveKeys()
+	}
+	if cfg.HotCacheSize > 0 && cfg.MaxItems <= 0 && !cfg.SlidingExpiration {
+		cacheService.hot = newHotCache(cfg.HotCacheSize)
+	}
+	cacheService.cache = cacheService.newStore()
+	go cacheService.janitor.run(cacheService.cleanup)
+	cacheService.startIntegrityCheck()
 	return cacheService, nil
 }
 
+// validateConfig is shared by the constructors so each reports the specific missing field.
+func validateConfig(cfg CacheConfig, l logger.AppLogger) error {
+	if l == nil {
+		return ErrMissingLogger
+	}
+	if cfg.DataDir == "" {
+		l.Error(ERROR_MISSING_DATA_DIR)
+		return ErrMissingDataDir
+	}
+	if cfg.MarshalFn == nil && len(cfg.MarshalFns) == 0 {
+		l.Error(ERROR_MISSING_MARSHAL_FN)
+		return ErrMissingMarshalFn
+	}
+	return nil
+}
+
 func NewCacheService(cfg CacheConfig, l logger.AppLogger) (*cacheService, error) {
 	cacheService, err := newCacheService(cfg, l)
 	if err != nil {
 		return nil, err
 	}
 
-	err = cacheService.loadFile()
-	if err != nil {
-		l.Info("starting with fresh cache")
-	}
-
+	cacheService.restore()
 	return cacheService, nil
 }
 
 func NewWithCloudBackup(cacheCfg CacheConfig, cloudCfg CacheStorageConfig, l logger.AppLogger) (*cacheService, error) {
-	if cacheCfg.DataDir == "" || l == nil {
-		return nil, errors.NewAppError(errors.ERROR_MISSING_REQUIRED)
-	}
-
-	if cacheCfg.MarshalFn == nil {
-		return nil, errors.NewAppError("missing cache data marshalling function")
+	if err := validateConfig(cacheCfg, l); err != nil {
+		return nil, err
 	}
 
 	if cloudCfg.CloudClient == nil {
@@ -142,32 +421,492 @@ func NewWithCloudBackup(cacheCfg CacheConfig, cloudCfg CacheStorageConfig, l log
 	}
 	ca.StoreConfig = cloudCfg
 
-	err = ca.loadFile()
-	if err != nil {
-		l.Info("starting with fresh cache")
-	}
-
+	ca.restore()
+	ca.startBackupLoop()
 	return ca, nil
 }
 
 func (c *cacheService) Set(key string, value interface{}, d time.Duration) error {
-	err := c.cache.Add(key, value, d)
+	if !c.setLimit.take() {
+		c.Error(ERROR_RATE_LIMITED, zap.String("key", key), zap.String("op", "set"))
+		return ErrRateLimited
+	}
+	return c.set(key, value, d)
+}
+
+// Add sets the value only when key isn't cached yet, failing with ErrKeyExists otherwise.
+func (c *cacheService) Add(key string, value interface{}, d time.Duration) error {
+	if !c.setLimit.take() {
+		c.Error(ERROR_RATE_LIMITED, zap.String("key", key), zap.String("op", "add"))
+		return ErrRateLimited
+	}
+	return c.put(key, value, d, setOptions{onlyNew: true})
+}
+
+// set is Set without the rate limit.
+func (c *cacheService) set(key string, value interface{}, d time.Duration) error {
+	return c.put(key, value, d, setOptions{})
+}
+
+// setFromSource stores a value fetched from the source without the rate limit. It isn't
+// passed on to the write-behind sink, which would write back what was just read.
+func (c *cacheService) setFromSource(key string, value interface{}, d time.Duration) error {
+	return c.put(key, value, d, setOptions{skipSink: true})
+}
+
+// setReplicated stores a value replicated from a primary under the ttl the primary
+// stored it with, which already has the primary's jitter.
+func (c *cacheService) setReplicated(key string, value interface{}, d time.Duration, sensitive bool) error {
+	opts := setOptions{exactTTL: true}
+	if !sensitive {
+		return c.put(key, value, d, opts)
+	}
+	if c.aead == nil {
+		c.Error(ERROR_MISSING_ENCRYPTION_KEY, zap.String("key", key))
+		return ErrMissingEncryptionKey
+	}
+	return c.putSensitive(key, value, d, opts)
+}
+
+// setOptions change how put stores a value, the zero value stores it as set does.
+type setOptions struct {
+	// onlyNew fails with ErrKeyExists when key is already cached.
+	onlyNew bool
+	// exactTTL stores the ttl as given, without ExpirationJitter.
+	exactTTL bool
+	// skipSink leaves the value out of write-behind.
+	skipSink bool
+}
+
+// put stores value, replacing an existing item unless opts.onlyNew is set.
+func (c *cacheService) put(key string, value interface{}, d time.Duration, opts setOptions) error {
+	p, err := c.prepareSet(key, value, d, opts)
+	if p == nil {
+		return err
+	}
+
+	if c.MaxItems > 0 {
+		err = c.setBounded(key, p.stored, p.d, opts.onlyNew)
+	} else {
+		c.storeMu.RLock()
+		err = c.storeItem(key, c.blobs.intern(p.stored), c.storeTTL(p.d), opts.onlyNew)
+		c.storeMu.RUnlock()
+	}
+	if err == ErrCacheFull {
+		c.Error(ERROR_CACHE_FULL, zap.String("key", key), zap.Int("maxItems", c.MaxItems))
+		return err
+	}
+	if err == ErrKeyExists {
+		c.Debug(ERROR_KEY_EXISTS, zap.String("key", key))
+		return err
+	}
 	if err != nil {
-		c.Error("error setting cache", zap.Error(err), zap.String("key", key), zap.Any("value", value))
+		c.Error("error setting cache", zap.Error(err), zap.String("key", key), zap.Any("value", p.value))
 		return errors.WrapError(err, ERROR_SET_CACHE)
 	}
-	c.updatedAt = time.Now().Unix()
+	c.updatedAt.Store(time.Now().UnixNano())
+	return c.setDone(p)
+}
+
+// pendingSet is a value ready to store, as normalized, encoded and with the ttl jittered.
+type pendingSet struct {
+	key      string
+	value    interface{}
+	stored   interface{}
+	d        time.Duration
+	skipSink bool
+}
+
+// prepareSet readies value for the store, it returns nil when normalizing skipped the value.
+func (c *cacheService) prepareSet(key string, value interface{}, d time.Duration, opts setOptions) (*pendingSet, error) {
+	if c.NormalizeOnSet {
+		normalized, ok, err := c.normalize(key, value)
+		if !ok {
+			return nil, err
+		}
+		value = normalized
+	}
+	if opts.exactTTL {
+		d = ttl(d)
+	} else {
+		d = c.jitterTTL(d)
+	}
+	stored, err := c.encodeValue(value)
+	if err != nil {
+		c.Error(ERROR_MARSHALLING_CACHE_OBJECT, zap.Error(err), zap.String("key", key))
+		return nil, err
+	}
+	return &pendingSet{key: key, value: value, stored: stored, d: d, skipSink: opts.skipSink}, nil
+}
+
+// storeItem writes to the store, callers hold storeMu.
+func (c *cacheService) storeItem(key string, value interface{}, d time.Duration, onlyNew bool) error {
+	if !onlyNew {
+		c.cache.Set(key, value, d)
+		return nil
+	}
+	if err := c.cache.Add(key, value, d); err != nil {
+		return ErrKeyExists
+	}
 	return nil
 }
 
-func (c *cacheService) Get(key string) (interface{}, time.Time) {
-	val, exp, ok := c.cache.GetWithExpiration(key)
-	if !ok {
-		return nil, exp
+// setDone updates the bookkeeping for a stored value and passes it on to replicas and the sink.
+func (c *cacheService) setDone(p *pendingSet) error {
+	c.trackExpiry(p.key, c.storeTTL(p.d))
+	// a replaced item doesn't keep the soft ttl or groups it may have been set with
+	c.softTTLs.remove(p.key)
+	c.groups.remove(p.key)
+	c.sliding.record(p.key, c.effectiveTTL(p.d))
+	c.revalidator.markFresh(p.key, c.effectiveTTL(p.d))
+	c.hot.invalidate(p.key)
+	c.getReplica().enqueue(replicaOp{kind: replicaSet, key: p.key, value: p.value, d: p.d, sensitive: c.sensitive.has(p.key)})
+
+	if wb := c.getWriteBehind(); wb != nil && !p.skipSink {
+		return wb.enqueue(p.key, p.value)
 	}
+	return nil
+}
+
+func (c *cacheService) Get(key string) (interface{}, time.Time) {
+	val, exp, _ := c.GetWithFound(key)
 	return val, exp
 }
 
+// GetWithFound is Get also reporting whether key was found, telling a miss apart from a cached nil.
+func (c *cacheService) GetWithFound(key string) (interface{}, time.Time, bool) {
+	val, exp, err := c.GetWithContext(context.Background(), key)
+	if err != nil {
+		return nil, exp, false
+	}
+	return val, exp, true
+}
+
+// GetOrDefault returns def when Get finds nothing for key.
+func (c *cacheService) GetOrDefault(key string, def interface{}) interface{} {
+	val, _, err := c.GetWithContext(context.Background(), key)
+	if err != nil || val == nil {
+		return def
+	}
+	return val
+}
+
+// GetTyped runs key's value through MarshalFn in the form it takes after a reload,
+// so callers get the same concrete type whether the value was set or loaded.
+func (c *cacheService) GetTyped(key string) (interface{}, time.Time, bool) {
+	val, exp, err := c.GetWithContext(context.Background(), key)
+	if err != nil || val == nil {
+		return nil, time.Time{}, false
+	}
+
+	obj, err := c.typed(val)
+	if err != nil {
+		c.Error("error marshalling cache object", zap.Error(err), zap.String("key", key))
+		return nil, time.Time{}, false
+	}
+	return obj, exp, true
+}
+
+func (c *cacheService) GetWithContext(ctx context.Context, key string) (interface{}, time.Time, error) {
+	if !c.getLimit.take() {
+		c.Error(ERROR_RATE_LIMITED, zap.String("key", key), zap.String("op", "get"))
+		return nil, time.Time{}, ErrRateLimited
+	}
+
+	val, exp, ok := c.lookup(key)
+	c.stats.recordRead(ok)
+	if ok {
+		if until, tracked := c.revalidator.freshUntil(key); tracked {
+			exp = until
+			if time.Now().After(until) {
+				c.revalidate(key)
+			}
+		}
+		return val, exp, nil
+	}
+
+	src := c.getSource()
+	if src == nil {
+		return nil, exp, ErrKeyNotFound
+	}
+
+	val, d, found, err := c.fetch(ctx, src, key, "cache.source.fetch")
+	if err != nil {
+		c.Error("error fetching value from source", zap.Error(err), zap.String("key", key))
+		return nil, exp, errors.WrapError(err, ERROR_FETCHING_SOURCE)
+	}
+	if !found {
+		return nil, exp, ErrKeyNotFound
+	}
+
+	err = c.setFromSource(key, val, d)
+	if err != nil {
+		c.Error("error caching source value", zap.Error(err), zap.String("key", key))
+	}
+	if cVal, cExp, ok := c.getWithExpiration(key); ok {
+		return cVal, cExp, nil
+	}
+	return val, exp, nil
+}
+
+func (c *cacheService) GetManyWithExpiration(keys []string) map[string]ItemView {
+	c.storeMu.RLock()
+	defer c.storeMu.RUnlock()
+
+	views := map[string]ItemView{}
+	for _, key := range keys {
+		val, exp, ok := c.cache.GetWithExpiration(key)
+		if ok {
+			views[key] = ItemView{
+				Value:      c.resolve(val),
+				Expiration: exp,
+			}
+		}
+	}
+	return views
+}
+
+// SetUntil sets the value to expire at expireAt, which has to be in the future.
+// ExpirationJitter isn't applied so the item never outlives expireAt.
+func (c *cacheService) SetUntil(key string, value interface{}, expireAt time.Time) error {
+	now := time.Now
+	if c.Clock != nil {
+		now = c.Clock
+	}
+	d := expireAt.Sub(now())
+	if d <= 0 {
+		c.Error(ERROR_EXPIRE_AT_IN_PAST, zap.String("key", key), zap.Time("expireAt", expireAt))
+		return ErrExpireAtInPast
+	}
+	if !c.setLimit.take() {
+		c.Error(ERROR_RATE_LIMITED, zap.String("key", key), zap.String("op", "set"))
+		return ErrRateLimited
+	}
+	return c.put(key, value, d, setOptions{exactTTL: true})
+}
+
+// Update replaces key's value keeping its remaining ttl, erroring when the key is missing.
+func (c *cacheService) Update(key string, value interface{}) error {
+	if c.NormalizeOnSet {
+		normalized, ok, err := c.normalize(key, value)
+		if !ok {
+			return err
+		}
+		value = normalized
+	}
+	stored, err := c.encodeValue(value)
+	if err != nil {
+		c.Error(ERROR_MARSHALLING_CACHE_OBJECT, zap.Error(err), zap.String("key", key))
+		return err
+	}
+
+	c.storeMu.Lock()
+	_, exp, found := c.cache.GetWithExpiration(key)
+	if !found {
+		c.storeMu.Unlock()
+		return ErrKeyNotFound
+	}
+	d := NO_EXPIRATION
+	if !exp.IsZero() {
+		d = time.Until(exp)
+	}
+	c.cache.Set(key, c.blobs.intern(stored), d)
+	c.updatedAt.Store(time.Now().UnixNano())
+	c.storeMu.Unlock()
+	c.trackExpiry(key, d)
+
+	c.access.touch(key)
+	c.hot.invalidate(key)
+	c.getReplica().enqueue(replicaOp{kind: replicaSet, key: key, value: value, d: d, sensitive: c.sensitive.has(key)})
+
+	if wb := c.getWriteBehind(); wb != nil {
+		return wb.enqueue(key, value)
+	}
+	return nil
+}
+
+// IncrementFloat atomically adds n to a float64 value, erroring when the key is missing or holds another type.
+func (c *cacheService) IncrementFloat(key string, n float64) (float64, error) {
+	val, d, err := c.incrementFloat(key, n)
+	if err != nil {
+		c.Error(ERROR_INCREMENT_CACHE, zap.Error(err), zap.String("key", key))
+		return 0, errors.WrapError(err, ERROR_INCREMENT_CACHE)
+	}
+	c.trackExpiry(key, d)
+	c.hot.invalidate(key)
+	c.getReplica().enqueue(replicaOp{kind: replicaIncrement, key: key, n: n})
+
+	if wb := c.getWriteBehind(); wb != nil {
+		return val, wb.enqueue(key, val)
+	}
+	return val, nil
+}
+
+// incrementFloat adds n to the float held by key under the store lock, decoding it
+// first so deduplicated and marshalled values add up too. It returns the new value
+// and the ttl it was stored with, which keeps the current expiration.
+func (c *cacheService) incrementFloat(key string, n float64) (float64, time.Duration, error) {
+	c.storeMu.Lock()
+	defer c.storeMu.Unlock()
+
+	val, exp, found := c.cache.GetWithExpiration(key)
+	if !found {
+		return 0, 0, ErrKeyNotFound
+	}
+	current, err := c.decodeData(val)
+	if err != nil {
+		return 0, 0, err
+	}
+	var next interface{}
+	var sum float64
+	switch f := current.(type) {
+	case float64:
+		sum = f + n
+		next = sum
+	case float32:
+		sum = float64(f) + n
+		next = float32(sum)
+	default:
+		return 0, 0, ErrNotFloat
+	}
+
+	stored, err := c.encodeValue(next)
+	if err != nil {
+		return 0, 0, err
+	}
+	d := NO_EXPIRATION
+	if !exp.IsZero() {
+		d = time.Until(exp)
+	}
+	c.cache.Set(key, c.blobs.intern(stored), d)
+	c.updatedAt.Store(time.Now().UnixNano())
+	return sum, d, nil
+}
+
+// ExpiringBefore counts live items that expire before t, items without expiration aren't counted.
+func (c *cacheService) ExpiringBefore(t time.Time) int {
+	c.storeMu.RLock()
+	items := c.cache.Items()
+	c.storeMu.RUnlock()
+
+	deadline := t.UnixNano()
+	count := 0
+	for _, item := range items {
+		if item.Expiration > 0 && item.Expiration < deadline {
+			count++
+		}
+	}
+	return count
+}
+
+// Degraded reports whether persistence was disabled after repeated failures.
+func (c *cacheService) Degraded() bool {
+	return c.degraded.Load()
+}
+
+// SetNX sets the value only when key is absent, reporting whether it did.
+func (c *cacheService) SetNX(key string, value interface{}, d time.Duration) (bool, error) {
+	if _, _, ok := c.Peek(key); ok {
+		return false, nil
+	}
+
+	err := c.Add(key, value, d)
+	if err == ErrKeyExists {
+		// lost the race to a concurrent writer
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// SetIfStale sets the value only when key is absent or has less than threshold left to
+// live, reporting whether it did. Items without expiration are never stale.
+func (c *cacheService) SetIfStale(key string, value interface{}, d time.Duration, threshold time.Duration) (bool, error) {
+	_, exp, ok := c.Peek(key)
+	if ok {
+		if exp.IsZero() || time.Until(exp) >= threshold {
+			return false, nil
+		}
+		// Add only inserts, the stale item has to go first
+		c.deletions.expect(key, DeletionExplicit)
+		c.storeMu.RLock()
+		c.cache.Delete(key)
+		c.storeMu.RUnlock()
+		c.deletions.done(key)
+	}
+
+	err := c.Add(key, value, d)
+	if err == ErrKeyExists {
+		// lost the race to a concurrent writer
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// Peek reads an item without counting as an access, so it neither
+// slides the item's expiration nor refreshes its LRU position.
+func (c *cacheService) Peek(key string) (interface{}, time.Time, bool) {
+	return c.getWithExpiration(key)
+}
+
+// ReplaceAll swaps in a new store holding exactly the given items,
+// readers observe either the previous or the new contents, never a mix.
+func (c *cacheService) ReplaceAll(items map[string]interface{}, d time.Duration) {
+	encoded := map[string]interface{}{}
+	for k, v := range items {
+		stored, err := c.encodeValue(v)
+		if err != nil {
+			c.Error(ERROR_MARSHALLING_CACHE_OBJECT, zap.Error(err), zap.String("key", k))
+			continue
+		}
+		encoded[k] = stored
+	}
+
+	c.storeMu.Lock()
+	// values are interned under the lock so pruning can't drop them before they're stored
+	c.blobs.reset()
+	store := c.newStore()
+	for k, v := range encoded {
+		store.Set(k, c.blobs.intern(v), c.storeTTL(d))
+	}
+	c.cache = store
+	c.hot.reset()
+	c.access.reset()
+	c.sliding.reset()
+	c.revalidator.reset()
+	c.groups.reset()
+	c.softTTLs.reset()
+	c.expiries.reset()
+	c.sensitive.reset()
+	for k := range encoded {
+		c.trackExpiry(k, c.storeTTL(d))
+		c.access.touch(k)
+		c.sliding.record(k, c.effectiveTTL(d))
+		c.revalidator.markFresh(k, c.effectiveTTL(d))
+	}
+	c.storeMu.Unlock()
+
+	c.updatedAt.Store(time.Now().UnixNano())
+	if r := c.getReplica(); r != nil {
+		r.enqueue(replicaOp{kind: replicaFlush})
+		for k := range encoded {
+			r.enqueue(replicaOp{kind: replicaSet, key: k, value: items[k], d: d})
+		}
+	}
+	c.Info("cache contents replaced", zap.Int("count", len(items)), zap.String("cacheDir", c.DataDir))
+}
+
+func (c *cacheService) SetSource(src Source) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.source = src
+}
+
 func (c *cacheService) Delete(key string) {
 	c.delete(key)
 }
@@ -188,6 +927,41 @@ func (c *cacheService) Clear() error {
 	return c.clear()
 }
 
+// Reset empties the cache and its bookkeeping without stopping the janitor or
+// touching cloud storage, removeFile also deletes the local cache file.
+func (c *cacheService) Reset(removeFile bool) error {
+	c.storeMu.Lock()
+	c.cache.Flush()
+	c.hot.reset()
+	c.access.reset()
+	c.sliding.reset()
+	c.revalidator.reset()
+	c.groups.reset()
+	c.softTTLs.reset()
+	c.expiries.reset()
+	c.sensitive.reset()
+	c.blobs.reset()
+	c.storeMu.Unlock()
+	c.getReplica().enqueue(replicaOp{kind: replicaFlush})
+
+	c.setLoadedAt(0)
+	c.persistFailures.Store(0)
+	c.degraded.Store(false)
+	c.Info("cache reset", zap.String("cacheDir", c.DataDir), zap.Bool("removeFile", removeFile))
+
+	if !removeFile {
+		return nil
+	}
+	filePath := filepath.Join(c.DataDir, fmt.Sprintf("%s.json", c.CacheFileName))
+	removeChecksum(filePath)
+	err := os.Remove(filePath)
+	if err != nil && !os.IsNotExist(err) {
+		c.Error("error removing file", zap.Error(err), zap.String("filePath", filePath))
+		return errors.WrapError(err, "error removing file %s", filePath)
+	}
+	return nil
+}
+
 func (c *cacheService) ClearFile() error {
 	filePath := filepath.Join(c.DataDir, fmt.Sprintf("%s.json", c.CacheFileName))
 	c.Info("removing cache file", zap.String("filePath", filePath))
@@ -205,6 +979,7 @@ func (c *cacheService) ClearFile() error {
 		}
 	}
 
+	removeChecksum(filePath)
 	err = os.Remove(filePath)
 	if err != nil {
 		c.Error("error removing file", zap.Error(err), zap.String("filePath", filePath))
@@ -213,102 +988,613 @@ func (c *cacheService) ClearFile() error {
 	return cloudErr
 }
 
+func (c *cacheService) Purge() error {
+	c.deleteExpired()
+
+	err := c.saveFile()
+	if err != nil {
+		c.Error("error saving purged cache file", zap.Error(err))
+		return err
+	}
+
+	if c.StoreConfig.CloudClient != nil {
+		err = c.uploadCloudCache(false)
+		if err != nil {
+			c.Error("error uploading purged cache file", zap.Error(err))
+			return err
+		}
+	}
+	return nil
+}
+
 func (c *cacheService) Updated() bool {
-	c.Info("cache file status", zap.Int64("loadedAt", c.loadedAt), zap.Int64("updatedAt", c.updatedAt))
-	return c.updatedAt > c.loadedAt
+	c.Info("cache file status", zap.Int64("loadedAt", c.loadedAt.Load()), zap.Int64("updatedAt", c.updatedAt.Load()))
+	return c.updatedAt.Load() > c.loadedAt.Load()
+}
+
+func (c *cacheService) Ready() <-chan struct{} {
+	return c.ready
+}
+
+// DefaultExpiration returns the resolved ttl used for USE_DEFAULT_EXPIRATION.
+func (c *cacheService) DefaultExpiration() time.Duration {
+	return c.defaultExp
 }
 
-func (c *cacheService) loadFile() error {
+// CleanupInterval returns the resolved interval expired items are removed at.
+func (c *cacheService) CleanupInterval() time.Duration {
+	return c.janitor.interval
+}
+
+// PauseCleanup stops the janitor removing expired items until ResumeCleanup.
+func (c *cacheService) PauseCleanup() {
+	c.janitor.paused.Store(true)
+	c.Info("cache cleanup paused", zap.String("cacheDir", c.DataDir))
+}
+
+func (c *cacheService) ResumeCleanup() {
+	c.janitor.paused.Store(false)
+	c.Info("cache cleanup resumed", zap.String("cacheDir", c.DataDir))
+}
+
+// WaitReady blocks until the initial restore has finished or ctx is done.
+func (c *cacheService) WaitReady(ctx context.Context) error {
+	select {
+	case <-c.ready:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// restore loads the persisted cache, in the background when AsyncRestore is set,
+// closing the ready channel once done.
+func (c *cacheService) restore() {
+	written := c.updatedAt.Load()
+	if c.AsyncRestore {
+		go c.restoreFile(written)
+		return
+	}
+	c.restoreFile(written)
+}
+
+func (c *cacheService) restoreFile(written int64) {
+	defer close(c.ready)
+
+	err := c.loadFile(written)
+	if err != nil {
+		c.Info("starting with fresh cache", zap.Error(err))
+	}
+}
+
+// loadFile loads the persisted cache, written is updatedAt from before the restore began.
+func (c *cacheService) loadFile(written int64) (err error) {
 	filePath := filepath.Join(c.DataDir, fmt.Sprintf("%s.json", c.CacheFileName))
 	c.Info("loading cache file", zap.String("filePath", filePath))
 
+	_, span := c.startSpan(context.Background(), "cache.load", attribute.String("file", filePath))
+	defer func() {
+		if err == nil {
+			c.markLoaded(written)
+			c.Info("cache file loaded", zap.Int64("loadedAt", c.loadedAt.Load()), zap.Int64("updatedAt", c.updatedAt.Load()))
+		}
+		span.SetAttributes(attribute.Int("items", c.count()))
+		endSpan(span, err)
+	}()
+
+	if c.StoreConfig.SkipLocalFile && c.StoreConfig.CloudClient != nil {
+		return c.loadCloudStream(filePath)
+	}
+
+	_, statErr := os.Stat(filePath)
+	repaired, err := c.readFile(filePath)
+	if err != nil && statErr == nil && c.StoreConfig.CloudFallbackOnCorrupt && c.StoreConfig.CloudClient != nil {
+		repaired, err = c.loadCloudFallback(filePath, err)
+	}
+	if err != nil {
+		return err
+	}
+	if repaired {
+		c.rewriteRepaired(filePath)
+	}
+	return nil
+}
+
+func (c *cacheService) readFile(filePath string) (bool, error) {
+	c.fileOps.acquire()
+	defer c.fileOps.release()
+
+	source := LOAD_SOURCE_LOCAL
 	_, err := os.Stat(filePath)
 	if err != nil {
 		if c.StoreConfig.CloudClient != nil {
+			source = LOAD_SOURCE_CLOUD
 			err := c.downloadCloudCache()
 			if err != nil {
 				c.Error("error getting cache file from storage")
-				return errors.WrapError(err, "error getting cache file from storage")
+				return false, errors.WrapError(err, "error getting cache file from storage")
 			}
 		} else {
 			c.Error("error no cache file")
-			return errors.WrapError(err, "error no cache file")
+			return false, errors.WrapError(err, "error no cache file")
 		}
 	}
 
 	file, err := os.Open(filePath)
+	if err != nil {
+		return false, errors.WrapError(err, ERROR_OPENING_CACHE_FILE)
+	}
 	defer func() {
 		err := file.Close()
 		if err != nil {
 			c.Error("error closing file after loading", zap.Error(err))
 		}
 	}()
+
+	repaired, err := c.load(file, filePath)
 	if err != nil {
-		return errors.WrapError(err, ERROR_OPENING_CACHE_FILE)
+		return false, errors.WrapError(err, ERROR_LOADING_CACHE_FILE)
+	}
+	c.stats.recordLoadSource(source)
+	return repaired, nil
+}
+
+// load restores the items read from r, repaired reports whether RepairOnLoad
+// salvaged them from filePath so the caller can rewrite it.
+func (c *cacheService) load(r io.Reader, filePath string) (repaired bool, err error) {
+	items, err := c.decodeItems(r)
+	if err != nil && err != ErrUnsupportedVersion && c.RepairOnLoad {
+		items, err = c.repairFile(filePath, err)
+		repaired = err == nil
+	}
+	if err == nil {
+		// with AsyncRestore the cache is already taking writes, those are newer than the file
+		err = c.restoreItems(items, c.AsyncRestore)
+	}
+	return repaired, err
+}
+
+// LoadMerged loads several cache files into one view. Conflicting keys
+// resolve to the copy that expires last, ties go to the later path.
+func (c *cacheService) LoadMerged(paths []string) error {
+	merged := map[string]cache.Item{}
+	for _, p := range paths {
+		items, err := c.decodeFile(p)
+		if err != nil {
+			return err
+		}
+		for k, v := range items {
+			if cur, ok := merged[k]; ok && expiresAfter(cur, v) {
+				continue
+			}
+			merged[k] = v
+		}
 	}
 
-	err = c.load(file)
+	err := c.restoreItems(merged, false)
 	if err != nil {
-		return errors.WrapError(err, ERROR_LOADING_CACHE_FILE)
+		return err
 	}
+	c.setLoadedAt(time.Now().UnixNano())
+	c.Info("cache files merged", zap.Int("files", len(paths)), zap.Int("items", len(merged)))
 	return nil
 }
 
-func (c *cacheService) load(r io.Reader) error {
-	dec := json.NewDecoder(r)
-	items := map[string]cache.Item{}
-	err := dec.Decode(&items)
-	if err == nil {
-		for k, v := range items {
-			if !v.Expired() {
-				obj, err := c.MarshalFn(v.Object)
-				if err != nil {
-					c.Error("error marshalling file object", zap.Error(err), zap.String("cacheDir", c.DataDir))
-				} else {
-					err = c.Set(k, obj, 5*time.Hour)
-					if err != nil {
-						c.Error(ERROR_SET_CACHE, zap.Error(err), zap.String("cacheDir", c.DataDir))
-					} else {
-						c.Debug("cache item loaded", zap.String("cacheDir", c.DataDir), zap.String("key", k), zap.Any("value", obj), zap.Any("exp", v.Expiration))
-					}
+func (c *cacheService) decodeFile(filePath string) (map[string]cache.Item, error) {
+	file, err := os.Open(filePath)
+	if err != nil {
+		c.Error("error opening cache file", zap.Error(err), zap.String("filePath", filePath))
+		return nil, errors.WrapError(err, ERROR_OPENING_CACHE_FILE)
+	}
+	defer func() {
+		if err := file.Close(); err != nil {
+			c.Error("error closing file after loading", zap.Error(err))
+		}
+	}()
+
+	items, err := c.decodeItems(file)
+	if err == ErrUnsupportedVersion {
+		return nil, err
+	}
+	if err != nil {
+		c.Error("error decoding cache file", zap.Error(err), zap.String("filePath", filePath))
+		return nil, errors.WrapError(err, ERROR_LOADING_CACHE_FILE)
+	}
+	return items, nil
+}
+
+// expiresAfter reports whether a outlives b, items without expiration outlive everything.
+func expiresAfter(a, b cache.Item) bool {
+	if a.Expiration == 0 || b.Expiration == 0 {
+		return a.Expiration == 0 && b.Expiration != 0
+	}
+	return a.Expiration > b.Expiration
+}
+
+func (c *cacheService) decodeItems(r io.Reader) (map[string]cache.Item, error) {
+	r, err := decompressReader(r)
+	if err != nil {
+		c.Error("error decompressing cache file", zap.Error(err), zap.String("cacheDir", c.DataDir))
+		return nil, err
+	}
+
+	br := bufio.NewReader(r)
+	if isBinary(br) {
+		version, items, err := decodeBinary(br)
+		if version > CACHE_FILE_VERSION {
+			if err != nil {
+				c.Error(ERROR_UNSUPPORTED_VERSION, zap.Error(err), zap.Int("version", version))
+				return nil, ErrUnsupportedVersion
+			}
+			c.Info("loaded items from newer cache file version", zap.Int("version", version), zap.Int("supported", CACHE_FILE_VERSION))
+		}
+		if err != nil {
+			return nil, err
+		}
+		// binary files have no save time to rebase on
+		c.rebaseExpirations(nil, items)
+		return items, nil
+	}
+
+	var raw json.RawMessage
+	err = c.newDecoder(br).Decode(&raw)
+	if err != nil {
+		return nil, err
+	}
+	if items, staleAt, ok := decodeDedupFile(raw); ok {
+		markStale(items, staleAt)
+		c.rebaseExpirations(raw, items)
+		return items, nil
+	}
+
+	body := []byte(raw)
+	version, envItems, enveloped := decodeEnvelope(raw)
+	if enveloped {
+		body = envItems
+	}
+
+	fi := map[string]fileItem{}
+	err = c.newDecoder(bytes.NewReader(body)).Decode(&fi)
+	items, staleAt := splitFileItems(fi)
+	markStale(items, staleAt)
+	if enveloped && version > CACHE_FILE_VERSION {
+		// newer layouts load best-effort as long as items keep their shape
+		if err != nil {
+			c.Error(ERROR_UNSUPPORTED_VERSION, zap.Error(err), zap.Int("version", version))
+			return nil, ErrUnsupportedVersion
+		}
+		c.Info("loaded items from newer cache file version", zap.Int("version", version), zap.Int("supported", CACHE_FILE_VERSION))
+	}
+	if err != nil {
+		return nil, err
+	}
+	c.rebaseExpirations(raw, items)
+	return items, nil
+}
+
+// restoreItems sets the loaded items, nothing is set when strict validation fails.
+// keepExisting leaves keys that are already cached alone.
+func (c *cacheService) restoreItems(items map[string]cache.Item, keepExisting bool) error {
+	restored := map[string]cache.Item{}
+	sensitive := map[string]bool{}
+	staleAt := map[string]int64{}
+	for k, v := range items {
+		if c.LoadKeyMigrate != nil {
+			newKey, keep := c.LoadKeyMigrate(k)
+			if !keep {
+				c.Debug("cache item dropped by key migration", zap.String("cacheDir", c.DataDir), zap.String("key", k))
+				continue
+			}
+			k = newKey
+		}
+		if v.Expired() {
+			continue
+		}
+		saved, stale := unwrapStale(v.Object)
+		plain, isSensitive, err := c.openSensitive(saved)
+		if err != nil {
+			c.Error(ERROR_DECRYPTING_VALUE, zap.Error(err), zap.String("cacheDir", c.DataDir), zap.String("key", k))
+			continue
+		}
+		obj, err := c.marshal(plain)
+		if err != nil {
+			c.Error("error marshalling file object", zap.Error(err), zap.String("cacheDir", c.DataDir))
+			continue
+		}
+		if c.ValidateFn != nil {
+			if err := c.ValidateFn(k, obj); err != nil {
+				if c.StrictValidation {
+					c.Error(ERROR_INVALID_CACHE_VALUE, zap.Error(err), zap.String("cacheDir", c.DataDir), zap.String("key", k))
+					return errors.WrapError(err, ERROR_INVALID_CACHE_VALUE)
 				}
+				c.Debug("cache item dropped by validation", zap.Error(err), zap.String("cacheDir", c.DataDir), zap.String("key", k))
+				continue
+			}
+		}
+		restored[k] = cache.Item{Object: obj, Expiration: v.Expiration}
+		sensitive[k] = isSensitive
+		staleAt[k] = stale
+	}
+
+	for k, v := range restored {
+		d, ok := restoreTTL(v)
+		if !ok {
+			continue
+		}
+		stored, err := c.restoreItem(k, v.Object, d, keepExisting)
+		if err != nil {
+			c.Error(ERROR_SET_CACHE, zap.Error(err), zap.String("cacheDir", c.DataDir))
+		} else if !stored {
+			c.Debug("cache item kept over loaded copy", zap.String("cacheDir", c.DataDir), zap.String("key", k))
+		} else {
+			if sensitive[k] {
+				c.sensitive.add(k)
+			}
+			if staleAt[k] > 0 {
+				c.softTTLs.record(k, time.Unix(0, staleAt[k]))
 			}
+			c.Debug("cache item loaded", zap.String("cacheDir", c.DataDir), zap.String("key", k), zap.Any("value", v.Object), zap.Any("exp", v.Expiration))
+		}
+	}
+	return nil
+}
+
+// restoreItem stores a loaded value under the ttl left on its saved expiration. Unlike set it
+// doesn't jitter the ttl or pass the value on to replicas and the sink, which already have it.
+// false is returned when keepExisting finds key already cached.
+func (c *cacheService) restoreItem(key string, value interface{}, d time.Duration, keepExisting bool) (bool, error) {
+	stored, err := c.encodeValue(value)
+	if err != nil {
+		c.Error(ERROR_MARSHALLING_CACHE_OBJECT, zap.Error(err), zap.String("key", key))
+		return false, err
+	}
+
+	c.storeMu.Lock()
+	if _, found := c.cache.Get(key); found {
+		if keepExisting {
+			c.storeMu.Unlock()
+			return false, nil
+		}
+	} else if err := c.makeRoom(); err != nil {
+		c.storeMu.Unlock()
+		return false, err
+	}
+	c.cache.Set(key, c.blobs.intern(stored), d)
+	c.storeMu.Unlock()
+
+	c.access.touch(key)
+	c.trackExpiry(key, d)
+	c.sliding.record(key, d)
+	// the saved expiration already includes the revalidation window
+	fresh := d
+	if c.revalidator != nil && d != NO_EXPIRATION {
+		fresh -= c.revalidator.window
+	}
+	c.revalidator.markFresh(key, fresh)
+	c.hot.invalidate(key)
+	return true, nil
+}
+
+func (c *cacheService) SetSink(sink Sink) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.writeBehind != nil {
+		c.writeBehind.close()
+		c.writeBehind = nil
+	}
+	if sink != nil {
+		c.writeBehind = newWriteBehind(sink, c.CacheConfig, c.rand, c.AppLogger)
+		go c.writeBehind.run()
+	}
+}
+
+func (c *cacheService) Pending() int {
+	if wb := c.getWriteBehind(); wb != nil {
+		return int(wb.pending.Load())
+	}
+	return 0
+}
+
+// SyncToCloud saves the cache file and uploads it to the cloud bucket.
+func (c *cacheService) SyncToCloud() error {
+	return c.syncToCloud(false)
+}
+
+func (c *cacheService) syncToCloud(force bool) error {
+	if c.StoreConfig.CloudClient == nil {
+		return ErrCloudNotConfigured
+	}
+
+	err := c.saveFile()
+	if err != nil {
+		c.Error("error saving cache file for cloud sync", zap.Error(err))
+		return err
+	}
+	err = c.uploadCloudCache(force)
+	if err != nil {
+		c.Error("error syncing cache file to cloud", zap.Error(err))
+		return err
+	}
+	return nil
+}
+
+func (c *cacheService) SetCloudBucket(bucket string) error {
+	if bucket == "" {
+		c.Error(ERROR_MISSING_BUCKET)
+		return ErrMissingBucket
+	}
+	if c.StoreConfig.CloudClient == nil {
+		c.Error(ERROR_CLOUD_NOT_CONFIGURED)
+		return ErrCloudNotConfigured
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.Info("switching cloud bucket", zap.String("from", c.StoreConfig.Bucket), zap.String("to", bucket))
+	c.StoreConfig.Bucket = bucket
+	return nil
+}
+
+func (c *cacheService) cloudBucket() string {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.StoreConfig.Bucket
+}
+
+func (c *cacheService) getWriteBehind() *writeBehind {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.writeBehind
+}
+
+func (c *cacheService) getSource() Source {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.source
+}
+
+func (c *cacheService) marshal(p interface{}) (interface{}, error) {
+	if len(c.marshalFns) == 1 {
+		return c.marshalFns[0](p)
+	}
+
+	var err error = ErrNoMatchingMarshalFn
+	for _, fn := range c.marshalFns {
+		obj, fnErr := fn(p)
+		if fnErr != nil {
+			err = fnErr
+			continue
+		}
+		if obj == nil || reflect.ValueOf(obj).IsZero() {
+			continue
 		}
+		return obj, nil
+	}
+	return nil, err
+}
+
+// ttl maps a requested duration onto go-cache's conventions,
+// zero uses the default expiration and any negative duration never expires.
+func ttl(d time.Duration) time.Duration {
+	if d < 0 {
+		return NO_EXPIRATION
+	}
+	return d
+}
+
+// restoreTTL returns what's left of a persisted item's ttl so reloading doesn't change when
+// it expires, items persisted without expiration are restored without expiration.
+// It's false for items that expired since they were read.
+func restoreTTL(v cache.Item) (time.Duration, bool) {
+	if v.Expiration == 0 {
+		return NO_EXPIRATION, true
 	}
-	c.setLoadedAt(time.Now().Unix())
-	c.Info("cache file loaded", zap.Int64("loadedAt", c.loadedAt), zap.Int64("updatedAt", c.updatedAt))
-	return err
+	d := time.Until(time.Unix(0, v.Expiration))
+	return d, d > 0
+}
+
+func (c *cacheService) newStore() *cache.Cache {
+	return c.newStoreFrom(map[string]cache.Item{})
+}
+
+// newStoreFrom makes a store holding items as they are, expirations included.
+func (c *cacheService) newStoreFrom(items map[string]cache.Item) *cache.Cache {
+	store := cache.NewFrom(c.defaultExp, 0, items)
+	store.OnEvicted(func(key string, _ interface{}) {
+		c.access.remove(key)
+		c.sliding.remove(key)
+		c.revalidator.remove(key)
+		c.groups.remove(key)
+		c.sensitive.remove(key)
+		c.softTTLs.remove(key)
+		c.expiries.remove(key)
+		c.deletions.record(key)
+	})
+	return store
+}
+
+func (c *cacheService) getWithExpiration(key string) (interface{}, time.Time, bool) {
+	c.storeMu.RLock()
+	defer c.storeMu.RUnlock()
+	val, exp, ok := c.cache.GetWithExpiration(key)
+	return c.resolve(val), exp, ok
+}
+
+// count leaves out expired items the janitor hasn't removed yet, go-cache's
+// ItemCount includes them while its Items doesn't.
+func (c *cacheService) count() int {
+	c.storeMu.RLock()
+	defer c.storeMu.RUnlock()
+	return len(c.cache.Items())
 }
 
 func (c *cacheService) setLoadedAt(at int64) {
-	c.loadedAt = at
-	c.updatedAt = at
+	c.loadedAt.Store(at)
+	c.updatedAt.Store(at)
+}
+
+// markLoaded records a finished load, written is updatedAt from before it began.
+// A write made while the load ran keeps the cache marked updated so it still gets saved.
+func (c *cacheService) markLoaded(written int64) {
+	now := time.Now().UnixNano()
+	if c.updatedAt.CompareAndSwap(written, now) {
+		c.loadedAt.Store(now)
+	}
 }
 
 func (c *cacheService) delete(key string) {
+	c.deletions.expect(key, DeletionExplicit)
+	c.storeMu.RLock()
 	c.cache.Delete(key)
-	c.updatedAt = time.Now().Unix()
+	c.storeMu.RUnlock()
+	c.deletions.done(key)
+	c.hot.invalidate(key)
+	c.updatedAt.Store(time.Now().UnixNano())
+	c.getReplica().enqueue(replicaOp{kind: replicaDelete, key: key})
 	c.Debug(KEY_DELETED, zap.String("key", key), zap.String("cacheDir", c.DataDir))
 }
 
 func (c *cacheService) deleteExpired() {
+	c.storeMu.RLock()
 	c.cache.DeleteExpired()
+	c.storeMu.RUnlock()
+	c.pruneBlobs()
 	c.Debug(DELETED_EXPIRED, zap.String("cacheDir", c.DataDir))
 }
 
 func (c *cacheService) itemCount() int {
-	count := c.cache.ItemCount()
+	count := c.count()
 	c.Info(RETURNING_COUNT, zap.String("cacheDir", c.DataDir))
 	return count
 }
 
 func (c *cacheService) items() map[string]cache.Item {
+	c.storeMu.RLock()
 	items := c.cache.Items()
+	c.storeMu.RUnlock()
+	if c.blobs != nil || c.StoreMarshalled {
+		for k, item := range items {
+			item.Object = c.resolve(item.Object)
+			items[k] = item
+		}
+	}
 	c.Info(RETURNING_ALL_ITEMS, zap.String("cacheDir", c.DataDir))
 	return items
 }
 
 func (c *cacheService) clear() error {
+	defer c.janitor.close()
+
+	c.SetSink(nil)
+	c.ReplicateTo(nil)
+	if c.backups != nil {
+		c.backups.close()
+	}
+	if c.integrity != nil {
+		c.integrity.close()
+	}
+
 	if c.Updated() {
 		c.Info("cleaning up geo code data structures")
 		err := c.saveFile()
@@ -317,8 +1603,8 @@ func (c *cacheService) clear() error {
 			return err
 		}
 
-		if c.StoreConfig.CloudClient != nil {
-			err = c.uploadCloudCache()
+		if c.StoreConfig.CloudClient != nil && !c.StoreConfig.SkipCloudOnClear {
+			err = c.uploadCloudCache(false)
 			if err != nil {
 				c.Error("error uploading cache file", zap.Error(err))
 				return err
@@ -326,7 +1612,20 @@ func (c *cacheService) clear() error {
 		}
 	}
 
+	c.storeMu.RLock()
 	c.cache.Flush()
+	c.hot.reset()
+	c.access.reset()
+	c.sliding.reset()
+	c.revalidator.reset()
+	c.groups.reset()
+	c.softTTLs.reset()
+	c.expiries.reset()
+	c.sensitive.reset()
+	c.blobs.reset()
+	c.storeMu.RUnlock()
+	// the saved file still holds what was flushed, a second Clear mustn't overwrite it
+	c.setLoadedAt(time.Now().UnixNano())
 	c.Info(CACHE_FLUSHED, zap.String("cacheDir", c.DataDir))
 
 	if c.StoreConfig.CloudClient != nil {
@@ -340,11 +1639,52 @@ func (c *cacheService) clear() error {
 	return nil
 }
 
+// saveFile persists the cache, with FallbackToMemory set repeated failures
+// disable persistence for the session instead of failing callers.
 func (c *cacheService) saveFile() error {
+	if c.StoreConfig.SkipLocalFile {
+		return nil
+	}
+	if c.degraded.Load() {
+		c.Debug("persistence disabled, skipping save", zap.String("cacheDir", c.DataDir))
+		return nil
+	}
+
+	err := c.writeFile()
+	if err == nil {
+		c.persistFailures.Store(0)
+		return nil
+	}
+	if !c.FallbackToMemory || err == ErrFileTooLarge {
+		return err
+	}
+	if c.persistFailures.Add(1) < PERSIST_FAILURE_LIMIT {
+		return err
+	}
+	c.degraded.Store(true)
+	c.Error("persistence keeps failing, continuing memory only", zap.Error(err), zap.String("cacheDir", c.DataDir))
+	return nil
+}
+
+func (c *cacheService) writeFile() error {
+	c.fileOps.acquire()
+	defer c.fileOps.release()
+
 	filePath := filepath.Join(c.DataDir, fmt.Sprintf("%s.json", c.CacheFileName))
 	c.Info("saving cache file", zap.String("filePath", filePath))
 
-	_, err := os.Stat(filepath.Dir(filePath))
+	// encode before touching the file so a rejected save leaves the previous one intact
+	var buf bytes.Buffer
+	err := c.encodeItems(&buf)
+	if err != nil {
+		return errors.WrapError(err, ERROR_SAVING_CACHE_FILE)
+	}
+	if c.MaxFileBytes > 0 && int64(buf.Len()) > c.MaxFileBytes {
+		c.Error(ERROR_FILE_TOO_LARGE, zap.String("filePath", filePath), zap.Int("bytes", buf.Len()), zap.Int64("maxFileBytes", c.MaxFileBytes))
+		return ErrFileTooLarge
+	}
+
+	_, err = os.Stat(filepath.Dir(filePath))
 	if err != nil {
 		if os.IsNotExist(err) {
 			err = os.MkdirAll(filepath.Dir(filePath), os.ModePerm)
@@ -365,20 +1705,61 @@ func (c *cacheService) saveFile() error {
 		}
 	}()
 
-	encoder := json.NewEncoder(file)
-	items := c.cache.Items()
-	err = encoder.Encode(items)
+	sum := sha256.Sum256(buf.Bytes())
+	_, err = buf.WriteTo(file)
 	if err != nil {
 		return errors.WrapError(err, ERROR_SAVING_CACHE_FILE)
 	}
+	if c.IntegrityCheckInterval > 0 {
+		if err := writeChecksum(filePath, sum); err != nil {
+			c.Error("error saving cache file checksum", zap.Error(err), zap.String("filePath", filePath))
+		}
+	}
 	c.Info("cache file saved", zap.String("filePath", filePath))
 	return nil
 }
 
-func (c *cacheService) deleteCloudCache() error {
+// encodeItems writes the cache file form of the current items to w.
+func (c *cacheService) encodeItems(w io.Writer) error {
+	c.storeMu.RLock()
+	items := c.cache.Items()
+	c.storeMu.RUnlock()
+	items, err := c.sealSensitive(items)
+	if err != nil {
+		return err
+	}
+	if c.BinaryFile {
+		// binary records have no room for soft ttls, they're lost on reload
+		return c.writeBinary(w, items)
+	}
+	staleAt := c.softTTLs.snapshot()
+	if c.blobs == nil && c.NewEncoder == nil {
+		return c.writeMarshalled(w, items, staleAt)
+	}
+	items, err = c.encodableItems(items)
+	if err != nil {
+		return err
+	}
+	if c.blobs != nil {
+		return c.newEncoder(w).Encode(c.blobs.fileForm(items, staleAt))
+	}
+	return c.newEncoder(w).Encode(fileEnvelope{
+		fileHeader: newFileHeader(len(items)),
+		Items:      fileItems(items, staleAt),
+	})
+}
+
+func (c *cacheService) deleteCloudCache() (err error) {
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
 
+	start := time.Now()
+	ctx, span := c.startSpan(ctx, "cache.cloud.delete")
+	defer func() {
+		c.recordCloudSync(CLOUD_OP_DELETE, start, 0, err)
+		endSpan(span, err)
+	}()
+
 	if c.StoreConfig.CloudClient == nil {
 		c.Error("missing cloud storage client")
 		return errors.NewAppError("missing cloud storage client")
@@ -395,7 +1776,7 @@ func (c *cacheService) deleteCloudCache() error {
 	c.Info("file mod time", zap.Int64("modtime", fmod), zap.String("filepath", cacheFile))
 
 	cfr, err := cloudstorage.NewCloudFileRequest(
-		c.StoreConfig.Bucket,
+		c.cloudBucket(),
 		filepath.Base(cacheFile),
 		filepath.Dir(cacheFile),
 		fmod,
@@ -413,10 +1794,31 @@ func (c *cacheService) deleteCloudCache() error {
 	return nil
 }
 
-func (c *cacheService) uploadCloudCache() error {
+func (c *cacheService) uploadCloudCache(force bool) (err error) {
+	if c.degraded.Load() {
+		return nil
+	}
+	if c.StoreConfig.SkipLocalFile {
+		return c.streamCloudCache(force)
+	}
+
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
 
+	var n int64
+	skipped := false
+	start := time.Now()
+	ctx, span := c.startSpan(ctx, "cache.cloud.upload")
+	defer func() {
+		if !skipped {
+			if err == nil {
+				c.lastUploadAt.Store(time.Now().UnixNano())
+			}
+			c.recordCloudSync(CLOUD_OP_UPLOAD, start, n, err)
+		}
+		endSpan(span, err)
+	}()
+
 	if c.StoreConfig.CloudClient == nil {
 		c.Error("missing cloud storage client")
 		return errors.NewAppError("missing cloud storage client")
@@ -444,7 +1846,7 @@ func (c *cacheService) uploadCloudCache() error {
 	}()
 
 	cfr, err := cloudstorage.NewCloudFileRequest(
-		c.StoreConfig.Bucket,
+		c.cloudBucket(),
 		filepath.Base(cacheFile),
 		filepath.Dir(cacheFile),
 		fmod,
@@ -454,11 +1856,19 @@ func (c *cacheService) uploadCloudCache() error {
 		return err
 	}
 
-	n, err := c.StoreConfig.CloudClient.UploadFile(ctx, file, cfr)
+	decision := c.uploadDecision(ctx, cfr, fStats.ModTime(), force, cacheFile)
+	span.SetAttributes(attribute.String("decision", decision))
+	if decision == UPLOAD_DECISION_SKIPPED_UNCHANGED {
+		skipped = true
+		return nil
+	}
+
+	n, err = c.putCloudObject(ctx, file, cfr, fStats.ModTime(), fStats.Size())
 	if err != nil {
 		c.Error("error uploading file", zap.Error(err))
 		return err
 	}
+	span.SetAttributes(attribute.Int64("bytes", n))
 	c.Info("uploaded file",
 		zap.String("file", filepath.Base(cacheFile)),
 		zap.String("path", filepath.Dir(cacheFile)),
@@ -467,42 +1877,148 @@ func (c *cacheService) uploadCloudCache() error {
 	return nil
 }
 
+// uploadDecision logs and returns whether a cache saved at localMod gets uploaded,
+// unforced uploads are skipped when the client reports a backup at least as recent.
+func (c *cacheService) uploadDecision(ctx context.Context, cfr cloudstorage.CloudFileRequest, localMod time.Time, force bool, cacheFile string) string {
+	decision := UPLOAD_DECISION_UPLOADED
+	var remoteMod time.Time
+	if force {
+		decision = UPLOAD_DECISION_FORCED
+	} else if mt, ok := c.StoreConfig.CloudClient.(CloudObjectModTimer); ok {
+		var err error
+		remoteMod, err = mt.ObjectModTime(ctx, cfr)
+		if err != nil {
+			c.Debug("error fetching cloud file mod time", zap.Error(err), zap.String("filepath", cacheFile))
+			remoteMod = time.Time{}
+		}
+		if !remoteMod.IsZero() && !localMod.After(remoteMod) {
+			decision = UPLOAD_DECISION_SKIPPED_UNCHANGED
+		}
+	}
+	c.Info("cloud upload decision",
+		zap.String("decision", decision),
+		zap.Time("localModTime", localMod),
+		zap.Time("remoteModTime", remoteMod),
+		zap.String("filepath", cacheFile),
+	)
+	return decision
+}
+
+// putCloudObject uploads r, size is negative when it isn't known up front.
+func (c *cacheService) putCloudObject(ctx context.Context, r io.Reader, cfr cloudstorage.CloudFileRequest, savedAt time.Time, size int64) (int64, error) {
+	attrs := CloudObjectAttrs{
+		ContentType: c.contentType(),
+		Metadata: map[string]string{
+			METADATA_ITEM_COUNT: strconv.Itoa(c.count()),
+			METADATA_SAVED_AT:   savedAt.UTC().Format(time.RFC3339),
+		},
+	}
+	// compressed content is detected the way loads detect it, by its magic bytes
+	br := bufio.NewReader(r)
+	if head, err := br.Peek(len(gzipMagic)); err == nil && bytes.Equal(head, gzipMagic) {
+		attrs.ContentEncoding = CONTENT_ENCODING_GZIP
+	}
+	r = br
+	chunkSize := c.StoreConfig.CloudChunkSize
+	if cu, ok := c.StoreConfig.CloudClient.(CloudChunkedUploader); ok && chunkSize > 0 && (size < 0 || size > chunkSize) {
+		c.Info("uploading cache file in chunks", zap.Int64("size", size), zap.Int64("chunkSize", chunkSize))
+		return cu.UploadFileChunked(ctx, r, cfr, attrs, chunkSize)
+	}
+	if au, ok := c.StoreConfig.CloudClient.(CloudAttrsUploader); ok {
+		return au.UploadFileWithAttrs(ctx, r, cfr, attrs)
+	}
+	return c.StoreConfig.CloudClient.UploadFile(ctx, r, cfr)
+}
+
 func (c *cacheService) downloadCloudCache() error {
-	ctx, cancel := context.WithCancel(context.Background())
+	cacheFile := filepath.Join(c.DataDir, fmt.Sprintf("%s.json", c.CacheFileName))
+	if err := c.downloadCloudFile(context.Background(), cacheFile); err != nil {
+		return err
+	}
+	c.refreshChecksum(cacheFile)
+	return nil
+}
+
+// DownloadBackupTo fetches the cloud backup to path without touching the live cache file,
+// so it can be inspected before being promoted.
+func (c *cacheService) DownloadBackupTo(ctx context.Context, path string) error {
+	if c.StoreConfig.CloudClient == nil {
+		return ErrCloudNotConfigured
+	}
+	return c.downloadCloudFile(ctx, path)
+}
+
+// checkDownloadSize compares the n bytes downloaded to dest with the cloud object's size when
+// the client can report it, a failed size lookup leaves the download unverified.
+func (c *cacheService) checkDownloadSize(ctx context.Context, cfr cloudstorage.CloudFileRequest, n int64, dest string) error {
+	st, ok := c.StoreConfig.CloudClient.(CloudObjectStater)
+	if !ok {
+		return nil
+	}
+	size, err := st.ObjectSize(ctx, cfr)
+	if err != nil {
+		c.Error("error getting cloud object size, download not verified", zap.Error(err), zap.String("filepath", dest))
+		return nil
+	}
+	if n != size {
+		c.Error(ERROR_TRUNCATED_DOWNLOAD, zap.String("filepath", dest), zap.Int64("bytes", n), zap.Int64("size", size))
+		return ErrTruncatedDownload
+	}
+	return nil
+}
+
+// downloadCloudFile writes the cloud backup of the cache file to dest.
+func (c *cacheService) downloadCloudFile(ctx context.Context, dest string) (err error) {
+	ctx, cancel := context.WithCancel(ctx)
 	defer cancel()
 
+	var n int64
+	start := time.Now()
+	ctx, span := c.startSpan(ctx, "cache.cloud.download")
+	defer func() {
+		c.recordCloudSync(CLOUD_OP_DOWNLOAD, start, n, err)
+		endSpan(span, err)
+	}()
+
 	if c.StoreConfig.CloudClient == nil {
 		c.Error("missing cloud storage client")
 		return errors.NewAppError("missing cloud storage client")
 	}
 
 	cacheFile := filepath.Join(c.DataDir, fmt.Sprintf("%s.json", c.CacheFileName))
-	fStats, err := os.Stat(cacheFile)
 	var fmod int64
-	if err != nil {
-		err = os.MkdirAll(filepath.Dir(cacheFile), os.ModePerm)
-		if err != nil {
-			c.Error("error creating file directory", zap.Error(err), zap.String("filepath", cacheFile))
-			return errors.WrapError(err, "error creating file directory")
-		}
-	} else {
+	if fStats, err := os.Stat(cacheFile); err == nil {
 		fmod = fStats.ModTime().Unix()
 		c.Info("file mod time", zap.Int64("modtime", fmod), zap.String("filepath", cacheFile))
 	}
 
-	f, err := os.Create(cacheFile)
+	err = os.MkdirAll(filepath.Dir(dest), os.ModePerm)
+	if err != nil {
+		c.Error("error creating file directory", zap.Error(err), zap.String("filepath", dest))
+		return errors.WrapError(err, "error creating file directory")
+	}
+
+	f, err := os.Create(dest)
 	if err != nil {
-		c.Error("error creating file", zap.Error(err), zap.String("filepath", cacheFile))
-		return errors.WrapError(err, "error creating file %s", cacheFile)
+		c.Error("error creating file", zap.Error(err), zap.String("filepath", dest))
+		return errors.WrapError(err, "error creating file %s", dest)
 	}
+	// deferred ahead of the close so the partial file is removed once closed
+	defer func() {
+		if err == ErrTruncatedDownload {
+			if err := os.Remove(dest); err != nil {
+				c.Error("error removing truncated download", zap.Error(err), zap.String("filepath", dest))
+			}
+		}
+	}()
 	defer func() {
 		if err := f.Close(); err != nil {
-			c.Error("error closing file", zap.Error(err), zap.String("filepath", cacheFile))
+			c.Error("error closing file", zap.Error(err), zap.String("filepath", dest))
 		}
 	}()
 
 	cfr, err := cloudstorage.NewCloudFileRequest(
-		c.StoreConfig.Bucket,
+		c.cloudBucket(),
 		filepath.Base(cacheFile),
 		filepath.Dir(cacheFile),
 		fmod,
@@ -512,15 +2028,19 @@ func (c *cacheService) downloadCloudCache() error {
 		return err
 	}
 
-	n, err := c.StoreConfig.CloudClient.DownloadFile(ctx, f, cfr)
+	n, err = c.StoreConfig.CloudClient.DownloadFile(ctx, f, cfr)
 	if err != nil {
 		c.Error("error downloading file", zap.Error(err), zap.String("filepath", cacheFile))
 		return err
 	}
+	if err = c.checkDownloadSize(ctx, cfr, n, dest); err != nil {
+		return err
+	}
+	span.SetAttributes(attribute.Int64("bytes", n))
 	c.Info(
 		"downloaded file",
-		zap.String("file", filepath.Base(cacheFile)),
-		zap.String("path", filepath.Dir(cacheFile)),
+		zap.String("file", filepath.Base(dest)),
+		zap.String("path", filepath.Dir(dest)),
 		zap.Int64("bytes", n))
 	return nil
 }
@@ -1,19 +1,31 @@
 package cache_test
 
 import (
+	"bytes"
 	"encoding/json"
+	"fmt"
+	"io"
+	"math/rand"
+	"net"
 	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
+	gocache "github.com/patrickmn/go-cache"
 	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
 
 	"github.com/comfforts/cache"
 	"github.com/comfforts/logger"
 )
 
-const TEST_DIR = "data"
-
 type TestStruct struct {
 	Name string
 	Age  int
@@ -50,6 +62,13 @@ func TestCache(t *testing.T) {
 	}
 }
 
+// closeOnCleanup clears ca when the test ends so its janitor doesn't outlive it.
+func closeOnCleanup[C cache.CacheService](tb testing.TB, ca C) {
+	tb.Cleanup(func() {
+		_ = ca.Clear()
+	})
+}
+
 func setupTest(t *testing.T) (
 	ca cache.CacheService,
 	teardown func(),
@@ -58,7 +77,7 @@ func setupTest(t *testing.T) (
 
 	dataDir := os.Getenv("DATA_DIR")
 	if dataDir == "" {
-		dataDir = TEST_DIR
+		dataDir = t.TempDir()
 	}
 
 	testLogger := logger.NewTestAppLogger(dataDir)
@@ -80,9 +99,11 @@ func setupTest(t *testing.T) (
 		}
 		ca, err = cache.NewWithCloudBackup(cacheCfg, cloudCfg, testLogger)
 		require.NoError(t, err)
+		closeOnCleanup(t, ca)
 	} else {
 		ca, err = cache.NewCacheService(cacheCfg, testLogger)
 		require.NoError(t, err)
+		closeOnCleanup(t, ca)
 	}
 	require.Equal(t, true, ca != nil)
 
@@ -178,7 +199,7 @@ func testSetGetExpire(t *testing.T, ca cache.CacheService) {
 func TestSetGetReload(t *testing.T) {
 	dataDir := os.Getenv("DATA_DIR")
 	if dataDir == "" {
-		dataDir = TEST_DIR
+		dataDir = t.TempDir()
 	}
 
 	testLogger := logger.NewTestAppLogger(dataDir)
@@ -189,6 +210,7 @@ func TestSetGetReload(t *testing.T) {
 	}
 	ca, err := cache.NewCacheService(cacheCfg, testLogger)
 	require.NoError(t, err)
+	closeOnCleanup(t, ca)
 
 	val := TestStruct{
 		Name: "John",
@@ -219,6 +241,7 @@ func TestSetGetReload(t *testing.T) {
 
 	ca, err = cache.NewCacheService(cacheCfg, testLogger)
 	require.NoError(t, err)
+	closeOnCleanup(t, ca)
 
 	count = ca.ItemCount()
 	require.Equal(t, 1, count)
@@ -230,10 +253,190 @@ func TestSetGetReload(t *testing.T) {
 	require.NoError(t, err)
 }
 
+func TestClearTwice(t *testing.T) {
+	dataDir := t.TempDir()
+	testLogger := logger.NewTestAppLogger(dataDir)
+	cacheCfg := cache.CacheConfig{
+		DataDir:   dataDir,
+		MarshalFn: UnmarshallTestStruct,
+	}
+	ca, err := cache.NewCacheService(cacheCfg, testLogger)
+	require.NoError(t, err)
+	closeOnCleanup(t, ca)
+
+	err = ca.Set("test", TestStruct{Name: "John", Age: 34}, 5*time.Minute)
+	require.NoError(t, err)
+	err = ca.Clear()
+	require.NoError(t, err)
+	require.Equal(t, false, ca.Updated())
+
+	// the second clear leaves the saved file alone
+	err = ca.Clear()
+	require.NoError(t, err)
+
+	ca, err = cache.NewCacheService(cacheCfg, testLogger)
+	require.NoError(t, err)
+	closeOnCleanup(t, ca)
+	require.Equal(t, 1, ca.ItemCount())
+	cVal, _ := ca.Get("test")
+	require.Equal(t, TestStruct{Name: "John", Age: 34}, cVal)
+}
+
+func TestReloadKeepsExpiration(t *testing.T) {
+	dataDir := t.TempDir()
+	testLogger := logger.NewTestAppLogger(dataDir)
+	cacheCfg := cache.CacheConfig{
+		DataDir:   dataDir,
+		MarshalFn: UnmarshallTestStruct,
+	}
+	ca, err := cache.NewCacheService(cacheCfg, testLogger)
+	require.NoError(t, err)
+	closeOnCleanup(t, ca)
+
+	ttls := map[string]time.Duration{
+		"short":   200 * time.Millisecond,
+		"medium":  30 * time.Second,
+		"long":    10 * time.Minute,
+		"forever": cache.NO_EXPIRATION,
+	}
+	for k, d := range ttls {
+		err = ca.Set(k, TestStruct{Name: k, Age: 1}, d)
+		require.NoError(t, err)
+	}
+	before := ca.Items()
+	err = ca.Clear()
+	require.NoError(t, err)
+
+	loaded, err := cache.NewCacheService(cacheCfg, testLogger)
+	require.NoError(t, err)
+	closeOnCleanup(t, loaded)
+	require.Equal(t, len(ttls), loaded.ItemCount())
+	for k := range ttls {
+		_, exp, ok := loaded.Peek(k)
+		require.True(t, ok, k)
+		if before[k].Expiration == 0 {
+			require.True(t, exp.IsZero(), k)
+			continue
+		}
+		require.WithinDuration(t, time.Unix(0, before[k].Expiration), exp, 50*time.Millisecond, k)
+	}
+
+	// the short item expires on schedule rather than living on after the reload
+	time.Sleep(250 * time.Millisecond)
+	_, _, ok := loaded.Peek("short")
+	require.False(t, ok)
+}
+
+func TestReloadSkipsJitterAndSink(t *testing.T) {
+	dataDir := t.TempDir()
+	testLogger := logger.NewTestAppLogger(dataDir)
+	cacheCfg := cache.CacheConfig{
+		DataDir:          dataDir,
+		MarshalFn:        UnmarshallTestStruct,
+		ExpirationJitter: time.Minute,
+	}
+	ca, err := cache.NewCacheService(cacheCfg, testLogger)
+	require.NoError(t, err)
+	closeOnCleanup(t, ca)
+
+	for _, k := range []string{"a", "b", "c"} {
+		err = ca.Set(k, TestStruct{Name: k, Age: 1}, 10*time.Minute)
+		require.NoError(t, err)
+	}
+	before := ca.Items()
+	err = ca.Clear()
+	require.NoError(t, err)
+
+	// jitter isn't added again on every reload
+	for i := 0; i < 3; i++ {
+		loaded, err := cache.NewCacheService(cacheCfg, testLogger)
+		require.NoError(t, err)
+		closeOnCleanup(t, loaded)
+		for k, item := range before {
+			_, exp, ok := loaded.Peek(k)
+			require.True(t, ok, k)
+			require.WithinDuration(t, time.Unix(0, item.Expiration), exp, 50*time.Millisecond, k)
+		}
+		err = loaded.Clear()
+		require.NoError(t, err)
+	}
+
+	// loaded items aren't written back to the sink they came from
+	body, err := json.Marshal(before)
+	require.NoError(t, err)
+	filePath := filepath.Join(dataDir, "saved.json")
+	err = os.WriteFile(filePath, body, 0644)
+	require.NoError(t, err)
+
+	sink := newFakeSink(0)
+	ca.SetSink(sink)
+	err = ca.LoadMerged([]string{filePath})
+	require.NoError(t, err)
+	require.Equal(t, len(before), ca.ItemCount())
+	time.Sleep(100 * time.Millisecond)
+	require.Equal(t, 0, sink.Len())
+}
+
+func TestRelativeExpirations(t *testing.T) {
+	dataDir := t.TempDir()
+	testLogger := logger.NewTestAppLogger(dataDir)
+
+	// files saved by machines whose clocks run two hours ahead and behind
+	for name, skew := range map[string]time.Duration{"ahead": 2 * time.Hour, "behind": -2 * time.Hour} {
+		writerNow := time.Now().Add(skew)
+		file := struct {
+			Version int                    `json:"version"`
+			Count   int                    `json:"count"`
+			SavedAt time.Time              `json:"saved_at"`
+			Items   map[string]interface{} `json:"items"`
+		}{
+			Version: cache.CACHE_FILE_VERSION,
+			Count:   2,
+			SavedAt: writerNow.UTC(),
+			Items: map[string]interface{}{
+				"john":    map[string]interface{}{"Object": TestStruct{Name: "John", Age: 34}, "Expiration": writerNow.Add(10 * time.Minute).UnixNano()},
+				"forever": map[string]interface{}{"Object": TestStruct{Name: "Jane", Age: 29}, "Expiration": 0},
+			},
+		}
+		body, err := json.Marshal(file)
+		require.NoError(t, err)
+		err = os.WriteFile(filepath.Join(dataDir, name+".json"), body, 0644)
+		require.NoError(t, err)
+
+		cacheCfg := cache.CacheConfig{
+			DataDir:             dataDir,
+			CacheFileName:       name,
+			MarshalFn:           UnmarshallTestStruct,
+			RelativeExpirations: true,
+		}
+		ca, err := cache.NewCacheService(cacheCfg, testLogger)
+		require.NoError(t, err)
+		closeOnCleanup(t, ca)
+		_, exp, ok := ca.Peek("john")
+		require.True(t, ok, name)
+		require.WithinDuration(t, time.Now().Add(10*time.Minute), exp, time.Second, name)
+		_, exp, ok = ca.Peek("forever")
+		require.True(t, ok, name)
+		require.True(t, exp.IsZero(), name)
+
+		// read as absolute the skew carries over
+		cacheCfg.RelativeExpirations = false
+		absolute, err := cache.NewCacheService(cacheCfg, testLogger)
+		require.NoError(t, err)
+		closeOnCleanup(t, absolute)
+		_, exp, ok = absolute.Peek("john")
+		if skew > 0 {
+			require.True(t, ok, name)
+			require.WithinDuration(t, time.Now().Add(skew+10*time.Minute), exp, time.Second, name)
+		} else {
+			require.False(t, ok, name)
+		}
+	}
+}
 func TestSetGetReloadCloud(t *testing.T) {
 	dataDir := os.Getenv("DATA_DIR")
 	if dataDir == "" {
-		dataDir = TEST_DIR
+		dataDir = t.TempDir()
 	}
 
 	credsPath := os.Getenv("CREDS_PATH")
@@ -253,6 +456,7 @@ func TestSetGetReloadCloud(t *testing.T) {
 	}
 	ca, err := cache.NewWithCloudBackup(cacheCfg, cloudCfg, testLogger)
 	require.NoError(t, err)
+	closeOnCleanup(t, ca)
 
 	val := TestStruct{
 		Name: "Shiminic",
@@ -282,6 +486,7 @@ func TestSetGetReloadCloud(t *testing.T) {
 
 	ca, err = cache.NewWithCloudBackup(cacheCfg, cloudCfg, testLogger)
 	require.NoError(t, err)
+	closeOnCleanup(t, ca)
 
 	time.Sleep(50 * time.Millisecond)
 
@@ -291,3 +496,1799 @@ func TestSetGetReloadCloud(t *testing.T) {
 	err = ca.ClearFile()
 	require.NoError(t, err)
 }
+
+type TestAddress struct {
+	Street string
+	City   string
+}
+
+func UnmarshallTestAddress(p interface{}) (interface{}, error) {
+	var ad TestAddress
+	body, err := json.Marshal(p)
+	if err != nil {
+		return ad, err
+	}
+
+	err = json.Unmarshal(body, &ad)
+	if err != nil {
+		return ad, err
+	}
+	return ad, nil
+}
+
+func TestSetGetReloadMarshalFns(t *testing.T) {
+	dataDir := os.Getenv("DATA_DIR")
+	if dataDir == "" {
+		dataDir = t.TempDir()
+	}
+
+	testLogger := logger.NewTestAppLogger(dataDir)
+	cacheCfg := cache.CacheConfig{
+		DataDir:       dataDir,
+		CacheFileName: "multi",
+		MarshalFns:    []cache.MarshalFn{UnmarshallTestStruct, UnmarshallTestAddress},
+	}
+	ca, err := cache.NewCacheService(cacheCfg, testLogger)
+	require.NoError(t, err)
+	closeOnCleanup(t, ca)
+
+	person := TestStruct{
+		Name: "John",
+		Age:  34,
+	}
+	address := TestAddress{
+		Street: "1 Main St",
+		City:   "Springfield",
+	}
+
+	err = ca.Set("person", person, 5*time.Minute)
+	require.NoError(t, err)
+	err = ca.Set("address", address, 5*time.Minute)
+	require.NoError(t, err)
+
+	err = ca.Clear()
+	require.NoError(t, err)
+
+	ca, err = cache.NewCacheService(cacheCfg, testLogger)
+	require.NoError(t, err)
+	closeOnCleanup(t, ca)
+
+	count := ca.ItemCount()
+	require.Equal(t, 2, count)
+
+	pVal, _ := ca.Get("person")
+	rPerson, ok := pVal.(TestStruct)
+	require.Equal(t, true, ok)
+	require.Equal(t, person, rPerson)
+
+	aVal, _ := ca.Get("address")
+	rAddress, ok := aVal.(TestAddress)
+	require.Equal(t, true, ok)
+	require.Equal(t, address, rAddress)
+
+	err = ca.ClearFile()
+	require.NoError(t, err)
+}
+
+func TestPurge(t *testing.T) {
+	dataDir := os.Getenv("DATA_DIR")
+	if dataDir == "" {
+		dataDir = t.TempDir()
+	}
+
+	testLogger := logger.NewTestAppLogger(dataDir)
+	cacheCfg := cache.CacheConfig{
+		DataDir:       dataDir,
+		CacheFileName: "purge",
+		MarshalFn:     UnmarshallTestStruct,
+	}
+	ca, err := cache.NewCacheService(cacheCfg, testLogger)
+	require.NoError(t, err)
+	closeOnCleanup(t, ca)
+
+	val := TestStruct{
+		Name: "John",
+		Age:  34,
+	}
+	err = ca.Set("keep", val, 5*time.Minute)
+	require.NoError(t, err)
+	for i := 0; i < 10; i++ {
+		err = ca.Set(fmt.Sprintf("expire-%d", i), val, time.Second)
+		require.NoError(t, err)
+	}
+
+	err = ca.Purge()
+	require.NoError(t, err)
+
+	filePath := filepath.Join(dataDir, "purge.json")
+	fStats, err := os.Stat(filePath)
+	require.NoError(t, err)
+	fullSize := fStats.Size()
+
+	time.Sleep(1100 * time.Millisecond)
+
+	err = ca.Purge()
+	require.NoError(t, err)
+
+	count := ca.ItemCount()
+	require.Equal(t, 1, count)
+
+	fStats, err = os.Stat(filePath)
+	require.NoError(t, err)
+	require.Less(t, fStats.Size(), fullSize)
+
+	err = ca.ClearFile()
+	require.NoError(t, err)
+}
+
+func TestSetTTLConventions(t *testing.T) {
+	dataDir := os.Getenv("DATA_DIR")
+	if dataDir == "" {
+		dataDir = t.TempDir()
+	}
+
+	testLogger := logger.NewTestAppLogger(dataDir)
+	cacheCfg := cache.CacheConfig{
+		DataDir:       dataDir,
+		CacheFileName: "ttl",
+		MarshalFn:     UnmarshallTestStruct,
+	}
+	ca, err := cache.NewCacheService(cacheCfg, testLogger)
+	require.NoError(t, err)
+	closeOnCleanup(t, ca)
+
+	val := TestStruct{
+		Name: "John",
+		Age:  34,
+	}
+
+	now := time.Now().Unix()
+	err = ca.Set("default", val, cache.USE_DEFAULT_EXPIRATION)
+	require.NoError(t, err)
+	_, exp := ca.Get("default")
+	require.Equal(t, int64(cache.DEFAULT_EXPIRATION.Seconds()), exp.Unix()-now)
+
+	err = ca.Set("never", val, -1)
+	require.NoError(t, err)
+	cVal, exp := ca.Get("never")
+	require.Equal(t, true, exp.IsZero())
+	require.Equal(t, val, cVal)
+
+	err = ca.Clear()
+	require.NoError(t, err)
+
+	ca, err = cache.NewCacheService(cacheCfg, testLogger)
+	require.NoError(t, err)
+	closeOnCleanup(t, ca)
+
+	cVal, exp = ca.Get("never")
+	require.Equal(t, true, exp.IsZero())
+	require.Equal(t, val, cVal)
+
+	err = ca.ClearFile()
+	require.NoError(t, err)
+}
+
+func TestGetManyWithExpiration(t *testing.T) {
+	dataDir := t.TempDir()
+	testLogger := logger.NewTestAppLogger(dataDir)
+	cacheCfg := cache.CacheConfig{
+		DataDir:   dataDir,
+		MarshalFn: UnmarshallTestStruct,
+	}
+	ca, err := cache.NewCacheService(cacheCfg, testLogger)
+	require.NoError(t, err)
+	closeOnCleanup(t, ca)
+
+	john := TestStruct{Name: "John", Age: 34}
+	jane := TestStruct{Name: "Jane", Age: 29}
+
+	now := time.Now().Unix()
+	err = ca.Set("john", john, 5*time.Minute)
+	require.NoError(t, err)
+	err = ca.Set("jane", jane, time.Minute)
+	require.NoError(t, err)
+
+	views := ca.GetManyWithExpiration([]string{"john", "missing", "jane"})
+	require.Equal(t, 2, len(views))
+
+	_, ok := views["missing"]
+	require.Equal(t, false, ok)
+
+	require.Equal(t, john, views["john"].Value)
+	require.Equal(t, int64(300), views["john"].Expiration.Unix()-now)
+	require.Equal(t, jane, views["jane"].Value)
+	require.Equal(t, int64(60), views["jane"].Expiration.Unix()-now)
+}
+
+func TestLoadKeyMigrate(t *testing.T) {
+	dataDir := t.TempDir()
+	testLogger := logger.NewTestAppLogger(dataDir)
+
+	exp := time.Now().Add(5 * time.Minute).UnixNano()
+	items := map[string]gocache.Item{
+		"user:1": {Object: TestStruct{Name: "John", Age: 34}, Expiration: exp},
+		"user:2": {Object: TestStruct{Name: "Jane", Age: 29}, Expiration: exp},
+		"tmp:1":  {Object: TestStruct{Name: "Temp", Age: 1}, Expiration: exp},
+	}
+	body, err := json.Marshal(items)
+	require.NoError(t, err)
+	err = os.WriteFile(filepath.Join(dataDir, "cache.json"), body, 0644)
+	require.NoError(t, err)
+
+	cacheCfg := cache.CacheConfig{
+		DataDir:   dataDir,
+		MarshalFn: UnmarshallTestStruct,
+		LoadKeyMigrate: func(oldKey string) (string, bool) {
+			if strings.HasPrefix(oldKey, "tmp:") {
+				return "", false
+			}
+			return "v2:" + oldKey, true
+		},
+	}
+	ca, err := cache.NewCacheService(cacheCfg, testLogger)
+	require.NoError(t, err)
+	closeOnCleanup(t, ca)
+
+	count := ca.ItemCount()
+	require.Equal(t, 2, count)
+
+	cVal, _ := ca.Get("v2:user:1")
+	require.Equal(t, TestStruct{Name: "John", Age: 34}, cVal)
+	cVal, _ = ca.Get("v2:user:2")
+	require.Equal(t, TestStruct{Name: "Jane", Age: 29}, cVal)
+
+	cVal, _ = ca.Get("user:1")
+	require.Nil(t, cVal)
+	cVal, _ = ca.Get("tmp:1")
+	require.Nil(t, cVal)
+}
+
+func TestReplaceAll(t *testing.T) {
+	dataDir := t.TempDir()
+	testLogger := logger.NewTestAppLogger(dataDir)
+	cacheCfg := cache.CacheConfig{
+		DataDir:   dataDir,
+		MarshalFn: UnmarshallTestStruct,
+	}
+	ca, err := cache.NewCacheService(cacheCfg, testLogger)
+	require.NoError(t, err)
+	closeOnCleanup(t, ca)
+
+	generation := func(prefix string) map[string]interface{} {
+		items := map[string]interface{}{}
+		for i := 0; i < 50; i++ {
+			items[fmt.Sprintf("%s:%d", prefix, i)] = TestStruct{Name: prefix, Age: i}
+		}
+		return items
+	}
+	ca.ReplaceAll(generation("old"), 5*time.Minute)
+	require.Equal(t, 50, ca.ItemCount())
+
+	var wg sync.WaitGroup
+	done := make(chan struct{})
+	mixed := make(chan string, 1)
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-done:
+					return
+				default:
+				}
+				prefixes := map[string]bool{}
+				for k := range ca.Items() {
+					prefixes[strings.Split(k, ":")[0]] = true
+				}
+				if len(prefixes) != 1 {
+					select {
+					case mixed <- fmt.Sprintf("%v", prefixes):
+					default:
+					}
+				}
+			}
+		}()
+	}
+
+	for i := 0; i < 20; i++ {
+		prefix := "old"
+		if i%2 == 0 {
+			prefix = "new"
+		}
+		ca.ReplaceAll(generation(prefix), 5*time.Minute)
+	}
+	close(done)
+	wg.Wait()
+
+	select {
+	case m := <-mixed:
+		t.Fatalf("observed mixed cache contents: %s", m)
+	default:
+	}
+
+	require.Equal(t, true, ca.Updated())
+	require.Equal(t, 50, ca.ItemCount())
+	cVal, _ := ca.Get("old:7")
+	require.Equal(t, TestStruct{Name: "old", Age: 7}, cVal)
+	cVal, _ = ca.Get("new:7")
+	require.Nil(t, cVal)
+}
+
+func TestLoadMerged(t *testing.T) {
+	dataDir := t.TempDir()
+	testLogger := logger.NewTestAppLogger(dataDir)
+
+	now := time.Now()
+	writeShard := func(name string, items map[string]gocache.Item) string {
+		body, err := json.Marshal(items)
+		require.NoError(t, err)
+		filePath := filepath.Join(dataDir, name)
+		err = os.WriteFile(filePath, body, 0644)
+		require.NoError(t, err)
+		return filePath
+	}
+	shardA := writeShard("shard-a.json", map[string]gocache.Item{
+		"only-a":  {Object: TestStruct{Name: "Alice", Age: 30}, Expiration: now.Add(5 * time.Minute).UnixNano()},
+		"shared":  {Object: TestStruct{Name: "Newer", Age: 2}, Expiration: now.Add(10 * time.Minute).UnixNano()},
+		"tie":     {Object: TestStruct{Name: "First", Age: 1}, Expiration: now.Add(5 * time.Minute).Truncate(time.Second).UnixNano()},
+		"forever": {Object: TestStruct{Name: "Forever", Age: 99}, Expiration: 0},
+	})
+	shardB := writeShard("shard-b.json", map[string]gocache.Item{
+		"only-b":  {Object: TestStruct{Name: "Bob", Age: 40}, Expiration: now.Add(5 * time.Minute).UnixNano()},
+		"shared":  {Object: TestStruct{Name: "Older", Age: 1}, Expiration: now.Add(5 * time.Minute).UnixNano()},
+		"tie":     {Object: TestStruct{Name: "Second", Age: 2}, Expiration: now.Add(5 * time.Minute).Truncate(time.Second).UnixNano()},
+		"forever": {Object: TestStruct{Name: "Bounded", Age: 1}, Expiration: now.Add(time.Hour).UnixNano()},
+	})
+
+	cacheCfg := cache.CacheConfig{
+		DataDir:   dataDir,
+		MarshalFn: UnmarshallTestStruct,
+	}
+	ca, err := cache.NewCacheService(cacheCfg, testLogger)
+	require.NoError(t, err)
+	closeOnCleanup(t, ca)
+
+	err = ca.LoadMerged([]string{shardA, shardB})
+	require.NoError(t, err)
+	require.Equal(t, 5, ca.ItemCount())
+
+	cVal, _ := ca.Get("only-a")
+	require.Equal(t, TestStruct{Name: "Alice", Age: 30}, cVal)
+	cVal, _ = ca.Get("only-b")
+	require.Equal(t, TestStruct{Name: "Bob", Age: 40}, cVal)
+	cVal, _ = ca.Get("shared")
+	require.Equal(t, TestStruct{Name: "Newer", Age: 2}, cVal)
+	cVal, _ = ca.Get("tie")
+	require.Equal(t, TestStruct{Name: "Second", Age: 2}, cVal)
+	cVal, _ = ca.Get("forever")
+	require.Equal(t, TestStruct{Name: "Forever", Age: 99}, cVal)
+
+	err = ca.LoadMerged([]string{filepath.Join(dataDir, "missing.json")})
+	require.Error(t, err)
+}
+
+func TestConstructorErrors(t *testing.T) {
+	dataDir := t.TempDir()
+	testLogger := logger.NewTestAppLogger(dataDir)
+	cloudCfg := cache.CacheStorageConfig{
+		Bucket:      "test-bucket",
+		CloudClient: newFakeCloudClient(),
+	}
+
+	constructors := map[string]func(cfg cache.CacheConfig, l logger.AppLogger) error{
+		"local": func(cfg cache.CacheConfig, l logger.AppLogger) error {
+			_, err := cache.NewCacheService(cfg, l)
+			return err
+		},
+		"cloud": func(cfg cache.CacheConfig, l logger.AppLogger) error {
+			_, err := cache.NewWithCloudBackup(cfg, cloudCfg, l)
+			return err
+		},
+	}
+
+	for name, newCache := range constructors {
+		newCache := newCache
+		t.Run(name, func(t *testing.T) {
+			err := newCache(cache.CacheConfig{MarshalFn: UnmarshallTestStruct}, testLogger)
+			require.Equal(t, cache.ErrMissingDataDir, err)
+
+			err = newCache(cache.CacheConfig{DataDir: dataDir, MarshalFn: UnmarshallTestStruct}, nil)
+			require.Equal(t, cache.ErrMissingLogger, err)
+
+			err = newCache(cache.CacheConfig{DataDir: dataDir}, testLogger)
+			require.Equal(t, cache.ErrMissingMarshalFn, err)
+		})
+	}
+}
+
+func TestMaxFileBytes(t *testing.T) {
+	dataDir := t.TempDir()
+	testLogger := logger.NewTestAppLogger(dataDir)
+	cacheCfg := cache.CacheConfig{
+		DataDir:      dataDir,
+		MarshalFn:    UnmarshallTestStruct,
+		MaxFileBytes: 16,
+	}
+	ca, err := cache.NewCacheService(cacheCfg, testLogger)
+	require.NoError(t, err)
+	closeOnCleanup(t, ca)
+
+	err = ca.Set("test", TestStruct{Name: "John", Age: 34}, 5*time.Minute)
+	require.NoError(t, err)
+
+	err = ca.Purge()
+	require.Equal(t, cache.ErrFileTooLarge, err)
+
+	_, err = os.Stat(filepath.Join(dataDir, "cache.json"))
+	require.Equal(t, true, os.IsNotExist(err))
+}
+
+func TestSetNX(t *testing.T) {
+	dataDir := t.TempDir()
+	testLogger := logger.NewTestAppLogger(dataDir)
+	cacheCfg := cache.CacheConfig{
+		DataDir:   dataDir,
+		MarshalFn: UnmarshallTestStruct,
+	}
+	ca, err := cache.NewCacheService(cacheCfg, testLogger)
+	require.NoError(t, err)
+	closeOnCleanup(t, ca)
+
+	set, err := ca.SetNX("test", TestStruct{Name: "John", Age: 34}, 5*time.Minute)
+	require.NoError(t, err)
+	require.Equal(t, true, set)
+
+	set, err = ca.SetNX("test", TestStruct{Name: "Jane", Age: 29}, 5*time.Minute)
+	require.NoError(t, err)
+	require.Equal(t, false, set)
+
+	cVal, _ := ca.Get("test")
+	require.Equal(t, TestStruct{Name: "John", Age: 34}, cVal)
+}
+
+func TestSetOverwritesAndAdd(t *testing.T) {
+	dataDir := t.TempDir()
+	testLogger := logger.NewTestAppLogger(dataDir)
+	cacheCfg := cache.CacheConfig{
+		DataDir:   dataDir,
+		MarshalFn: UnmarshallTestStruct,
+	}
+	ca, err := cache.NewCacheService(cacheCfg, testLogger)
+	require.NoError(t, err)
+	closeOnCleanup(t, ca)
+
+	err = ca.Set("user", TestStruct{Name: "John", Age: 34}, 5*time.Minute)
+	require.NoError(t, err)
+	require.Equal(t, true, ca.Updated())
+	err = ca.Set("user", TestStruct{Name: "Jane", Age: 29}, 10*time.Minute)
+	require.NoError(t, err)
+	cVal, exp := ca.Get("user")
+	require.Equal(t, TestStruct{Name: "Jane", Age: 29}, cVal)
+	require.WithinDuration(t, time.Now().Add(10*time.Minute), exp, time.Second)
+	require.Equal(t, 1, ca.ItemCount())
+
+	err = ca.Add("user", TestStruct{Name: "Jack", Age: 41}, 5*time.Minute)
+	require.Equal(t, cache.ErrKeyExists, err)
+	cVal, _ = ca.Get("user")
+	require.Equal(t, TestStruct{Name: "Jane", Age: 29}, cVal)
+
+	added, err := cache.NewCacheService(cache.CacheConfig{
+		DataDir:       dataDir,
+		CacheFileName: "added",
+		MarshalFn:     UnmarshallTestStruct,
+	}, testLogger)
+	require.NoError(t, err)
+	closeOnCleanup(t, added)
+	require.Equal(t, false, added.Updated())
+	err = added.Add("user", TestStruct{Name: "Jack", Age: 41}, 5*time.Minute)
+	require.NoError(t, err)
+	require.Equal(t, true, added.Updated())
+	cVal, _ = added.Get("user")
+	require.Equal(t, TestStruct{Name: "Jack", Age: 41}, cVal)
+}
+
+func TestConcurrentSetUpdated(t *testing.T) {
+	dataDir := t.TempDir()
+	testLogger := logger.NewTestAppLogger(dataDir)
+	cacheCfg := cache.CacheConfig{
+		DataDir:   dataDir,
+		MarshalFn: UnmarshallTestStruct,
+	}
+	ca, err := cache.NewCacheService(cacheCfg, testLogger)
+	require.NoError(t, err)
+	closeOnCleanup(t, ca)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 16; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 50; j++ {
+				err := ca.Set(fmt.Sprintf("key-%d-%d", i, j), TestStruct{Name: "John", Age: j}, 5*time.Minute)
+				require.NoError(t, err)
+				ca.Updated()
+				ca.Delete(fmt.Sprintf("key-%d-%d", i, j/2))
+			}
+		}(i)
+	}
+	wg.Wait()
+	require.Equal(t, true, ca.Updated())
+}
+
+func TestIncrementFloat(t *testing.T) {
+	dataDir := t.TempDir()
+	testLogger := logger.NewTestAppLogger(dataDir)
+	cacheCfg := cache.CacheConfig{
+		DataDir:   dataDir,
+		MarshalFn: UnmarshallTestStruct,
+	}
+	ca, err := cache.NewCacheService(cacheCfg, testLogger)
+	require.NoError(t, err)
+	closeOnCleanup(t, ca)
+
+	err = ca.Set("gauge", 1.5, 5*time.Minute)
+	require.NoError(t, err)
+	val, err := ca.IncrementFloat("gauge", 2.25)
+	require.NoError(t, err)
+	require.Equal(t, 3.75, val)
+	cVal, _ := ca.Get("gauge")
+	require.Equal(t, 3.75, cVal)
+
+	err = ca.Set("name", "John", 5*time.Minute)
+	require.NoError(t, err)
+	_, err = ca.IncrementFloat("name", 1)
+	require.Error(t, err)
+
+	_, err = ca.IncrementFloat("missing", 1)
+	require.Error(t, err)
+}
+
+func TestIncrementFloatStoredForms(t *testing.T) {
+	for name, cfg := range map[string]cache.CacheConfig{
+		"dedup":      {DedupValues: true},
+		"marshalled": {StoreMarshalled: true},
+	} {
+		t.Run(name, func(t *testing.T) {
+			dataDir := t.TempDir()
+			testLogger := logger.NewTestAppLogger(dataDir)
+			cfg.DataDir = dataDir
+			cfg.MarshalFn = UnmarshallTestStruct
+			ca, err := cache.NewCacheService(cfg, testLogger)
+			require.NoError(t, err)
+			closeOnCleanup(t, ca)
+
+			err = ca.Set("gauge", 1.5, 5*time.Minute)
+			require.NoError(t, err)
+			_, before, _ := ca.Peek("gauge")
+			val, err := ca.IncrementFloat("gauge", 2.25)
+			require.NoError(t, err)
+			require.Equal(t, 3.75, val)
+			val, err = ca.IncrementFloat("gauge", 1)
+			require.NoError(t, err)
+			require.Equal(t, 4.75, val)
+
+			raw, ok := ca.GetRaw("gauge")
+			require.Equal(t, true, ok)
+			require.JSONEq(t, "4.75", string(raw))
+			_, after, _ := ca.Peek("gauge")
+			require.WithinDuration(t, before, after, 50*time.Millisecond)
+
+			err = ca.Set("name", "John", 5*time.Minute)
+			require.NoError(t, err)
+			_, err = ca.IncrementFloat("name", 1)
+			require.Error(t, err)
+		})
+	}
+}
+
+func TestCustomEncoder(t *testing.T) {
+	dataDir := t.TempDir()
+	testLogger := logger.NewTestAppLogger(dataDir)
+	decodes := 0
+	cacheCfg := cache.CacheConfig{
+		DataDir:   dataDir,
+		MarshalFn: UnmarshallTestStruct,
+		NewEncoder: func(w io.Writer) cache.Encoder {
+			enc := json.NewEncoder(w)
+			enc.SetIndent("", "  ")
+			return enc
+		},
+		NewDecoder: func(r io.Reader) cache.Decoder {
+			decodes++
+			return json.NewDecoder(r)
+		},
+	}
+	ca, err := cache.NewCacheService(cacheCfg, testLogger)
+	require.NoError(t, err)
+	closeOnCleanup(t, ca)
+
+	err = ca.Set("test", TestStruct{Name: "John", Age: 34}, 5*time.Minute)
+	require.NoError(t, err)
+	err = ca.Purge()
+	require.NoError(t, err)
+
+	body, err := os.ReadFile(filepath.Join(dataDir, "cache.json"))
+	require.NoError(t, err)
+	require.Equal(t, true, strings.HasPrefix(string(body), "{\n  \"version\": 1,\n  \"count\": 1,\n  \"saved_at\": \""))
+
+	ca, err = cache.NewCacheService(cacheCfg, testLogger)
+	require.NoError(t, err)
+	closeOnCleanup(t, ca)
+	require.Greater(t, decodes, 0)
+	cVal, _ := ca.Get("test")
+	require.Equal(t, TestStruct{Name: "John", Age: 34}, cVal)
+}
+
+type trackingEncoder struct {
+	enc            cache.Encoder
+	inFlight, peak *atomic.Int64
+}
+
+func (e trackingEncoder) Encode(v interface{}) error {
+	n := e.inFlight.Add(1)
+	defer e.inFlight.Add(-1)
+	for {
+		peak := e.peak.Load()
+		if n <= peak || e.peak.CompareAndSwap(peak, n) {
+			break
+		}
+	}
+	time.Sleep(time.Millisecond)
+	return e.enc.Encode(v)
+}
+
+func TestMaxConcurrentFileOps(t *testing.T) {
+	for _, limit := range []int{0, 2} {
+		dataDir := t.TempDir()
+		testLogger := logger.NewTestAppLogger(dataDir)
+		var inFlight, peak atomic.Int64
+		cacheCfg := cache.CacheConfig{
+			DataDir:              dataDir,
+			MarshalFn:            UnmarshallTestStruct,
+			MaxConcurrentFileOps: limit,
+			NewEncoder: func(w io.Writer) cache.Encoder {
+				return trackingEncoder{enc: json.NewEncoder(w), inFlight: &inFlight, peak: &peak}
+			},
+		}
+		ca, err := cache.NewCacheService(cacheCfg, testLogger)
+		require.NoError(t, err)
+		closeOnCleanup(t, ca)
+
+		for i := 0; i < 16; i++ {
+			err = ca.Set(fmt.Sprintf("test-%d", i), TestStruct{Name: "John", Age: i}, 5*time.Minute)
+			require.NoError(t, err)
+		}
+		var wg sync.WaitGroup
+		for i := 0; i < 16; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				err := ca.Purge()
+				require.NoError(t, err)
+			}()
+		}
+		wg.Wait()
+
+		want := int64(limit)
+		if limit == 0 {
+			want = cache.DEFAULT_MAX_CONCURRENT_FILE_OPS
+		}
+		require.LessOrEqual(t, peak.Load(), want)
+
+		err = ca.Purge()
+		require.NoError(t, err)
+		loaded, err := cache.NewCacheService(cacheCfg, testLogger)
+		require.NoError(t, err)
+		closeOnCleanup(t, loaded)
+		require.Equal(t, 16, loaded.ItemCount())
+	}
+}
+
+func TestFallbackToMemory(t *testing.T) {
+	dataDir := filepath.Join(t.TempDir(), "data")
+	testLogger := logger.NewTestAppLogger(t.TempDir())
+	cacheCfg := cache.CacheConfig{
+		DataDir:          dataDir,
+		MarshalFn:        UnmarshallTestStruct,
+		FallbackToMemory: true,
+	}
+	ca, err := cache.NewCacheService(cacheCfg, testLogger)
+	require.NoError(t, err)
+	closeOnCleanup(t, ca)
+
+	err = ca.Set("test", TestStruct{Name: "John", Age: 34}, 5*time.Minute)
+	require.NoError(t, err)
+	err = ca.Purge()
+	require.NoError(t, err)
+
+	// replace the data directory with a file so it can't be recreated
+	err = os.RemoveAll(dataDir)
+	require.NoError(t, err)
+	err = os.WriteFile(dataDir, []byte("unmounted"), 0644)
+	require.NoError(t, err)
+
+	for i := 1; i < cache.PERSIST_FAILURE_LIMIT; i++ {
+		err = ca.Purge()
+		require.Error(t, err)
+		require.Equal(t, false, ca.Degraded())
+	}
+	err = ca.Purge()
+	require.NoError(t, err)
+	require.Equal(t, true, ca.Degraded())
+
+	cVal, _ := ca.Get("test")
+	require.Equal(t, TestStruct{Name: "John", Age: 34}, cVal)
+	err = ca.Set("fresh", TestStruct{Name: "Jane", Age: 29}, 5*time.Minute)
+	require.NoError(t, err)
+	cVal, _ = ca.Get("fresh")
+	require.Equal(t, TestStruct{Name: "Jane", Age: 29}, cVal)
+
+	err = ca.Clear()
+	require.NoError(t, err)
+}
+
+func TestStoreMarshalled(t *testing.T) {
+	dataDir := t.TempDir()
+	testLogger := logger.NewTestAppLogger(dataDir)
+	cacheCfg := cache.CacheConfig{
+		DataDir:         dataDir,
+		MarshalFn:       UnmarshallTestStruct,
+		StoreMarshalled: true,
+	}
+	ca, err := cache.NewCacheService(cacheCfg, testLogger)
+	require.NoError(t, err)
+	closeOnCleanup(t, ca)
+
+	err = ca.Set("test", TestStruct{Name: "John", Age: 34}, 5*time.Minute)
+	require.NoError(t, err)
+	cVal, _ := ca.Get("test")
+	require.Equal(t, TestStruct{Name: "John", Age: 34}, cVal)
+	require.Equal(t, TestStruct{Name: "John", Age: 34}, ca.Items()["test"].Object)
+
+	err = ca.Set("bad", make(chan int), 5*time.Minute)
+	require.Error(t, err)
+
+	err = ca.Clear()
+	require.NoError(t, err)
+
+	cacheCfg.StoreMarshalled = false
+	ca, err = cache.NewCacheService(cacheCfg, testLogger)
+	require.NoError(t, err)
+	closeOnCleanup(t, ca)
+	cVal, _ = ca.Get("test")
+	require.Equal(t, TestStruct{Name: "John", Age: 34}, cVal)
+}
+
+func BenchmarkSaveFile(b *testing.B) {
+	for _, storeMarshalled := range []bool{false, true} {
+		b.Run(fmt.Sprintf("StoreMarshalled=%t", storeMarshalled), func(b *testing.B) {
+			dataDir := b.TempDir()
+			testLogger := logger.NewTestAppLogger(dataDir)
+			cacheCfg := cache.CacheConfig{
+				DataDir:         dataDir,
+				MarshalFn:       UnmarshallTestStruct,
+				StoreMarshalled: storeMarshalled,
+			}
+			ca, err := cache.NewCacheService(cacheCfg, testLogger)
+			require.NoError(b, err)
+			closeOnCleanup(b, ca)
+			for i := 0; i < 10000; i++ {
+				err = ca.Set(fmt.Sprintf("key-%d", i), TestStruct{Name: strings.Repeat("x", 64), Age: i}, 5*time.Minute)
+				require.NoError(b, err)
+			}
+
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				err = ca.Purge()
+				require.NoError(b, err)
+			}
+		})
+	}
+}
+
+func TestKeysMatching(t *testing.T) {
+	dataDir := t.TempDir()
+	testLogger := logger.NewTestAppLogger(dataDir)
+	cacheCfg := cache.CacheConfig{
+		DataDir:   dataDir,
+		MarshalFn: UnmarshallTestStruct,
+	}
+	ca, err := cache.NewCacheService(cacheCfg, testLogger)
+	require.NoError(t, err)
+	closeOnCleanup(t, ca)
+
+	for _, key := range []string{"user:123:profile", "user:123:prefs", "user:456:profile", "session:123"} {
+		err = ca.Set(key, TestStruct{Name: key, Age: 1}, 5*time.Minute)
+		require.NoError(t, err)
+	}
+
+	keys, err := ca.KeysMatching("user:123:*")
+	require.NoError(t, err)
+	require.Equal(t, []string{"user:123:prefs", "user:123:profile"}, keys)
+
+	keys, err = ca.KeysMatching("order:*")
+	require.NoError(t, err)
+	require.Equal(t, 0, len(keys))
+
+	_, err = ca.KeysMatching("user:[")
+	require.Equal(t, cache.ErrInvalidPattern, err)
+	_, err = ca.DeleteMatching("user:[")
+	require.Equal(t, cache.ErrInvalidPattern, err)
+
+	count, err := ca.DeleteMatching("*:profile")
+	require.NoError(t, err)
+	require.Equal(t, 2, count)
+	require.Equal(t, 2, ca.ItemCount())
+	cVal, _ := ca.Get("user:123:profile")
+	require.Nil(t, cVal)
+	cVal, _ = ca.Get("user:123:prefs")
+	require.Equal(t, TestStruct{Name: "user:123:prefs", Age: 1}, cVal)
+}
+
+func TestKeysSkipsExpired(t *testing.T) {
+	dataDir := t.TempDir()
+	testLogger := logger.NewTestAppLogger(dataDir)
+	cacheCfg := cache.CacheConfig{
+		DataDir:                dataDir,
+		MarshalFn:              UnmarshallTestStruct,
+		DefaultCleanupInterval: time.Hour,
+	}
+	ca, err := cache.NewCacheService(cacheCfg, testLogger)
+	require.NoError(t, err)
+	closeOnCleanup(t, ca)
+
+	err = ca.Set("short-1", TestStruct{Name: "John", Age: 1}, 20*time.Millisecond)
+	require.NoError(t, err)
+	err = ca.Set("short-2", TestStruct{Name: "John", Age: 2}, 20*time.Millisecond)
+	require.NoError(t, err)
+	err = ca.Set("long", TestStruct{Name: "John", Age: 3}, 5*time.Minute)
+	require.NoError(t, err)
+	require.Equal(t, []string{"long", "short-1", "short-2"}, ca.Keys())
+
+	time.Sleep(50 * time.Millisecond)
+	// the expired items linger until cleanup but aren't counted or reported as keys
+	require.Equal(t, 1, ca.ItemCount())
+	require.Equal(t, []string{"long"}, ca.Keys())
+	keys, err := ca.KeysMatching("short-*")
+	require.NoError(t, err)
+	require.Equal(t, 0, len(keys))
+}
+
+func TestNewCacheServiceWithLogConfig(t *testing.T) {
+	dataDir := t.TempDir()
+	logFile := filepath.Join(dataDir, "logs", "cache.log")
+	cacheCfg := cache.CacheConfig{
+		DataDir:   dataDir,
+		MarshalFn: UnmarshallTestStruct,
+	}
+
+	_, err := cache.NewCacheServiceWithLogConfig(cacheCfg, cache.LogConfig{Level: "loud", FilePath: logFile})
+	require.Equal(t, cache.ErrInvalidLogLevel, err)
+
+	ca, err := cache.NewCacheServiceWithLogConfig(cacheCfg, cache.LogConfig{Level: "error", FilePath: logFile})
+	require.NoError(t, err)
+	closeOnCleanup(t, ca)
+
+	err = ca.Set("test", TestStruct{Name: "John", Age: 34}, 5*time.Minute)
+	require.NoError(t, err)
+	cVal, _ := ca.Get("test")
+	require.Equal(t, TestStruct{Name: "John", Age: 34}, cVal)
+
+	body, err := os.ReadFile(logFile)
+	require.NoError(t, err)
+	require.Equal(t, true, strings.Contains(string(body), "error no cache file"))
+	require.Equal(t, false, strings.Contains(string(body), "loading cache file"))
+}
+
+func TestLoadNewerFileVersion(t *testing.T) {
+	dataDir := t.TempDir()
+	testLogger := logger.NewTestAppLogger(dataDir)
+
+	exp := time.Now().Add(5 * time.Minute).UnixNano()
+	body, err := json.Marshal(map[string]interface{}{
+		"version":  999,
+		"checksum": "future-field",
+		"items": map[string]gocache.Item{
+			"test": {Object: TestStruct{Name: "John", Age: 34}, Expiration: exp},
+		},
+	})
+	require.NoError(t, err)
+	err = os.WriteFile(filepath.Join(dataDir, "cache.json"), body, 0644)
+	require.NoError(t, err)
+
+	cacheCfg := cache.CacheConfig{
+		DataDir:   dataDir,
+		MarshalFn: UnmarshallTestStruct,
+	}
+	ca, err := cache.NewCacheService(cacheCfg, testLogger)
+	require.NoError(t, err)
+	closeOnCleanup(t, ca)
+	cVal, _ := ca.Get("test")
+	require.Equal(t, TestStruct{Name: "John", Age: 34}, cVal)
+
+	incompatible := filepath.Join(dataDir, "incompatible.json")
+	err = os.WriteFile(incompatible, []byte(`{"version":999,"items":[{"key":"test","value":{"Name":"John"}}]}`), 0644)
+	require.NoError(t, err)
+	err = ca.LoadMerged([]string{incompatible})
+	require.Equal(t, cache.ErrUnsupportedVersion, err)
+}
+
+func TestLoadUnopenableCacheFile(t *testing.T) {
+	dataDir := t.TempDir()
+	core, logs := observer.New(zapcore.InfoLevel)
+
+	// a socket where the cache file should be stats fine but can't be opened, even as root
+	l, err := net.Listen("unix", filepath.Join(dataDir, "cache.json"))
+	require.NoError(t, err)
+	defer l.Close()
+
+	cacheCfg := cache.CacheConfig{
+		DataDir:   dataDir,
+		MarshalFn: UnmarshallTestStruct,
+	}
+	require.NotPanics(t, func() {
+		ca, err := cache.NewCacheService(cacheCfg, zap.New(core))
+		require.NoError(t, err)
+		closeOnCleanup(t, ca)
+		require.Equal(t, 0, ca.ItemCount())
+	})
+
+	fresh := logs.FilterMessage("starting with fresh cache").All()
+	require.Equal(t, 1, len(fresh))
+	require.Contains(t, fresh[0].ContextMap()["error"], cache.ERROR_OPENING_CACHE_FILE)
+}
+
+func TestExpiringBefore(t *testing.T) {
+	dataDir := t.TempDir()
+	testLogger := logger.NewTestAppLogger(dataDir)
+	cacheCfg := cache.CacheConfig{
+		DataDir:   dataDir,
+		MarshalFn: UnmarshallTestStruct,
+	}
+	ca, err := cache.NewCacheService(cacheCfg, testLogger)
+	require.NoError(t, err)
+	closeOnCleanup(t, ca)
+
+	ttls := map[string]time.Duration{
+		"one":     time.Minute,
+		"two":     2 * time.Minute,
+		"ten":     10 * time.Minute,
+		"hour":    time.Hour,
+		"forever": cache.NO_EXPIRATION,
+	}
+	for key, d := range ttls {
+		err = ca.Set(key, TestStruct{Name: key, Age: 1}, d)
+		require.NoError(t, err)
+	}
+
+	now := time.Now()
+	require.Equal(t, 0, ca.ExpiringBefore(now))
+	require.Equal(t, 2, ca.ExpiringBefore(now.Add(5*time.Minute)))
+	require.Equal(t, 3, ca.ExpiringBefore(now.Add(30*time.Minute)))
+	require.Equal(t, 4, ca.ExpiringBefore(now.Add(24*time.Hour)))
+}
+
+func TestFileExpiresAt(t *testing.T) {
+	for _, storeMarshalled := range []bool{false, true} {
+		t.Run(fmt.Sprintf("StoreMarshalled=%t", storeMarshalled), func(t *testing.T) {
+			dataDir := t.TempDir()
+			testLogger := logger.NewTestAppLogger(dataDir)
+			cacheCfg := cache.CacheConfig{
+				DataDir:         dataDir,
+				MarshalFn:       UnmarshallTestStruct,
+				StoreMarshalled: storeMarshalled,
+			}
+			ca, err := cache.NewCacheService(cacheCfg, testLogger)
+			require.NoError(t, err)
+			closeOnCleanup(t, ca)
+
+			err = ca.Set("expiring", TestStruct{Name: "John", Age: 34}, 5*time.Minute)
+			require.NoError(t, err)
+			err = ca.Set("forever", TestStruct{Name: "Jane", Age: 29}, gocache.NoExpiration)
+			require.NoError(t, err)
+			err = ca.Clear()
+			require.NoError(t, err)
+
+			body, err := os.ReadFile(filepath.Join(dataDir, "cache.json"))
+			require.NoError(t, err)
+			var f struct {
+				Items map[string]struct {
+					Expiration int64
+					ExpiresAt  string `json:"expires_at"`
+				} `json:"items"`
+			}
+			err = json.Unmarshal(body, &f)
+			require.NoError(t, err)
+
+			item := f.Items["expiring"]
+			expiresAt, err := time.Parse(time.RFC3339Nano, item.ExpiresAt)
+			require.NoError(t, err)
+			require.Equal(t, item.Expiration, expiresAt.UnixNano())
+			require.Equal(t, "", f.Items["forever"].ExpiresAt)
+
+			ca, err = cache.NewCacheService(cacheCfg, testLogger)
+			require.NoError(t, err)
+			closeOnCleanup(t, ca)
+			cVal, _ := ca.Get("expiring")
+			require.Equal(t, TestStruct{Name: "John", Age: 34}, cVal)
+		})
+	}
+}
+
+func TestReset(t *testing.T) {
+	dataDir := t.TempDir()
+	testLogger := logger.NewTestAppLogger(dataDir)
+	cacheCfg := cache.CacheConfig{
+		DataDir:   dataDir,
+		MarshalFn: UnmarshallTestStruct,
+	}
+	ca, err := cache.NewCacheService(cacheCfg, testLogger)
+	require.NoError(t, err)
+	closeOnCleanup(t, ca)
+
+	err = ca.Set("test", TestStruct{Name: "John", Age: 34}, 5*time.Minute)
+	require.NoError(t, err)
+	err = ca.Purge()
+	require.NoError(t, err)
+	filePath := filepath.Join(dataDir, "cache.json")
+	_, err = os.Stat(filePath)
+	require.NoError(t, err)
+
+	err = ca.Set("other", TestStruct{Name: "Jane", Age: 29}, 5*time.Minute)
+	require.NoError(t, err)
+	require.Equal(t, true, ca.Updated())
+
+	err = ca.Reset(false)
+	require.NoError(t, err)
+	require.Equal(t, 0, ca.ItemCount())
+	require.Equal(t, false, ca.Updated())
+	_, err = os.Stat(filePath)
+	require.NoError(t, err)
+
+	err = ca.Set("test", TestStruct{Name: "John", Age: 34}, 5*time.Minute)
+	require.NoError(t, err)
+	cVal, _ := ca.Get("test")
+	require.Equal(t, TestStruct{Name: "John", Age: 34}, cVal)
+
+	err = ca.Reset(true)
+	require.NoError(t, err)
+	require.Equal(t, 0, ca.ItemCount())
+	require.Equal(t, false, ca.Updated())
+	_, err = os.Stat(filePath)
+	require.Equal(t, true, os.IsNotExist(err))
+
+	err = ca.Reset(true)
+	require.NoError(t, err)
+}
+
+func TestSkipUnencodableItems(t *testing.T) {
+	dataDir := t.TempDir()
+	testLogger := logger.NewTestAppLogger(dataDir)
+	cacheCfg := cache.CacheConfig{
+		DataDir:   dataDir,
+		MarshalFn: UnmarshallTestStruct,
+	}
+	ca, err := cache.NewCacheService(cacheCfg, testLogger)
+	require.NoError(t, err)
+	closeOnCleanup(t, ca)
+
+	err = ca.Set("john", TestStruct{Name: "John", Age: 34}, 5*time.Minute)
+	require.NoError(t, err)
+	err = ca.Set("jane", TestStruct{Name: "Jane", Age: 29}, 5*time.Minute)
+	require.NoError(t, err)
+	err = ca.Set("chan", make(chan int), 5*time.Minute)
+	require.NoError(t, err)
+	err = ca.Purge()
+	require.NoError(t, err)
+
+	summary, err := cache.InspectFile(filepath.Join(dataDir, "cache.json"))
+	require.NoError(t, err)
+	require.Equal(t, 2, summary.Count)
+
+	loaded, err := cache.NewCacheService(cacheCfg, testLogger)
+	require.NoError(t, err)
+	closeOnCleanup(t, loaded)
+	require.Equal(t, 2, loaded.ItemCount())
+	cVal, _ := loaded.Get("jane")
+	require.Equal(t, TestStruct{Name: "Jane", Age: 29}, cVal)
+
+	cacheCfg.StrictEncoding = true
+	strict, err := cache.NewCacheService(cacheCfg, testLogger)
+	require.NoError(t, err)
+	closeOnCleanup(t, strict)
+	err = strict.Set("chan", make(chan int), 5*time.Minute)
+	require.NoError(t, err)
+	err = strict.Purge()
+	require.Error(t, err)
+}
+
+func TestGetWithFound(t *testing.T) {
+	dataDir := t.TempDir()
+	testLogger := logger.NewTestAppLogger(dataDir)
+	cacheCfg := cache.CacheConfig{
+		DataDir:   dataDir,
+		MarshalFn: UnmarshallTestStruct,
+	}
+	ca, err := cache.NewCacheService(cacheCfg, testLogger)
+	require.NoError(t, err)
+	closeOnCleanup(t, ca)
+
+	err = ca.Set("john", TestStruct{Name: "John", Age: 34}, 5*time.Minute)
+	require.NoError(t, err)
+	err = ca.Set("nothing", nil, 5*time.Minute)
+	require.NoError(t, err)
+
+	cVal, exp, found := ca.GetWithFound("john")
+	require.True(t, found)
+	require.Equal(t, TestStruct{Name: "John", Age: 34}, cVal)
+	require.WithinDuration(t, time.Now().Add(5*time.Minute), exp, time.Second)
+
+	cVal, exp, found = ca.GetWithFound("nothing")
+	require.True(t, found)
+	require.Nil(t, cVal)
+	require.False(t, exp.IsZero())
+
+	cVal, _, found = ca.GetWithFound("missing")
+	require.False(t, found)
+	require.Nil(t, cVal)
+
+	// Get can't tell the two apart
+	cVal, _ = ca.Get("nothing")
+	require.Nil(t, cVal)
+	cVal, _ = ca.Get("missing")
+	require.Nil(t, cVal)
+}
+
+func TestGetTyped(t *testing.T) {
+	dataDir := t.TempDir()
+	testLogger := logger.NewTestAppLogger(dataDir)
+	cacheCfg := cache.CacheConfig{
+		DataDir:   dataDir,
+		MarshalFn: UnmarshallTestStruct,
+	}
+	ca, err := cache.NewCacheService(cacheCfg, testLogger)
+	require.NoError(t, err)
+	closeOnCleanup(t, ca)
+
+	err = ca.Set("john", TestStruct{Name: "John", Age: 34}, 5*time.Minute)
+	require.NoError(t, err)
+	err = ca.Set("jane", map[string]interface{}{"name": "Jane", "age": 29}, 5*time.Minute)
+	require.NoError(t, err)
+
+	before := map[string]interface{}{}
+	for _, k := range []string{"john", "jane"} {
+		val, exp, ok := ca.GetTyped(k)
+		require.Equal(t, true, ok)
+		require.Equal(t, false, exp.IsZero())
+		before[k] = val
+	}
+	require.Equal(t, TestStruct{Name: "John", Age: 34}, before["john"])
+	require.Equal(t, TestStruct{Name: "Jane", Age: 29}, before["jane"])
+
+	_, _, ok := ca.GetTyped("missing")
+	require.Equal(t, false, ok)
+
+	err = ca.Purge()
+	require.NoError(t, err)
+	loaded, err := cache.NewCacheService(cacheCfg, testLogger)
+	require.NoError(t, err)
+	closeOnCleanup(t, loaded)
+	for k, want := range before {
+		val, _, ok := loaded.GetTyped(k)
+		require.Equal(t, true, ok)
+		require.Equal(t, reflect.TypeOf(want), reflect.TypeOf(val))
+		require.Equal(t, want, val)
+	}
+}
+
+func TestGetRaw(t *testing.T) {
+	for _, storeMarshalled := range []bool{false, true} {
+		dataDir := t.TempDir()
+		testLogger := logger.NewTestAppLogger(dataDir)
+		cacheCfg := cache.CacheConfig{
+			DataDir:         dataDir,
+			MarshalFn:       UnmarshallTestStruct,
+			StoreMarshalled: storeMarshalled,
+		}
+		ca, err := cache.NewCacheService(cacheCfg, testLogger)
+		require.NoError(t, err)
+		closeOnCleanup(t, ca)
+
+		ts := TestStruct{Name: "John", Age: 34}
+		err = ca.Set("test", ts, 5*time.Minute)
+		require.NoError(t, err)
+
+		want, err := json.Marshal(ts)
+		require.NoError(t, err)
+		raw, ok := ca.GetRaw("test")
+		require.Equal(t, true, ok)
+		require.JSONEq(t, string(want), string(raw))
+
+		_, ok = ca.GetRaw("missing")
+		require.Equal(t, false, ok)
+	}
+}
+
+func TestUpdate(t *testing.T) {
+	dataDir := t.TempDir()
+	testLogger := logger.NewTestAppLogger(dataDir)
+	cacheCfg := cache.CacheConfig{
+		DataDir:   dataDir,
+		MarshalFn: UnmarshallTestStruct,
+	}
+	ca, err := cache.NewCacheService(cacheCfg, testLogger)
+	require.NoError(t, err)
+	closeOnCleanup(t, ca)
+
+	err = ca.Set("test", TestStruct{Name: "John", Age: 34}, 5*time.Minute)
+	require.NoError(t, err)
+	_, before, ok := ca.Peek("test")
+	require.Equal(t, true, ok)
+
+	time.Sleep(20 * time.Millisecond)
+	err = ca.Update("test", TestStruct{Name: "John", Age: 35})
+	require.NoError(t, err)
+	cVal, after, ok := ca.Peek("test")
+	require.Equal(t, true, ok)
+	require.Equal(t, TestStruct{Name: "John", Age: 35}, cVal)
+	require.WithinDuration(t, before, after, 5*time.Millisecond)
+
+	err = ca.Set("forever", TestStruct{Name: "Jane", Age: 29}, cache.NO_EXPIRATION)
+	require.NoError(t, err)
+	err = ca.Update("forever", TestStruct{Name: "Jane", Age: 30})
+	require.NoError(t, err)
+	_, exp, _ := ca.Peek("forever")
+	require.Equal(t, true, exp.IsZero())
+
+	err = ca.Update("missing", TestStruct{Name: "Jack", Age: 40})
+	require.Equal(t, cache.ErrKeyNotFound, err)
+}
+
+func TestSetUntil(t *testing.T) {
+	dataDir := t.TempDir()
+	testLogger := logger.NewTestAppLogger(dataDir)
+	// the clock runs a day behind, expirations follow it rather than time.Now
+	clock := func() time.Time {
+		return time.Now().Add(-24 * time.Hour)
+	}
+	cacheCfg := cache.CacheConfig{
+		DataDir:                dataDir,
+		MarshalFn:              UnmarshallTestStruct,
+		DefaultCleanupInterval: time.Hour,
+		Clock:                  clock,
+	}
+	ca, err := cache.NewCacheService(cacheCfg, testLogger)
+	require.NoError(t, err)
+	closeOnCleanup(t, ca)
+
+	expireAt := clock().Add(100 * time.Millisecond)
+	err = ca.SetUntil("john", TestStruct{Name: "John", Age: 34}, expireAt)
+	require.NoError(t, err)
+	cVal, exp := ca.Get("john")
+	require.Equal(t, TestStruct{Name: "John", Age: 34}, cVal)
+	require.WithinDuration(t, expireAt.Add(24*time.Hour), exp, 20*time.Millisecond)
+
+	time.Sleep(150 * time.Millisecond)
+	cVal, _ = ca.Get("john")
+	require.Nil(t, cVal)
+
+	err = ca.SetUntil("jane", TestStruct{Name: "Jane", Age: 29}, clock().Add(-time.Minute))
+	require.Equal(t, cache.ErrExpireAtInPast, err)
+	_, _, ok := ca.Peek("jane")
+	require.False(t, ok)
+}
+
+func TestSetUntilSkipsJitter(t *testing.T) {
+	dataDir := t.TempDir()
+	testLogger := logger.NewTestAppLogger(dataDir)
+	cacheCfg := cache.CacheConfig{
+		DataDir:          dataDir,
+		MarshalFn:        UnmarshallTestStruct,
+		ExpirationJitter: time.Hour,
+	}
+	ca, err := cache.NewCacheService(cacheCfg, testLogger)
+	require.NoError(t, err)
+	closeOnCleanup(t, ca)
+
+	expireAt := time.Now().Add(time.Minute)
+	for i := 0; i < 10; i++ {
+		key := fmt.Sprintf("key-%d", i)
+		err = ca.SetUntil(key, TestStruct{Name: "John", Age: 34}, expireAt)
+		require.NoError(t, err)
+		_, exp, ok := ca.Peek(key)
+		require.True(t, ok)
+		// only the time the set takes separates them, no jitter is added
+		require.WithinDuration(t, expireAt, exp, 10*time.Millisecond, key)
+	}
+}
+
+func TestValidateFn(t *testing.T) {
+	dataDir := t.TempDir()
+	testLogger := logger.NewTestAppLogger(dataDir)
+	cacheCfg := cache.CacheConfig{
+		DataDir:   dataDir,
+		MarshalFn: UnmarshallTestStruct,
+	}
+	ca, err := cache.NewCacheService(cacheCfg, testLogger)
+	require.NoError(t, err)
+	closeOnCleanup(t, ca)
+
+	err = ca.Set("valid", TestStruct{Name: "John", Age: 34}, 5*time.Minute)
+	require.NoError(t, err)
+	err = ca.Set("too-old", TestStruct{Name: "Methuselah", Age: 969}, 5*time.Minute)
+	require.NoError(t, err)
+	err = ca.Set("negative", TestStruct{Name: "Unborn", Age: -1}, 5*time.Minute)
+	require.NoError(t, err)
+	err = ca.Clear()
+	require.NoError(t, err)
+
+	cacheCfg.ValidateFn = func(key string, value interface{}) error {
+		ts, ok := value.(TestStruct)
+		if !ok {
+			return fmt.Errorf("unexpected value type %T", value)
+		}
+		if ts.Age < 0 || ts.Age > 150 {
+			return fmt.Errorf("age %d out of range", ts.Age)
+		}
+		return nil
+	}
+	ca, err = cache.NewCacheService(cacheCfg, testLogger)
+	require.NoError(t, err)
+	closeOnCleanup(t, ca)
+	require.Equal(t, 1, ca.ItemCount())
+	cVal, _ := ca.Get("valid")
+	require.Equal(t, TestStruct{Name: "John", Age: 34}, cVal)
+	cVal, _ = ca.Get("too-old")
+	require.Nil(t, cVal)
+
+	cacheCfg.StrictValidation = true
+	ca, err = cache.NewCacheService(cacheCfg, testLogger)
+	require.NoError(t, err)
+	closeOnCleanup(t, ca)
+	require.Equal(t, 0, ca.ItemCount())
+
+	err = ca.LoadMerged([]string{filepath.Join(dataDir, "cache.json")})
+	require.Error(t, err)
+	require.Equal(t, 0, ca.ItemCount())
+}
+
+func TestPreviewPersist(t *testing.T) {
+	dataDir := t.TempDir()
+	testLogger := logger.NewTestAppLogger(dataDir)
+	cacheCfg := cache.CacheConfig{
+		DataDir:   dataDir,
+		MarshalFn: UnmarshallTestStruct,
+	}
+	ca, err := cache.NewCacheService(cacheCfg, testLogger)
+	require.NoError(t, err)
+	closeOnCleanup(t, ca)
+
+	err = ca.Set("john", TestStruct{Name: "John", Age: 34}, 5*time.Minute)
+	require.NoError(t, err)
+	err = ca.Set("jane", TestStruct{Name: "Jane", Age: 29}, 5*time.Minute)
+	require.NoError(t, err)
+	err = ca.Set("chan", make(chan int), 5*time.Minute)
+	require.NoError(t, err)
+
+	preview, err := ca.PreviewPersist()
+	require.NoError(t, err)
+	require.Equal(t, 2, preview.ItemCount)
+	require.Equal(t, []string{"jane", "john"}, preview.Keys)
+	require.Equal(t, 3, ca.ItemCount())
+	filePath := filepath.Join(dataDir, "cache.json")
+	_, err = os.Stat(filePath)
+	require.Equal(t, true, os.IsNotExist(err))
+
+	err = ca.Purge()
+	require.NoError(t, err)
+	fStats, err := os.Stat(filePath)
+	require.NoError(t, err)
+	// saved_at drops trailing zero nanoseconds, so the sizes can differ by a few bytes
+	require.InDelta(t, fStats.Size(), preview.Bytes, 10)
+	summary, err := cache.InspectFile(filePath)
+	require.NoError(t, err)
+	require.Equal(t, preview.ItemCount, summary.Count)
+}
+
+func TestInspectFile(t *testing.T) {
+	dataDir := t.TempDir()
+	testLogger := logger.NewTestAppLogger(dataDir)
+	cacheCfg := cache.CacheConfig{
+		DataDir:   dataDir,
+		MarshalFn: UnmarshallTestStruct,
+	}
+	ca, err := cache.NewCacheService(cacheCfg, testLogger)
+	require.NoError(t, err)
+	closeOnCleanup(t, ca)
+
+	err = ca.Set("first", TestStruct{Name: "John", Age: 34}, 5*time.Minute)
+	require.NoError(t, err)
+	err = ca.Set("second", TestStruct{Name: "Jane", Age: 29}, 5*time.Minute)
+	require.NoError(t, err)
+	err = ca.Clear()
+	require.NoError(t, err)
+
+	filePath := filepath.Join(dataDir, "cache.json")
+	body, err := os.ReadFile(filePath)
+	require.NoError(t, err)
+	var header struct {
+		Version int       `json:"version"`
+		Count   int       `json:"count"`
+		SavedAt time.Time `json:"saved_at"`
+	}
+	err = json.Unmarshal(body, &header)
+	require.NoError(t, err)
+	require.Equal(t, cache.CACHE_FILE_VERSION, header.Version)
+	require.Equal(t, 2, header.Count)
+	require.WithinDuration(t, time.Now(), header.SavedAt, time.Minute)
+
+	summary, err := cache.InspectFile(filePath)
+	require.NoError(t, err)
+	require.Equal(t, true, summary.FromHeader)
+	require.Equal(t, cache.CACHE_FILE_VERSION, summary.Version)
+	require.Equal(t, 2, summary.Count)
+	require.Equal(t, true, header.SavedAt.Equal(summary.SavedAt))
+
+	exp := time.Now().Add(5 * time.Minute).UnixNano()
+	legacy, err := json.Marshal(map[string]gocache.Item{
+		"first":  {Object: TestStruct{Name: "John", Age: 34}, Expiration: exp},
+		"second": {Object: TestStruct{Name: "Jane", Age: 29}, Expiration: exp},
+		"third":  {Object: TestStruct{Name: "Jack", Age: 41}, Expiration: exp},
+	})
+	require.NoError(t, err)
+	legacyPath := filepath.Join(dataDir, "legacy.json")
+	err = os.WriteFile(legacyPath, legacy, 0644)
+	require.NoError(t, err)
+
+	summary, err = cache.InspectFile(legacyPath)
+	require.NoError(t, err)
+	require.Equal(t, false, summary.FromHeader)
+	require.Equal(t, 0, summary.Version)
+	require.Equal(t, 3, summary.Count)
+	require.WithinDuration(t, time.Now(), summary.SavedAt, time.Minute)
+
+	_, err = cache.InspectFile(filepath.Join(dataDir, "missing.json"))
+	require.Error(t, err)
+}
+
+func TestExpirationJitter(t *testing.T) {
+	dataDir := t.TempDir()
+	testLogger := logger.NewTestAppLogger(dataDir)
+
+	offsets := func(seed int64) []time.Duration {
+		cacheCfg := cache.CacheConfig{
+			DataDir:          dataDir,
+			MarshalFn:        UnmarshallTestStruct,
+			ExpirationJitter: time.Hour,
+			RandSource:       rand.NewSource(seed),
+		}
+		ca, err := cache.NewCacheService(cacheCfg, testLogger)
+		require.NoError(t, err)
+		closeOnCleanup(t, ca)
+
+		offsets := []time.Duration{}
+		for i := 0; i < 5; i++ {
+			key := fmt.Sprintf("key-%d", i)
+			start := time.Now()
+			err = ca.Set(key, TestStruct{Name: "John", Age: i}, 5*time.Minute)
+			require.NoError(t, err)
+			_, exp, ok := ca.Peek(key)
+			require.Equal(t, true, ok)
+			offset := exp.Sub(start.Add(5 * time.Minute))
+			require.GreaterOrEqual(t, offset, time.Duration(0))
+			require.Less(t, offset, time.Hour+time.Second)
+			offsets = append(offsets, offset)
+		}
+
+		_, exp, ok := ca.Peek("missing")
+		require.Equal(t, false, ok)
+		require.Equal(t, true, exp.IsZero())
+		err = ca.Set("forever", TestStruct{Name: "Jane", Age: 29}, gocache.NoExpiration)
+		require.NoError(t, err)
+		_, exp, _ = ca.Peek("forever")
+		require.Equal(t, true, exp.IsZero())
+		return offsets
+	}
+
+	first, second := offsets(42), offsets(42)
+	for i := range first {
+		require.InDelta(t, float64(first[i]), float64(second[i]), float64(time.Second))
+	}
+	require.NotEqual(t, first[0].Round(time.Second), first[1].Round(time.Second))
+}
+
+func TestResolvedDefaults(t *testing.T) {
+	dataDir := t.TempDir()
+	testLogger := logger.NewTestAppLogger(dataDir)
+	cacheCfg := cache.CacheConfig{
+		DataDir:   dataDir,
+		MarshalFn: UnmarshallTestStruct,
+	}
+	ca, err := cache.NewCacheService(cacheCfg, testLogger)
+	require.NoError(t, err)
+	closeOnCleanup(t, ca)
+	require.Equal(t, 5*time.Minute, ca.DefaultExpiration())
+	require.Equal(t, 10*time.Minute, ca.CleanupInterval())
+
+	cacheCfg.DefaultExpiration = time.Hour
+	cacheCfg.DefaultCleanupInterval = 2 * time.Hour
+	ca, err = cache.NewCacheService(cacheCfg, testLogger)
+	require.NoError(t, err)
+	closeOnCleanup(t, ca)
+	require.Equal(t, time.Hour, ca.DefaultExpiration())
+	require.Equal(t, 2*time.Hour, ca.CleanupInterval())
+}
+
+func TestGetWithReason(t *testing.T) {
+	dataDir := t.TempDir()
+	testLogger := logger.NewTestAppLogger(dataDir)
+	cacheCfg := cache.CacheConfig{
+		DataDir:   dataDir,
+		MarshalFn: UnmarshallTestStruct,
+	}
+	ca, err := cache.NewCacheService(cacheCfg, testLogger)
+	require.NoError(t, err)
+	closeOnCleanup(t, ca)
+
+	err = ca.Set("hit", TestStruct{Name: "John", Age: 34}, 5*time.Minute)
+	require.NoError(t, err)
+	err = ca.Set("expiring", TestStruct{Name: "Jane", Age: 29}, 50*time.Millisecond)
+	require.NoError(t, err)
+
+	cVal, reason := ca.GetWithReason("hit")
+	require.Equal(t, cache.Hit, reason)
+	require.Equal(t, TestStruct{Name: "John", Age: 34}, cVal)
+
+	cVal, reason = ca.GetWithReason("never-set")
+	require.Equal(t, cache.Missing, reason)
+	require.Nil(t, cVal)
+
+	time.Sleep(100 * time.Millisecond)
+	cVal, reason = ca.GetWithReason("expiring")
+	require.Equal(t, cache.Expired, reason)
+	require.Nil(t, cVal)
+	require.Equal(t, "expired", reason.String())
+
+	// reading doesn't remove it, it's reported as expired until the janitor does
+	_, reason = ca.GetWithReason("expiring")
+	require.Equal(t, cache.Expired, reason)
+	ca.DeleteExpired()
+	_, reason = ca.GetWithReason("expiring")
+	require.Equal(t, cache.Missing, reason)
+
+	// a deleted item is missing, expiration or not
+	err = ca.Set("deleted", TestStruct{Name: "Jack", Age: 41}, 50*time.Millisecond)
+	require.NoError(t, err)
+	ca.Delete("deleted")
+	time.Sleep(100 * time.Millisecond)
+	_, reason = ca.GetWithReason("deleted")
+	require.Equal(t, cache.Missing, reason)
+}
+
+func TestExportCSV(t *testing.T) {
+	dataDir := t.TempDir()
+	testLogger := logger.NewTestAppLogger(dataDir)
+	cacheCfg := cache.CacheConfig{
+		DataDir:   dataDir,
+		MarshalFn: UnmarshallTestStruct,
+	}
+	ca, err := cache.NewCacheService(cacheCfg, testLogger)
+	require.NoError(t, err)
+	closeOnCleanup(t, ca)
+
+	err = ca.Set("b", TestStruct{Name: "Doe, Jane", Age: 29}, 5*time.Minute)
+	require.NoError(t, err)
+	err = ca.Set("a", TestStruct{Name: `John "JJ" Smith`, Age: 34}, 5*time.Minute)
+	require.NoError(t, err)
+
+	columns := func(key string, value interface{}) []string {
+		if value == nil {
+			return []string{"name", "age"}
+		}
+		ts := value.(TestStruct)
+		return []string{ts.Name, fmt.Sprint(ts.Age)}
+	}
+	var buf bytes.Buffer
+	err = ca.ExportCSV(&buf, columns)
+	require.NoError(t, err)
+	require.Equal(t, "key,name,age\na,\"John \"\"JJ\"\" Smith\",34\nb,\"Doe, Jane\",29\n", buf.String())
+
+	err = ca.ExportCSV(failingWriter{}, columns)
+	require.Error(t, err)
+}
+
+type failingWriter struct{}
+
+func (failingWriter) Write(p []byte) (int, error) {
+	return 0, fmt.Errorf("write failed")
+}
+
+func TestDiffFiles(t *testing.T) {
+	dataDir := t.TempDir()
+	exp := time.Now().Add(5 * time.Minute).UnixNano()
+
+	a, err := json.Marshal(map[string]gocache.Item{
+		"same":        {Object: TestStruct{Name: "John", Age: 34}, Expiration: exp},
+		"only-a":      {Object: TestStruct{Name: "Jane", Age: 29}, Expiration: exp},
+		"value":       {Object: TestStruct{Name: "Jack", Age: 41}, Expiration: exp},
+		"expiration":  {Object: TestStruct{Name: "Jill", Age: 38}, Expiration: exp},
+		"both-differ": {Object: TestStruct{Name: "Joe", Age: 50}, Expiration: exp},
+	})
+	require.NoError(t, err)
+	b, err := json.Marshal(map[string]interface{}{
+		"version": 1,
+		"items": map[string]gocache.Item{
+			"same":        {Object: TestStruct{Name: "John", Age: 34}, Expiration: exp},
+			"only-b":      {Object: TestStruct{Name: "Jim", Age: 22}, Expiration: exp},
+			"value":       {Object: TestStruct{Name: "Jack", Age: 42}, Expiration: exp},
+			"expiration":  {Object: TestStruct{Name: "Jill", Age: 38}, Expiration: exp + 1},
+			"both-differ": {Object: TestStruct{Name: "Joe", Age: 51}, Expiration: 0},
+		},
+	})
+	require.NoError(t, err)
+
+	pathA, pathB := filepath.Join(dataDir, "a.json"), filepath.Join(dataDir, "b.json")
+	require.NoError(t, os.WriteFile(pathA, a, 0644))
+	require.NoError(t, os.WriteFile(pathB, b, 0644))
+
+	diff, err := cache.DiffFiles(pathA, pathB)
+	require.NoError(t, err)
+	require.Equal(t, cache.Diff{
+		OnlyInA:           []string{"only-a"},
+		OnlyInB:           []string{"only-b"},
+		ValueDiffers:      []string{"both-differ", "value"},
+		ExpirationDiffers: []string{"both-differ", "expiration"},
+	}, diff)
+
+	diff, err = cache.DiffFiles(pathA, pathA)
+	require.NoError(t, err)
+	require.Equal(t, 0, len(diff.OnlyInA)+len(diff.OnlyInB)+len(diff.ValueDiffers)+len(diff.ExpirationDiffers))
+
+	_, err = cache.DiffFiles(pathA, filepath.Join(dataDir, "missing.json"))
+	require.Error(t, err)
+}
+
+func TestLazyItems(t *testing.T) {
+	dataDir := t.TempDir()
+	testLogger := logger.NewTestAppLogger(dataDir)
+	var decodes atomic.Int64
+	cacheCfg := cache.CacheConfig{
+		DataDir: dataDir,
+		MarshalFn: func(p interface{}) (interface{}, error) {
+			decodes.Add(1)
+			return UnmarshallTestStruct(p)
+		},
+		StoreMarshalled: true,
+	}
+	ca, err := cache.NewCacheService(cacheCfg, testLogger)
+	require.NoError(t, err)
+	closeOnCleanup(t, ca)
+
+	for i := 0; i < 10; i++ {
+		err = ca.Set(fmt.Sprintf("key-%d", i), TestStruct{Name: "John", Age: i}, 5*time.Minute)
+		require.NoError(t, err)
+	}
+
+	items := ca.LazyItems()
+	require.Equal(t, 10, len(items))
+	require.Equal(t, int64(0), decodes.Load())
+
+	val, err := items["key-3"]()
+	require.NoError(t, err)
+	require.Equal(t, TestStruct{Name: "John", Age: 3}, val)
+	require.Equal(t, int64(1), decodes.Load())
+}
+
+func TestGetOrDefault(t *testing.T) {
+	dataDir := t.TempDir()
+	testLogger := logger.NewTestAppLogger(dataDir)
+	cacheCfg := cache.CacheConfig{
+		DataDir:   dataDir,
+		MarshalFn: UnmarshallTestStruct,
+	}
+	ca, err := cache.NewCacheService(cacheCfg, testLogger)
+	require.NoError(t, err)
+	closeOnCleanup(t, ca)
+
+	def := TestStruct{Name: "Default", Age: 0}
+	err = ca.Set("hit", TestStruct{Name: "John", Age: 34}, 5*time.Minute)
+	require.NoError(t, err)
+	err = ca.Set("expiring", TestStruct{Name: "Jane", Age: 29}, 50*time.Millisecond)
+	require.NoError(t, err)
+
+	require.Equal(t, TestStruct{Name: "John", Age: 34}, ca.GetOrDefault("hit", def))
+	require.Equal(t, def, ca.GetOrDefault("missing", def))
+	time.Sleep(100 * time.Millisecond)
+	require.Equal(t, def, ca.GetOrDefault("expiring", def))
+	require.Nil(t, ca.GetOrDefault("missing", nil))
+}
+
+func TestPauseCleanup(t *testing.T) {
+	dataDir := t.TempDir()
+	testLogger := logger.NewTestAppLogger(dataDir)
+	cacheCfg := cache.CacheConfig{
+		DataDir:                dataDir,
+		MarshalFn:              UnmarshallTestStruct,
+		DefaultCleanupInterval: 20 * time.Millisecond,
+		DeletionHistorySize:    10,
+	}
+	ca, err := cache.NewCacheService(cacheCfg, testLogger)
+	require.NoError(t, err)
+	closeOnCleanup(t, ca)
+
+	ca.PauseCleanup()
+	err = ca.Set("expiring", TestStruct{Name: "Jane", Age: 29}, 10*time.Millisecond)
+	require.NoError(t, err)
+	time.Sleep(100 * time.Millisecond)
+	require.Equal(t, 0, len(ca.RecentDeletions()))
+
+	ca.ResumeCleanup()
+	require.Eventually(t, func() bool {
+		return len(ca.RecentDeletions()) == 1
+	}, time.Second, 10*time.Millisecond)
+	require.Equal(t, cache.DeletionExpired, ca.RecentDeletions()[0].Reason)
+}
+
+func TestSetIfStale(t *testing.T) {
+	dataDir := t.TempDir()
+	testLogger := logger.NewTestAppLogger(dataDir)
+	cacheCfg := cache.CacheConfig{
+		DataDir:   dataDir,
+		MarshalFn: UnmarshallTestStruct,
+	}
+	ca, err := cache.NewCacheService(cacheCfg, testLogger)
+	require.NoError(t, err)
+	closeOnCleanup(t, ca)
+
+	err = ca.Set("fresh", TestStruct{Name: "John", Age: 34}, 5*time.Minute)
+	require.NoError(t, err)
+	err = ca.Set("stale", TestStruct{Name: "Jane", Age: 29}, 10*time.Second)
+	require.NoError(t, err)
+
+	set, err := ca.SetIfStale("fresh", TestStruct{Name: "John", Age: 35}, 5*time.Minute, time.Minute)
+	require.NoError(t, err)
+	require.Equal(t, false, set)
+	cVal, _ := ca.Get("fresh")
+	require.Equal(t, TestStruct{Name: "John", Age: 34}, cVal)
+
+	set, err = ca.SetIfStale("stale", TestStruct{Name: "Jane", Age: 30}, 5*time.Minute, time.Minute)
+	require.NoError(t, err)
+	require.Equal(t, true, set)
+	cVal, exp := ca.Get("stale")
+	require.Equal(t, TestStruct{Name: "Jane", Age: 30}, cVal)
+	require.WithinDuration(t, time.Now().Add(5*time.Minute), exp, time.Second)
+
+	set, err = ca.SetIfStale("missing", TestStruct{Name: "Jack", Age: 41}, 5*time.Minute, time.Minute)
+	require.NoError(t, err)
+	require.Equal(t, true, set)
+	cVal, _ = ca.Get("missing")
+	require.Equal(t, TestStruct{Name: "Jack", Age: 41}, cVal)
+}
+
+func TestHitRatio(t *testing.T) {
+	dataDir := t.TempDir()
+	testLogger := logger.NewTestAppLogger(dataDir)
+	cacheCfg := cache.CacheConfig{
+		DataDir:   dataDir,
+		MarshalFn: UnmarshallTestStruct,
+	}
+	ca, err := cache.NewCacheService(cacheCfg, testLogger)
+	require.NoError(t, err)
+	closeOnCleanup(t, ca)
+	require.Equal(t, float64(0), ca.HitRatio())
+
+	err = ca.Set("john", TestStruct{Name: "John", Age: 34}, 5*time.Minute)
+	require.NoError(t, err)
+
+	for i := 0; i < 3; i++ {
+		_, _ = ca.Get("john")
+	}
+	_, _ = ca.Get("missing")
+	require.InDelta(t, 0.75, ca.HitRatio(), 1e-9)
+
+	stats := ca.Stats()
+	require.Equal(t, int64(3), stats.Hits)
+	require.Equal(t, int64(1), stats.Misses)
+}
@@ -0,0 +1,81 @@
+package cache
+
+import (
+	"strings"
+	"sync"
+
+	"github.com/comfforts/cloudstorage"
+)
+
+// CLOSE_ALL_PARALLELISM bounds how many caches CloseAll and SyncAll work on at once.
+const CLOSE_ALL_PARALLELISM = 4
+
+// MultiError holds the errors of an operation run over several caches.
+type MultiError []error
+
+func (m MultiError) Error() string {
+	msgs := make([]string, 0, len(m))
+	for _, err := range m {
+		msgs = append(msgs, err.Error())
+	}
+	return strings.Join(msgs, "; ")
+}
+
+// CloseAll clears every cache, saving and backing up each as Clear does. Errors are
+// returned as a MultiError in the order of the caches they came from.
+func CloseAll(caches ...CacheService) error {
+	return forEachCache(caches, func(c CacheService) error {
+		return c.Clear()
+	})
+}
+
+// SyncAll uploads every cache backed up through client and closes client once they're done,
+// for shutting down caches that share one client. Errors are returned as for CloseAll.
+func SyncAll(client cloudstorage.CloudStorage, caches ...CacheService) error {
+	err := forEachCache(caches, func(c CacheService) error {
+		if cs, ok := c.(*cacheService); ok && cs.StoreConfig.CloudClient != client {
+			return ErrCloudClientMismatch
+		}
+		return c.SyncToCloud()
+	})
+
+	if cerr := client.Close(); cerr != nil {
+		merr, _ := err.(MultiError)
+		return append(merr, cerr)
+	}
+	return err
+}
+
+// forEachCache runs fn over the caches, CLOSE_ALL_PARALLELISM at a time.
+func forEachCache(caches []CacheService, fn func(c CacheService) error) error {
+	errs := make([]error, len(caches))
+	sem := make(chan struct{}, CLOSE_ALL_PARALLELISM)
+	var wg sync.WaitGroup
+	for i, c := range caches {
+		if c == nil {
+			continue
+		}
+		i, c := i, c
+		wg.Add(1)
+		sem <- struct{}{}
+		go func() {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+			errs[i] = fn(c)
+		}()
+	}
+	wg.Wait()
+
+	var merr MultiError
+	for _, err := range errs {
+		if err != nil {
+			merr = append(merr, err)
+		}
+	}
+	if len(merr) == 0 {
+		return nil
+	}
+	return merr
+}
@@ -0,0 +1,99 @@
+package cache_test
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/comfforts/cache"
+	"github.com/comfforts/logger"
+)
+
+type failingClear struct {
+	cache.CacheService
+	err error
+}
+
+func (f *failingClear) Clear() error {
+	return f.err
+}
+
+func TestCloseAll(t *testing.T) {
+	dataDir := t.TempDir()
+	testLogger := logger.NewTestAppLogger(dataDir)
+
+	caches := []cache.CacheService{}
+	for i := 0; i < 6; i++ {
+		cacheCfg := cache.CacheConfig{
+			DataDir:       dataDir,
+			CacheFileName: fmt.Sprintf("cache-%d", i),
+			MarshalFn:     UnmarshallTestStruct,
+		}
+		ca, err := cache.NewCacheService(cacheCfg, testLogger)
+		require.NoError(t, err)
+		closeOnCleanup(t, ca)
+		err = ca.Set("test", TestStruct{Name: "John", Age: i}, 5*time.Minute)
+		require.NoError(t, err)
+		caches = append(caches, ca)
+	}
+
+	err := cache.CloseAll(caches...)
+	require.NoError(t, err)
+	for i, ca := range caches {
+		require.Equal(t, 0, ca.ItemCount())
+		_, err = os.Stat(filepath.Join(dataDir, fmt.Sprintf("cache-%d.json", i)))
+		require.NoError(t, err)
+	}
+
+	first := &failingClear{CacheService: caches[0], err: fmt.Errorf("first failed")}
+	second := &failingClear{CacheService: caches[1], err: fmt.Errorf("second failed")}
+	err = cache.CloseAll(first, caches[2], second, nil)
+	require.Error(t, err)
+	merr, ok := err.(cache.MultiError)
+	require.Equal(t, true, ok)
+	require.Equal(t, cache.MultiError{first.err, second.err}, merr)
+	require.Equal(t, "first failed; second failed", err.Error())
+}
+
+func TestSyncAll(t *testing.T) {
+	dataDir := t.TempDir()
+	testLogger := logger.NewTestAppLogger(dataDir)
+
+	client := newFakeCloudClient()
+	caches := []cache.CacheService{}
+	for i := 0; i < 2; i++ {
+		cacheCfg := cache.CacheConfig{
+			DataDir:       dataDir,
+			CacheFileName: fmt.Sprintf("cache-%d", i),
+			MarshalFn:     UnmarshallTestStruct,
+		}
+		cloudCfg := cache.CacheStorageConfig{
+			Bucket:      "test-bucket",
+			CloudClient: client,
+		}
+		ca, err := cache.NewWithCloudBackup(cacheCfg, cloudCfg, testLogger)
+		require.NoError(t, err)
+		closeOnCleanup(t, ca)
+		err = ca.Set("test", TestStruct{Name: "John", Age: i}, 5*time.Minute)
+		require.NoError(t, err)
+		caches = append(caches, ca)
+	}
+
+	err := cache.SyncAll(client, caches...)
+	require.NoError(t, err)
+	for i := range caches {
+		_, ok := client.object("test-bucket", dataDir, fmt.Sprintf("cache-%d.json", i))
+		require.Equal(t, true, ok)
+	}
+	require.Equal(t, 1, client.closed)
+
+	other := newFakeCloudClient()
+	err = cache.SyncAll(other, caches...)
+	require.Error(t, err)
+	require.Equal(t, 2, len(err.(cache.MultiError)))
+	require.Equal(t, 1, other.closed)
+}
@@ -0,0 +1,83 @@
+package cache
+
+import (
+	"context"
+	"io"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/comfforts/cloudstorage"
+)
+
+const (
+	CONTENT_TYPE_JSON   = "application/json"
+	CONTENT_TYPE_BINARY = "application/octet-stream"
+
+	CONTENT_ENCODING_GZIP = "gzip"
+
+	METADATA_ITEM_COUNT = "item_count"
+	METADATA_SAVED_AT   = "saved_at"
+
+	// characters cloud object names reject or treat as wildcards
+	UNSAFE_OBJECT_NAME_CHARS = "/\\#[]*?"
+)
+
+// CloudObjectAttrs holds the attributes attached to a cloud backup object.
+// ContentEncoding is gzip for compressed backups and empty otherwise.
+type CloudObjectAttrs struct {
+	ContentType     string
+	ContentEncoding string
+	Metadata        map[string]string
+}
+
+// CloudAttrsUploader is implemented by cloud clients that can set object attributes on upload.
+// When the configured client implements it, backups are uploaded with content-type and metadata.
+type CloudAttrsUploader interface {
+	UploadFileWithAttrs(ctx context.Context, r io.Reader, cfr cloudstorage.CloudFileRequest, attrs CloudObjectAttrs) (int64, error)
+}
+
+// CloudObjectStater is implemented by cloud clients that can report an object's size.
+// When the configured client implements it, downloads are checked for truncation.
+type CloudObjectStater interface {
+	ObjectSize(ctx context.Context, cfr cloudstorage.CloudFileRequest) (int64, error)
+}
+
+// CloudObjectModTimer is implemented by cloud clients that can report when an object was last modified.
+// When the configured client implements it, uploads of an unchanged cache file are skipped.
+type CloudObjectModTimer interface {
+	ObjectModTime(ctx context.Context, cfr cloudstorage.CloudFileRequest) (time.Time, error)
+}
+
+// CloudChunkedUploader is implemented by cloud clients that can upload an object in parts,
+// multipart or resumable. When the configured client implements it and CloudChunkSize is
+// set, backups larger than a chunk are uploaded chunkSize bytes at a time.
+type CloudChunkedUploader interface {
+	UploadFileChunked(ctx context.Context, r io.Reader, cfr cloudstorage.CloudFileRequest, attrs CloudObjectAttrs, chunkSize int64) (int64, error)
+}
+
+// validateCacheFileName checks the cache file name is usable as a cloud object name.
+func validateCacheFileName(name string) error {
+	if name == "." || name == ".." || !utf8.ValidString(name) {
+		return ErrInvalidCacheFileName
+	}
+	for _, r := range name {
+		if !unicode.IsPrint(r) || strings.ContainsRune(UNSAFE_OBJECT_NAME_CHARS, r) {
+			return ErrInvalidCacheFileName
+		}
+	}
+	return nil
+}
+
+func (c *cacheService) contentType() string {
+	if c.BinaryFile {
+		return CONTENT_TYPE_BINARY
+	}
+	if c.NewEncoder != nil {
+		if ct, ok := c.NewEncoder(io.Discard).(ContentTyper); ok {
+			return ct.ContentType()
+		}
+	}
+	return CONTENT_TYPE_JSON
+}
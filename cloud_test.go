@@ -0,0 +1,1157 @@
+package cache_test
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	gocache "github.com/patrickmn/go-cache"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+
+	"github.com/comfforts/cache"
+	"github.com/comfforts/cloudstorage"
+	"github.com/comfforts/logger"
+)
+
+type fakeCloudClient struct {
+	mu      sync.Mutex
+	objects map[string][]byte
+	attrs   map[string]cache.CloudObjectAttrs
+	uploads []string
+	closed  int
+}
+
+func newFakeCloudClient() *fakeCloudClient {
+	return &fakeCloudClient{
+		objects: map[string][]byte{},
+		attrs:   map[string]cache.CloudObjectAttrs{},
+	}
+}
+
+func requestField(cfr cloudstorage.CloudFileRequest, name string) string {
+	return reflect.ValueOf(cfr).FieldByName(name).String()
+}
+
+func objectName(cfr cloudstorage.CloudFileRequest) string {
+	return filepath.Join(
+		requestField(cfr, "bucket"),
+		requestField(cfr, "path"),
+		requestField(cfr, "file"),
+	)
+}
+
+func (f *fakeCloudClient) UploadFile(ctx context.Context, r io.Reader, cfr cloudstorage.CloudFileRequest) (int64, error) {
+	body, err := io.ReadAll(r)
+	if err != nil {
+		return 0, err
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	name := objectName(cfr)
+	f.objects[name] = body
+	f.uploads = append(f.uploads, name)
+	return int64(len(body)), nil
+}
+
+func (f *fakeCloudClient) DownloadFile(ctx context.Context, w io.Writer, cfr cloudstorage.CloudFileRequest) (int64, error) {
+	f.mu.Lock()
+	body, ok := f.objects[objectName(cfr)]
+	f.mu.Unlock()
+	if !ok {
+		return 0, fmt.Errorf("object %s not found", objectName(cfr))
+	}
+	return io.Copy(w, bytes.NewReader(body))
+}
+
+func (f *fakeCloudClient) ListObjects(ctx context.Context, cfr cloudstorage.CloudFileRequest) ([]string, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	names := []string{}
+	for name := range f.objects {
+		names = append(names, name)
+	}
+	return names, nil
+}
+
+func (f *fakeCloudClient) DeleteObject(ctx context.Context, cfr cloudstorage.CloudFileRequest) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	delete(f.objects, objectName(cfr))
+	return nil
+}
+
+func (f *fakeCloudClient) DeleteObjects(ctx context.Context, cfr cloudstorage.CloudFileRequest) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.objects = map[string][]byte{}
+	return nil
+}
+
+func (f *fakeCloudClient) Close() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.closed++
+	return nil
+}
+
+type fakeAttrsCloudClient struct {
+	*fakeCloudClient
+}
+
+func (f *fakeAttrsCloudClient) UploadFileWithAttrs(ctx context.Context, r io.Reader, cfr cloudstorage.CloudFileRequest, attrs cache.CloudObjectAttrs) (int64, error) {
+	n, err := f.UploadFile(ctx, r, cfr)
+	if err != nil {
+		return n, err
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.attrs[objectName(cfr)] = attrs
+	return n, nil
+}
+
+func TestCloudUploadAttrs(t *testing.T) {
+	dataDir := t.TempDir()
+	testLogger := logger.NewTestAppLogger(dataDir)
+	cacheCfg := cache.CacheConfig{
+		DataDir:   dataDir,
+		MarshalFn: UnmarshallTestStruct,
+	}
+
+	client := &fakeAttrsCloudClient{newFakeCloudClient()}
+	cloudCfg := cache.CacheStorageConfig{
+		Bucket:      "test-bucket",
+		CloudClient: client,
+	}
+	ca, err := cache.NewWithCloudBackup(cacheCfg, cloudCfg, testLogger)
+	require.NoError(t, err)
+	closeOnCleanup(t, ca)
+
+	err = ca.Set("test", TestStruct{Name: "John", Age: 34}, 5*time.Minute)
+	require.NoError(t, err)
+
+	err = ca.Clear()
+	require.NoError(t, err)
+
+	require.Equal(t, 1, len(client.uploads))
+	attrs, ok := client.attrs[client.uploads[0]]
+	require.Equal(t, true, ok)
+	require.Equal(t, cache.CONTENT_TYPE_JSON, attrs.ContentType)
+	require.Equal(t, "1", attrs.Metadata[cache.METADATA_ITEM_COUNT])
+
+	savedAt, err := time.Parse(time.RFC3339, attrs.Metadata[cache.METADATA_SAVED_AT])
+	require.NoError(t, err)
+	require.WithinDuration(t, time.Now(), savedAt, time.Minute)
+}
+
+// gzipEncoder compresses the JSON it writes and reports its own content type.
+type gzipEncoder struct {
+	w io.Writer
+}
+
+func (e gzipEncoder) Encode(v interface{}) error {
+	gz := gzip.NewWriter(e.w)
+	if err := json.NewEncoder(gz).Encode(v); err != nil {
+		return err
+	}
+	return gz.Close()
+}
+
+func (e gzipEncoder) ContentType() string {
+	return "application/x-test"
+}
+
+func TestCloudUploadCodecAttrs(t *testing.T) {
+	dataDir := t.TempDir()
+	testLogger := logger.NewTestAppLogger(dataDir)
+	cacheCfg := cache.CacheConfig{
+		DataDir:   dataDir,
+		MarshalFn: UnmarshallTestStruct,
+		NewEncoder: func(w io.Writer) cache.Encoder {
+			return gzipEncoder{w: w}
+		},
+	}
+
+	client := &fakeAttrsCloudClient{newFakeCloudClient()}
+	cloudCfg := cache.CacheStorageConfig{
+		Bucket:      "test-bucket",
+		CloudClient: client,
+	}
+	ca, err := cache.NewWithCloudBackup(cacheCfg, cloudCfg, testLogger)
+	require.NoError(t, err)
+	closeOnCleanup(t, ca)
+
+	err = ca.Set("test", TestStruct{Name: "John", Age: 34}, 5*time.Minute)
+	require.NoError(t, err)
+	err = ca.SyncToCloud()
+	require.NoError(t, err)
+
+	attrs, ok := client.attrs[client.uploads[0]]
+	require.Equal(t, true, ok)
+	require.Equal(t, "application/x-test", attrs.ContentType)
+	require.Equal(t, cache.CONTENT_ENCODING_GZIP, attrs.ContentEncoding)
+
+	// the compressed backup still loads
+	err = ca.Clear()
+	require.NoError(t, err)
+	err = os.Remove(filepath.Join(dataDir, "cache.json"))
+	require.NoError(t, err)
+	ca, err = cache.NewWithCloudBackup(cacheCfg, cloudCfg, testLogger)
+	require.NoError(t, err)
+	closeOnCleanup(t, ca)
+	cVal, _ := ca.Get("test")
+	require.Equal(t, TestStruct{Name: "John", Age: 34}, cVal)
+}
+
+type fakeChunkedCloudClient struct {
+	*fakeAttrsCloudClient
+	chunks []int
+}
+
+func (f *fakeChunkedCloudClient) UploadFileChunked(ctx context.Context, r io.Reader, cfr cloudstorage.CloudFileRequest, attrs cache.CloudObjectAttrs, chunkSize int64) (int64, error) {
+	var body bytes.Buffer
+	count := 0
+	chunk := make([]byte, chunkSize)
+	for {
+		n, err := io.ReadFull(r, chunk)
+		if n > 0 {
+			body.Write(chunk[:n])
+			count++
+		}
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			break
+		}
+		if err != nil {
+			return 0, err
+		}
+	}
+	n, err := f.UploadFileWithAttrs(ctx, &body, cfr, attrs)
+	if err != nil {
+		return n, err
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.chunks = append(f.chunks, count)
+	return n, nil
+}
+
+func TestCloudChunkSize(t *testing.T) {
+	dataDir := t.TempDir()
+	testLogger := logger.NewTestAppLogger(dataDir)
+	client := &fakeChunkedCloudClient{fakeAttrsCloudClient: &fakeAttrsCloudClient{newFakeCloudClient()}}
+	cloudCfg := cache.CacheStorageConfig{
+		Bucket:         "test-bucket",
+		CloudClient:    client,
+		CloudChunkSize: 512,
+	}
+
+	// a file under a chunk goes up in one request
+	small, err := cache.NewWithCloudBackup(cache.CacheConfig{
+		DataDir:       dataDir,
+		CacheFileName: "small",
+		MarshalFn:     UnmarshallTestStruct,
+	}, cloudCfg, testLogger)
+	require.NoError(t, err)
+	closeOnCleanup(t, small)
+	err = small.Set("test", TestStruct{Name: "John", Age: 34}, 5*time.Minute)
+	require.NoError(t, err)
+	err = small.Clear()
+	require.NoError(t, err)
+	require.Equal(t, 1, len(client.uploads))
+	require.Equal(t, 0, len(client.chunks))
+
+	cacheCfg := cache.CacheConfig{
+		DataDir:       dataDir,
+		CacheFileName: "large",
+		MarshalFn:     UnmarshallTestStruct,
+	}
+	large, err := cache.NewWithCloudBackup(cacheCfg, cloudCfg, testLogger)
+	require.NoError(t, err)
+	closeOnCleanup(t, large)
+	for i := 0; i < 50; i++ {
+		err = large.Set(fmt.Sprintf("key-%d", i), TestStruct{Name: "John", Age: i}, 5*time.Minute)
+		require.NoError(t, err)
+	}
+	err = large.Clear()
+	require.NoError(t, err)
+	require.Equal(t, 2, len(client.uploads))
+	require.Equal(t, 1, len(client.chunks))
+	fStats, err := os.Stat(filepath.Join(dataDir, "large.json"))
+	require.NoError(t, err)
+	require.Equal(t, int((fStats.Size()+511)/512), client.chunks[0])
+	attrs := client.attrs[client.uploads[1]]
+	require.Equal(t, "50", attrs.Metadata[cache.METADATA_ITEM_COUNT])
+
+	// the chunked backup restores
+	err = os.Remove(filepath.Join(dataDir, "large.json"))
+	require.NoError(t, err)
+	restored, err := cache.NewWithCloudBackup(cacheCfg, cloudCfg, testLogger)
+	require.NoError(t, err)
+	closeOnCleanup(t, restored)
+	require.Equal(t, 50, restored.ItemCount())
+	cVal, _ := restored.Get("key-7")
+	require.Equal(t, TestStruct{Name: "John", Age: 7}, cVal)
+}
+
+func TestSetCloudBucket(t *testing.T) {
+	dataDir := t.TempDir()
+	testLogger := logger.NewTestAppLogger(dataDir)
+	cacheCfg := cache.CacheConfig{
+		DataDir:   dataDir,
+		MarshalFn: UnmarshallTestStruct,
+	}
+
+	client := newFakeCloudClient()
+	cloudCfg := cache.CacheStorageConfig{
+		Bucket:      "old-bucket",
+		CloudClient: client,
+	}
+	ca, err := cache.NewWithCloudBackup(cacheCfg, cloudCfg, testLogger)
+	require.NoError(t, err)
+	closeOnCleanup(t, ca)
+
+	err = ca.SetCloudBucket("")
+	require.Equal(t, cache.ErrMissingBucket, err)
+
+	err = ca.SetCloudBucket("new-bucket")
+	require.NoError(t, err)
+
+	err = ca.Set("test", TestStruct{Name: "John", Age: 34}, 5*time.Minute)
+	require.NoError(t, err)
+
+	err = ca.Clear()
+	require.NoError(t, err)
+
+	require.Equal(t, 1, len(client.uploads))
+	require.Equal(t, true, strings.HasPrefix(client.uploads[0], "new-bucket/"))
+}
+
+func (f *fakeCloudClient) put(bucket, path, file string, body []byte) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.objects[filepath.Join(bucket, path, file)] = body
+}
+
+type slowCloudClient struct {
+	*fakeCloudClient
+	delay time.Duration
+}
+
+func (f *slowCloudClient) DownloadFile(ctx context.Context, w io.Writer, cfr cloudstorage.CloudFileRequest) (int64, error) {
+	time.Sleep(f.delay)
+	return f.fakeCloudClient.DownloadFile(ctx, w, cfr)
+}
+
+func TestAsyncRestore(t *testing.T) {
+	dataDir := t.TempDir()
+	testLogger := logger.NewTestAppLogger(dataDir)
+	cacheCfg := cache.CacheConfig{
+		DataDir:      dataDir,
+		MarshalFn:    UnmarshallTestStruct,
+		AsyncRestore: true,
+	}
+
+	exp := time.Now().Add(5 * time.Minute).UnixNano()
+	body, err := json.Marshal(map[string]gocache.Item{
+		"restored": {Object: TestStruct{Name: "John", Age: 34}, Expiration: exp},
+		"fresh":    {Object: TestStruct{Name: "Stale", Age: 1}, Expiration: exp},
+	})
+	require.NoError(t, err)
+
+	client := &slowCloudClient{
+		fakeCloudClient: newFakeCloudClient(),
+		delay:           200 * time.Millisecond,
+	}
+	client.put("test-bucket", dataDir, "cache.json", body)
+
+	cloudCfg := cache.CacheStorageConfig{
+		Bucket:      "test-bucket",
+		CloudClient: client,
+	}
+	start := time.Now()
+	ca, err := cache.NewWithCloudBackup(cacheCfg, cloudCfg, testLogger)
+	require.NoError(t, err)
+	closeOnCleanup(t, ca)
+	require.Less(t, time.Since(start), client.delay)
+
+	cVal, _ := ca.Get("restored")
+	require.Nil(t, cVal)
+
+	err = ca.Set("fresh", TestStruct{Name: "Jane", Age: 29}, 5*time.Minute)
+	require.NoError(t, err)
+	cVal, _ = ca.Get("fresh")
+	require.Equal(t, TestStruct{Name: "Jane", Age: 29}, cVal)
+
+	select {
+	case <-ca.Ready():
+	case <-time.After(2 * time.Second):
+		t.Fatal("restore did not complete")
+	}
+
+	cVal, _ = ca.Get("restored")
+	require.Equal(t, TestStruct{Name: "John", Age: 34}, cVal)
+	require.Equal(t, 2, ca.ItemCount())
+
+	// the write made during the restore wins over the file and still needs saving
+	cVal, _ = ca.Get("fresh")
+	require.Equal(t, TestStruct{Name: "Jane", Age: 29}, cVal)
+	require.Equal(t, true, ca.Updated())
+}
+
+func TestLoadGzippedCloudObject(t *testing.T) {
+	dataDir := t.TempDir()
+	testLogger := logger.NewTestAppLogger(dataDir)
+	cacheCfg := cache.CacheConfig{
+		DataDir:   dataDir,
+		MarshalFn: UnmarshallTestStruct,
+	}
+
+	exp := time.Now().Add(5 * time.Minute).UnixNano()
+	body, err := json.Marshal(map[string]gocache.Item{
+		"compressed": {Object: TestStruct{Name: "John", Age: 34}, Expiration: exp},
+	})
+	require.NoError(t, err)
+
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	_, err = zw.Write(body)
+	require.NoError(t, err)
+	require.NoError(t, zw.Close())
+
+	client := newFakeCloudClient()
+	client.put("test-bucket", dataDir, "cache.json", buf.Bytes())
+
+	cloudCfg := cache.CacheStorageConfig{
+		Bucket:      "test-bucket",
+		CloudClient: client,
+	}
+	ca, err := cache.NewWithCloudBackup(cacheCfg, cloudCfg, testLogger)
+	require.NoError(t, err)
+	closeOnCleanup(t, ca)
+
+	require.Equal(t, 1, ca.ItemCount())
+	cVal, _ := ca.Get("compressed")
+	require.Equal(t, TestStruct{Name: "John", Age: 34}, cVal)
+}
+
+func TestCacheFileNameValidation(t *testing.T) {
+	dataDir := t.TempDir()
+	testLogger := logger.NewTestAppLogger(dataDir)
+	cloudCfg := cache.CacheStorageConfig{
+		Bucket:      "test-bucket",
+		CloudClient: newFakeCloudClient(),
+	}
+
+	for _, name := range []string{"cache", "cache-v2", "geo_codes.2024", "café"} {
+		cacheCfg := cache.CacheConfig{
+			DataDir:       dataDir,
+			CacheFileName: name,
+			MarshalFn:     UnmarshallTestStruct,
+		}
+		ca, err := cache.NewWithCloudBackup(cacheCfg, cloudCfg, testLogger)
+		require.NoError(t, err, name)
+		closeOnCleanup(t, ca)
+	}
+
+	for _, name := range []string{"..", "nested/cache", "cache\n", "cache\x00", "cache#1", "cache*", "cache?", "zero\u200bwidth", "bad\xffutf8"} {
+		cacheCfg := cache.CacheConfig{
+			DataDir:       dataDir,
+			CacheFileName: name,
+			MarshalFn:     UnmarshallTestStruct,
+		}
+		_, err := cache.NewCacheService(cacheCfg, testLogger)
+		require.Equal(t, cache.ErrInvalidCacheFileName, err, name)
+	}
+}
+
+func TestSkipCloudOnClear(t *testing.T) {
+	dataDir := t.TempDir()
+	testLogger := logger.NewTestAppLogger(dataDir)
+	cacheCfg := cache.CacheConfig{
+		DataDir:   dataDir,
+		MarshalFn: UnmarshallTestStruct,
+	}
+
+	client := newFakeCloudClient()
+	cloudCfg := cache.CacheStorageConfig{
+		Bucket:           "test-bucket",
+		CloudClient:      client,
+		SkipCloudOnClear: true,
+	}
+	ca, err := cache.NewWithCloudBackup(cacheCfg, cloudCfg, testLogger)
+	require.NoError(t, err)
+	closeOnCleanup(t, ca)
+
+	err = ca.Set("test", TestStruct{Name: "John", Age: 34}, 5*time.Minute)
+	require.NoError(t, err)
+
+	err = ca.SyncToCloud()
+	require.NoError(t, err)
+	require.Equal(t, 1, len(client.uploads))
+
+	err = ca.Set("other", TestStruct{Name: "Jane", Age: 29}, 5*time.Minute)
+	require.NoError(t, err)
+	err = ca.Clear()
+	require.NoError(t, err)
+	require.Equal(t, 1, len(client.uploads))
+
+	_, err = os.Stat(filepath.Join(dataDir, "cache.json"))
+	require.NoError(t, err)
+}
+
+type flakyCloudClient struct {
+	*fakeCloudClient
+	calls int
+}
+
+func (f *flakyCloudClient) UploadFile(ctx context.Context, r io.Reader, cfr cloudstorage.CloudFileRequest) (int64, error) {
+	f.calls++
+	if f.calls%2 == 0 {
+		return 0, fmt.Errorf("upload %d failed", f.calls)
+	}
+	return f.fakeCloudClient.UploadFile(ctx, r, cfr)
+}
+
+func TestRecentCloudSyncs(t *testing.T) {
+	dataDir := t.TempDir()
+	testLogger := logger.NewTestAppLogger(dataDir)
+	cacheCfg := cache.CacheConfig{
+		DataDir:   dataDir,
+		MarshalFn: UnmarshallTestStruct,
+	}
+
+	client := &flakyCloudClient{fakeCloudClient: newFakeCloudClient()}
+	cloudCfg := cache.CacheStorageConfig{
+		Bucket:      "test-bucket",
+		CloudClient: client,
+	}
+	ca, err := cache.NewWithCloudBackup(cacheCfg, cloudCfg, testLogger)
+	require.NoError(t, err)
+	closeOnCleanup(t, ca)
+
+	err = ca.Set("test", TestStruct{Name: "John", Age: 34}, 5*time.Minute)
+	require.NoError(t, err)
+
+	for i := 0; i < 3; i++ {
+		err = ca.SyncToCloud()
+		if i == 1 {
+			require.Error(t, err)
+		} else {
+			require.NoError(t, err)
+		}
+	}
+
+	uploads := []cache.CloudSyncEvent{}
+	for _, ev := range ca.RecentCloudSyncs() {
+		if ev.Op == cache.CLOUD_OP_UPLOAD {
+			uploads = append(uploads, ev)
+		}
+	}
+	require.Equal(t, 3, len(uploads))
+	require.NoError(t, uploads[0].Err)
+	require.Error(t, uploads[1].Err)
+	require.NoError(t, uploads[2].Err)
+	require.Greater(t, uploads[0].Bytes, int64(0))
+	require.Equal(t, int64(0), uploads[1].Bytes)
+	require.False(t, uploads[1].Time.Before(uploads[0].Time))
+	require.False(t, uploads[2].Time.Before(uploads[1].Time))
+}
+
+func TestWaitReady(t *testing.T) {
+	dataDir := t.TempDir()
+	testLogger := logger.NewTestAppLogger(dataDir)
+	cacheCfg := cache.CacheConfig{
+		DataDir:      dataDir,
+		MarshalFn:    UnmarshallTestStruct,
+		AsyncRestore: true,
+	}
+
+	exp := time.Now().Add(5 * time.Minute).UnixNano()
+	body, err := json.Marshal(map[string]gocache.Item{
+		"restored": {Object: TestStruct{Name: "John", Age: 34}, Expiration: exp},
+		"fresh":    {Object: TestStruct{Name: "Stale", Age: 1}, Expiration: exp},
+	})
+	require.NoError(t, err)
+
+	client := &slowCloudClient{
+		fakeCloudClient: newFakeCloudClient(),
+		delay:           200 * time.Millisecond,
+	}
+	client.put("test-bucket", dataDir, "cache.json", body)
+
+	cloudCfg := cache.CacheStorageConfig{
+		Bucket:      "test-bucket",
+		CloudClient: client,
+	}
+	ca, err := cache.NewWithCloudBackup(cacheCfg, cloudCfg, testLogger)
+	require.NoError(t, err)
+	closeOnCleanup(t, ca)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	err = ca.WaitReady(ctx)
+	require.Equal(t, context.DeadlineExceeded, err)
+
+	start := time.Now()
+	err = ca.WaitReady(context.Background())
+	require.NoError(t, err)
+	require.Greater(t, time.Since(start), 50*time.Millisecond)
+
+	cVal, _ := ca.Get("restored")
+	require.Equal(t, TestStruct{Name: "John", Age: 34}, cVal)
+}
+
+func TestDownloadBackupTo(t *testing.T) {
+	dataDir := t.TempDir()
+	testLogger := logger.NewTestAppLogger(dataDir)
+	cacheCfg := cache.CacheConfig{
+		DataDir:   dataDir,
+		MarshalFn: UnmarshallTestStruct,
+	}
+
+	ca, err := cache.NewCacheService(cacheCfg, testLogger)
+	require.NoError(t, err)
+	closeOnCleanup(t, ca)
+	err = ca.DownloadBackupTo(context.Background(), filepath.Join(dataDir, "staging.json"))
+	require.Equal(t, cache.ErrCloudNotConfigured, err)
+
+	client := newFakeCloudClient()
+	cloudCfg := cache.CacheStorageConfig{
+		Bucket:      "test-bucket",
+		CloudClient: client,
+	}
+	ca, err = cache.NewWithCloudBackup(cacheCfg, cloudCfg, testLogger)
+	require.NoError(t, err)
+	closeOnCleanup(t, ca)
+
+	err = ca.Set("test", TestStruct{Name: "John", Age: 34}, 5*time.Minute)
+	require.NoError(t, err)
+	err = ca.Clear()
+	require.NoError(t, err)
+
+	livePath := filepath.Join(dataDir, "cache.json")
+	live, err := os.ReadFile(livePath)
+	require.NoError(t, err)
+
+	backup := []byte(`{"version":1,"items":{}}`)
+	client.put("test-bucket", dataDir, "cache.json", backup)
+
+	stagingPath := filepath.Join(t.TempDir(), "staging", "backup.json")
+	err = ca.DownloadBackupTo(context.Background(), stagingPath)
+	require.NoError(t, err)
+
+	staged, err := os.ReadFile(stagingPath)
+	require.NoError(t, err)
+	require.Equal(t, backup, staged)
+
+	after, err := os.ReadFile(livePath)
+	require.NoError(t, err)
+	require.Equal(t, live, after)
+}
+
+type sizedCloudClient struct {
+	*fakeCloudClient
+	extra int64
+}
+
+func (f *sizedCloudClient) ObjectSize(ctx context.Context, cfr cloudstorage.CloudFileRequest) (int64, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	body, ok := f.objects[objectName(cfr)]
+	if !ok {
+		return 0, fmt.Errorf("object %s not found", objectName(cfr))
+	}
+	return int64(len(body)) + f.extra, nil
+}
+
+func TestTruncatedDownload(t *testing.T) {
+	dataDir := t.TempDir()
+	testLogger := logger.NewTestAppLogger(dataDir)
+	cacheCfg := cache.CacheConfig{
+		DataDir:   dataDir,
+		MarshalFn: UnmarshallTestStruct,
+	}
+
+	client := &sizedCloudClient{fakeCloudClient: newFakeCloudClient()}
+	client.put("test-bucket", dataDir, "cache.json", []byte(`{"version":1,"items":{}}`))
+	cloudCfg := cache.CacheStorageConfig{
+		Bucket:      "test-bucket",
+		CloudClient: client,
+	}
+	ca, err := cache.NewWithCloudBackup(cacheCfg, cloudCfg, testLogger)
+	require.NoError(t, err)
+	closeOnCleanup(t, ca)
+
+	stagingPath := filepath.Join(t.TempDir(), "backup.json")
+	err = ca.DownloadBackupTo(context.Background(), stagingPath)
+	require.NoError(t, err)
+	_, err = os.Stat(stagingPath)
+	require.NoError(t, err)
+
+	client.extra = 10
+	err = ca.DownloadBackupTo(context.Background(), stagingPath)
+	require.Equal(t, cache.ErrTruncatedDownload, err)
+	_, err = os.Stat(stagingPath)
+	require.Equal(t, true, os.IsNotExist(err))
+
+	// in memory downloads are checked the same way
+	_, _, err = ca.FetchFromCloud(context.Background(), "test")
+	require.Equal(t, cache.ErrTruncatedDownload, err)
+}
+
+func (f *fakeCloudClient) uploadCount() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return len(f.uploads)
+}
+
+func TestMaxBackupAge(t *testing.T) {
+	dataDir := t.TempDir()
+	testLogger := logger.NewTestAppLogger(dataDir)
+	cacheCfg := cache.CacheConfig{
+		DataDir:   dataDir,
+		MarshalFn: UnmarshallTestStruct,
+	}
+
+	client := newFakeCloudClient()
+	cloudCfg := cache.CacheStorageConfig{
+		Bucket:       "test-bucket",
+		CloudClient:  client,
+		MaxBackupAge: 100 * time.Millisecond,
+	}
+	ca, err := cache.NewWithCloudBackup(cacheCfg, cloudCfg, testLogger)
+	require.NoError(t, err)
+	closeOnCleanup(t, ca)
+	require.Equal(t, 0, client.uploadCount())
+
+	require.Eventually(t, func() bool {
+		return client.uploadCount() >= 2
+	}, 2*time.Second, 10*time.Millisecond)
+	require.Equal(t, false, ca.Updated())
+
+	err = ca.Clear()
+	require.NoError(t, err)
+	uploads := client.uploadCount()
+	time.Sleep(200 * time.Millisecond)
+	require.Equal(t, uploads, client.uploadCount())
+}
+
+type modTimeCloudClient struct {
+	*fakeCloudClient
+	remote time.Time
+}
+
+func (f *modTimeCloudClient) setRemote(t time.Time) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.remote = t
+}
+
+func (f *modTimeCloudClient) ObjectModTime(ctx context.Context, cfr cloudstorage.CloudFileRequest) (time.Time, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.remote.IsZero() {
+		return time.Time{}, fmt.Errorf("object %s not found", objectName(cfr))
+	}
+	return f.remote, nil
+}
+
+func uploadDecisions(logs *observer.ObservedLogs) []string {
+	decisions := []string{}
+	for _, entry := range logs.FilterMessage("cloud upload decision").All() {
+		decisions = append(decisions, entry.ContextMap()["decision"].(string))
+	}
+	return decisions
+}
+
+func TestUploadDecisionLogging(t *testing.T) {
+	dataDir := t.TempDir()
+	core, logs := observer.New(zapcore.InfoLevel)
+	cacheCfg := cache.CacheConfig{
+		DataDir:   dataDir,
+		MarshalFn: UnmarshallTestStruct,
+	}
+
+	client := &modTimeCloudClient{fakeCloudClient: newFakeCloudClient()}
+	cloudCfg := cache.CacheStorageConfig{
+		Bucket:      "test-bucket",
+		CloudClient: client,
+	}
+	ca, err := cache.NewWithCloudBackup(cacheCfg, cloudCfg, zap.New(core))
+	require.NoError(t, err)
+	closeOnCleanup(t, ca)
+
+	err = ca.Set("test", TestStruct{Name: "John", Age: 34}, 5*time.Minute)
+	require.NoError(t, err)
+	err = ca.SyncToCloud()
+	require.NoError(t, err)
+	require.Equal(t, []string{cache.UPLOAD_DECISION_UPLOADED}, uploadDecisions(logs))
+	require.Equal(t, 1, client.uploadCount())
+
+	client.setRemote(time.Now().Add(time.Hour))
+	err = ca.SyncToCloud()
+	require.NoError(t, err)
+	require.Equal(t, []string{cache.UPLOAD_DECISION_UPLOADED, cache.UPLOAD_DECISION_SKIPPED_UNCHANGED}, uploadDecisions(logs))
+	require.Equal(t, 1, client.uploadCount())
+
+	entry := logs.FilterMessage("cloud upload decision").All()[1].ContextMap()
+	require.Contains(t, entry, "localModTime")
+	require.Contains(t, entry, "remoteModTime")
+}
+
+func TestForcedUploadDecision(t *testing.T) {
+	dataDir := t.TempDir()
+	core, logs := observer.New(zapcore.InfoLevel)
+	cacheCfg := cache.CacheConfig{
+		DataDir:   dataDir,
+		MarshalFn: UnmarshallTestStruct,
+	}
+
+	client := &modTimeCloudClient{fakeCloudClient: newFakeCloudClient()}
+	client.setRemote(time.Now().Add(time.Hour))
+	cloudCfg := cache.CacheStorageConfig{
+		Bucket:       "test-bucket",
+		CloudClient:  client,
+		MaxBackupAge: 100 * time.Millisecond,
+	}
+	ca, err := cache.NewWithCloudBackup(cacheCfg, cloudCfg, zap.New(core))
+	require.NoError(t, err)
+	closeOnCleanup(t, ca)
+
+	require.Eventually(t, func() bool {
+		return client.uploadCount() >= 1
+	}, 2*time.Second, 10*time.Millisecond)
+	require.Equal(t, cache.UPLOAD_DECISION_FORCED, uploadDecisions(logs)[0])
+
+	err = ca.Clear()
+	require.NoError(t, err)
+}
+
+func TestBackupAge(t *testing.T) {
+	dataDir := t.TempDir()
+	testLogger := logger.NewTestAppLogger(dataDir)
+	cacheCfg := cache.CacheConfig{
+		DataDir:   dataDir,
+		MarshalFn: UnmarshallTestStruct,
+	}
+
+	client := newFakeCloudClient()
+	cloudCfg := cache.CacheStorageConfig{
+		Bucket:      "test-bucket",
+		CloudClient: client,
+	}
+	ca, err := cache.NewWithCloudBackup(cacheCfg, cloudCfg, testLogger)
+	require.NoError(t, err)
+	closeOnCleanup(t, ca)
+
+	_, ok := ca.BackupAge()
+	require.Equal(t, false, ok)
+
+	err = ca.Set("test", TestStruct{Name: "John", Age: 34}, 5*time.Minute)
+	require.NoError(t, err)
+	err = ca.SyncToCloud()
+	require.NoError(t, err)
+
+	age, ok := ca.BackupAge()
+	require.Equal(t, true, ok)
+	require.Less(t, age, time.Second)
+
+	time.Sleep(50 * time.Millisecond)
+	older, ok := ca.BackupAge()
+	require.Equal(t, true, ok)
+	require.Greater(t, older, age)
+
+	err = ca.SyncToCloud()
+	require.NoError(t, err)
+	age, ok = ca.BackupAge()
+	require.Equal(t, true, ok)
+	require.Less(t, age, older)
+}
+
+func (f *fakeCloudClient) object(bucket, path, file string) ([]byte, bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	body, ok := f.objects[filepath.Join(bucket, path, file)]
+	return body, ok
+}
+
+// uploadTimeCloudClient reports the time of the last upload as the object's mod time.
+type uploadTimeCloudClient struct {
+	*modTimeCloudClient
+}
+
+func (f *uploadTimeCloudClient) UploadFile(ctx context.Context, r io.Reader, cfr cloudstorage.CloudFileRequest) (int64, error) {
+	n, err := f.fakeCloudClient.UploadFile(ctx, r, cfr)
+	if err == nil {
+		f.setRemote(time.Now())
+	}
+	return n, err
+}
+
+func TestStreamedSyncSameSecond(t *testing.T) {
+	dataDir := t.TempDir()
+	testLogger := logger.NewTestAppLogger(dataDir)
+	cacheCfg := cache.CacheConfig{
+		DataDir:   dataDir,
+		MarshalFn: UnmarshallTestStruct,
+	}
+
+	client := &uploadTimeCloudClient{&modTimeCloudClient{fakeCloudClient: newFakeCloudClient()}}
+	cloudCfg := cache.CacheStorageConfig{
+		Bucket:        "test-bucket",
+		CloudClient:   client,
+		SkipLocalFile: true,
+	}
+	ca, err := cache.NewWithCloudBackup(cacheCfg, cloudCfg, testLogger)
+	require.NoError(t, err)
+	closeOnCleanup(t, ca)
+
+	// the second write lands in the same second as the first upload
+	err = ca.Set("a", TestStruct{Name: "John", Age: 34}, 5*time.Minute)
+	require.NoError(t, err)
+	err = ca.SyncToCloud()
+	require.NoError(t, err)
+	err = ca.Set("b", TestStruct{Name: "Jane", Age: 29}, 5*time.Minute)
+	require.NoError(t, err)
+	err = ca.SyncToCloud()
+	require.NoError(t, err)
+	require.Equal(t, 2, client.uploadCount())
+
+	body, ok := client.object("test-bucket", dataDir, "cache.json")
+	require.Equal(t, true, ok)
+	var envelope struct {
+		Items map[string]json.RawMessage `json:"items"`
+	}
+	err = json.Unmarshal(body, &envelope)
+	require.NoError(t, err)
+	require.Contains(t, envelope.Items, "b")
+}
+
+func TestSkipLocalFile(t *testing.T) {
+	dataDir := t.TempDir()
+	testLogger := logger.NewTestAppLogger(dataDir)
+	cacheCfg := cache.CacheConfig{
+		DataDir:   dataDir,
+		MarshalFn: UnmarshallTestStruct,
+	}
+
+	client := newFakeCloudClient()
+	cloudCfg := cache.CacheStorageConfig{
+		Bucket:        "test-bucket",
+		CloudClient:   client,
+		SkipLocalFile: true,
+	}
+	ca, err := cache.NewWithCloudBackup(cacheCfg, cloudCfg, testLogger)
+	require.NoError(t, err)
+	closeOnCleanup(t, ca)
+
+	want := map[string]TestStruct{
+		"john": {Name: "John", Age: 34},
+		"jane": {Name: "Jane", Age: 29},
+	}
+	for k, v := range want {
+		err = ca.Set(k, v, 5*time.Minute)
+		require.NoError(t, err)
+	}
+	err = ca.SyncToCloud()
+	require.NoError(t, err)
+
+	_, err = os.Stat(filepath.Join(dataDir, "cache.json"))
+	require.Equal(t, true, os.IsNotExist(err))
+
+	body, ok := client.object("test-bucket", dataDir, "cache.json")
+	require.Equal(t, true, ok)
+	var envelope struct {
+		Items map[string]struct {
+			Object TestStruct
+		} `json:"items"`
+	}
+	err = json.Unmarshal(body, &envelope)
+	require.NoError(t, err)
+	require.Equal(t, len(want), len(envelope.Items))
+	for k, v := range want {
+		require.Equal(t, v, envelope.Items[k].Object)
+	}
+
+	err = ca.Clear()
+	require.NoError(t, err)
+
+	ca, err = cache.NewWithCloudBackup(cacheCfg, cloudCfg, testLogger)
+	require.NoError(t, err)
+	closeOnCleanup(t, ca)
+	for k, v := range want {
+		val, _ := ca.Get(k)
+		require.Equal(t, v, val)
+	}
+	_, err = os.Stat(filepath.Join(dataDir, "cache.json"))
+	require.Equal(t, true, os.IsNotExist(err))
+	err = ca.Clear()
+	require.NoError(t, err)
+}
+
+func TestFetchFromCloud(t *testing.T) {
+	dataDir := t.TempDir()
+	testLogger := logger.NewTestAppLogger(dataDir)
+	cacheCfg := cache.CacheConfig{
+		DataDir:       dataDir,
+		MarshalFn:     UnmarshallTestStruct,
+		MaxSetsPerSec: 1,
+	}
+
+	client := newFakeCloudClient()
+	cloudCfg := cache.CacheStorageConfig{
+		Bucket:      "test-bucket",
+		CloudClient: client,
+	}
+	ca, err := cache.NewWithCloudBackup(cacheCfg, cloudCfg, testLogger)
+	require.NoError(t, err)
+	closeOnCleanup(t, ca)
+
+	exp := time.Now().Add(5 * time.Minute).UnixNano()
+	body, err := json.Marshal(map[string]interface{}{
+		"version": 1,
+		"items": map[string]gocache.Item{
+			"john": {Object: TestStruct{Name: "John", Age: 34}, Expiration: exp},
+			"jane": {Object: TestStruct{Name: "Jane", Age: 29}, Expiration: exp},
+			"gone": {Object: TestStruct{Name: "Gone", Age: 90}, Expiration: time.Now().Add(-time.Minute).UnixNano()},
+		},
+	})
+	require.NoError(t, err)
+	client.put("test-bucket", dataDir, "cache.json", body)
+
+	val, _ := ca.Get("jane")
+	require.Nil(t, val)
+
+	// fetches aren't held to the Set rate limit
+	err = ca.Set("first", TestStruct{Name: "First", Age: 1}, 5*time.Minute)
+	require.NoError(t, err)
+	err = ca.Set("limited", TestStruct{Name: "Limited", Age: 2}, 5*time.Minute)
+	require.Equal(t, cache.ErrRateLimited, err)
+
+	val, ok, err := ca.FetchFromCloud(context.Background(), "jane")
+	require.NoError(t, err)
+	require.Equal(t, true, ok)
+	require.Equal(t, TestStruct{Name: "Jane", Age: 29}, val)
+
+	val, _ = ca.Get("jane")
+	require.Equal(t, TestStruct{Name: "Jane", Age: 29}, val)
+	val, _ = ca.Get("john")
+	require.Nil(t, val)
+
+	_, ok, err = ca.FetchFromCloud(context.Background(), "gone")
+	require.NoError(t, err)
+	require.Equal(t, false, ok)
+	_, ok, err = ca.FetchFromCloud(context.Background(), "missing")
+	require.NoError(t, err)
+	require.Equal(t, false, ok)
+
+	err = ca.Clear()
+	require.NoError(t, err)
+}
+
+func TestCloudFallbackOnCorrupt(t *testing.T) {
+	for _, fallback := range []bool{false, true} {
+		dataDir := t.TempDir()
+		testLogger := logger.NewTestAppLogger(dataDir)
+		cacheCfg := cache.CacheConfig{
+			DataDir:   dataDir,
+			MarshalFn: UnmarshallTestStruct,
+		}
+		filePath := filepath.Join(dataDir, "cache.json")
+		err := os.WriteFile(filePath, []byte(`{"version":1,"items":{"test":`), 0644)
+		require.NoError(t, err)
+
+		exp := time.Now().Add(5 * time.Minute).UnixNano()
+		body, err := json.Marshal(map[string]interface{}{
+			"version": 1,
+			"items": map[string]gocache.Item{
+				"test": {Object: TestStruct{Name: "John", Age: 34}, Expiration: exp},
+			},
+		})
+		require.NoError(t, err)
+		client := newFakeCloudClient()
+		client.put("test-bucket", dataDir, "cache.json", body)
+		cloudCfg := cache.CacheStorageConfig{
+			Bucket:                 "test-bucket",
+			CloudClient:            client,
+			CloudFallbackOnCorrupt: fallback,
+		}
+		ca, err := cache.NewWithCloudBackup(cacheCfg, cloudCfg, testLogger)
+		require.NoError(t, err)
+		closeOnCleanup(t, ca)
+
+		cVal, _ := ca.Get("test")
+		_, err = os.Stat(filePath + cache.CORRUPT_FILE_SUFFIX)
+		if fallback {
+			require.Equal(t, TestStruct{Name: "John", Age: 34}, cVal)
+			require.NoError(t, err)
+		} else {
+			require.Nil(t, cVal)
+			require.Equal(t, true, os.IsNotExist(err))
+		}
+	}
+}
+
+func TestMetricsJSON(t *testing.T) {
+	dataDir := t.TempDir()
+	testLogger := logger.NewTestAppLogger(dataDir)
+	cacheCfg := cache.CacheConfig{
+		DataDir:   dataDir,
+		MarshalFn: UnmarshallTestStruct,
+	}
+
+	exp := time.Now().Add(5 * time.Minute).UnixNano()
+	body, err := json.Marshal(map[string]interface{}{
+		"version": 1,
+		"items": map[string]gocache.Item{
+			"test": {Object: TestStruct{Name: "John", Age: 34}, Expiration: exp},
+		},
+	})
+	require.NoError(t, err)
+	client := newFakeCloudClient()
+	client.put("test-bucket", dataDir, "cache.json", body)
+	cloudCfg := cache.CacheStorageConfig{
+		Bucket:      "test-bucket",
+		CloudClient: client,
+	}
+	ca, err := cache.NewWithCloudBackup(cacheCfg, cloudCfg, testLogger)
+	require.NoError(t, err)
+	closeOnCleanup(t, ca)
+
+	var metrics map[string]interface{}
+	raw, err := ca.MetricsJSON()
+	require.NoError(t, err)
+	err = json.Unmarshal(raw, &metrics)
+	require.NoError(t, err)
+	require.Nil(t, metrics["backup_age_ms"])
+
+	cVal, _ := ca.Get("test")
+	require.NotNil(t, cVal)
+	cVal, _ = ca.Get("missing")
+	require.Nil(t, cVal)
+	err = ca.SyncToCloud()
+	require.NoError(t, err)
+
+	raw, err = ca.MetricsJSON()
+	require.NoError(t, err)
+	err = json.Unmarshal(raw, &metrics)
+	require.NoError(t, err)
+	require.Equal(t, float64(1), metrics["hits"])
+	require.Equal(t, float64(1), metrics["misses"])
+	require.Equal(t, float64(1), metrics["item_count"])
+	require.Equal(t, cache.LOAD_SOURCE_CLOUD, metrics["last_load_source"])
+	require.NotNil(t, metrics["backup_age_ms"])
+	require.Contains(t, metrics, "loaders")
+}
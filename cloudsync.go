@@ -0,0 +1,79 @@
+package cache
+
+import (
+	"sync"
+	"time"
+)
+
+const (
+	CLOUD_OP_UPLOAD   = "upload"
+	CLOUD_OP_DOWNLOAD = "download"
+	CLOUD_OP_DELETE   = "delete"
+
+	CLOUD_SYNC_HISTORY_SIZE = 32
+)
+
+// Upload decisions logged with the local and remote mod times on every cloud upload.
+const (
+	UPLOAD_DECISION_UPLOADED          = "uploaded"
+	UPLOAD_DECISION_SKIPPED_UNCHANGED = "skipped-unchanged"
+	UPLOAD_DECISION_FORCED            = "forced"
+)
+
+// CloudSyncEvent is the outcome of one cloud backup operation.
+type CloudSyncEvent struct {
+	Op    string
+	Time  time.Time
+	Bytes int64
+	Dur   time.Duration
+	Err   error
+}
+
+// syncHistory is a ring buffer of the most recent cloud sync events.
+type syncHistory struct {
+	mu     sync.Mutex
+	events []CloudSyncEvent
+	next   int
+	full   bool
+}
+
+func (h *syncHistory) record(ev CloudSyncEvent) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if h.events == nil {
+		h.events = make([]CloudSyncEvent, CLOUD_SYNC_HISTORY_SIZE)
+	}
+	h.events[h.next] = ev
+	h.next = (h.next + 1) % len(h.events)
+	if h.next == 0 {
+		h.full = true
+	}
+}
+
+// list returns the events oldest first.
+func (h *syncHistory) list() []CloudSyncEvent {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	events := []CloudSyncEvent{}
+	if h.full {
+		events = append(events, h.events[h.next:]...)
+	}
+	return append(events, h.events[:h.next]...)
+}
+
+func (c *cacheService) recordCloudSync(op string, start time.Time, n int64, err error) {
+	c.syncHistory.record(CloudSyncEvent{
+		Op:    op,
+		Time:  start,
+		Bytes: n,
+		Dur:   time.Since(start),
+		Err:   err,
+	})
+}
+
+// RecentCloudSyncs returns up to CLOUD_SYNC_HISTORY_SIZE recent cloud operations, oldest first.
+func (c *cacheService) RecentCloudSyncs() []CloudSyncEvent {
+	return c.syncHistory.list()
+}
@@ -0,0 +1,36 @@
+package cache
+
+import (
+	"encoding/json"
+	"io"
+)
+
+// Encoder and Decoder are satisfied by encoding/json and drop-in
+// replacements like jsoniter or go-json.
+type Encoder interface {
+	Encode(v interface{}) error
+}
+
+type Decoder interface {
+	Decode(v interface{}) error
+}
+
+// ContentTyper is implemented by encoders that don't write JSON, cloud backups
+// are uploaded with their content type in place of application/json.
+type ContentTyper interface {
+	ContentType() string
+}
+
+func (c *cacheService) newEncoder(w io.Writer) Encoder {
+	if c.NewEncoder != nil {
+		return c.NewEncoder(w)
+	}
+	return json.NewEncoder(w)
+}
+
+func (c *cacheService) newDecoder(r io.Reader) Decoder {
+	if c.NewDecoder != nil {
+		return c.NewDecoder(r)
+	}
+	return json.NewDecoder(r)
+}
@@ -0,0 +1,16 @@
+package cache
+
+import "go.uber.org/zap"
+
+// Compact rebuilds the store from its live items with their expirations, go's maps
+// don't shrink so this frees the memory held after a spike of items is deleted.
+func (c *cacheService) Compact() {
+	c.storeMu.Lock()
+	// expired items go through the eviction callback rather than being dropped silently
+	c.cache.DeleteExpired()
+	items := c.cache.Items()
+	c.cache = c.newStoreFrom(items)
+	c.storeMu.Unlock()
+
+	c.Info("compacted cache", zap.Int("count", len(items)), zap.String("cacheDir", c.DataDir))
+}
@@ -0,0 +1,66 @@
+package cache_test
+
+import (
+	"fmt"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/comfforts/cache"
+	"github.com/comfforts/logger"
+)
+
+func TestCompact(t *testing.T) {
+	dataDir := t.TempDir()
+	testLogger := logger.NewTestAppLogger(dataDir)
+	cacheCfg := cache.CacheConfig{
+		DataDir:                dataDir,
+		MarshalFn:              UnmarshallTestStruct,
+		DefaultCleanupInterval: time.Hour,
+	}
+	ca, err := cache.NewCacheService(cacheCfg, testLogger)
+	require.NoError(t, err)
+	closeOnCleanup(t, ca)
+
+	for i := 0; i < 100000; i++ {
+		err = ca.Set(fmt.Sprintf("key-%d", i), TestStruct{Name: "John", Age: i}, 5*time.Minute)
+		require.NoError(t, err)
+	}
+	for i := 10; i < 100000; i++ {
+		ca.Delete(fmt.Sprintf("key-%d", i))
+	}
+	err = ca.Set("forever", TestStruct{Name: "Jane", Age: 29}, cache.NO_EXPIRATION)
+	require.NoError(t, err)
+	err = ca.Set("expiring", TestStruct{Name: "Jack", Age: 41}, 20*time.Millisecond)
+	require.NoError(t, err)
+	time.Sleep(50 * time.Millisecond)
+	before := ca.Items()
+
+	var m runtime.MemStats
+	runtime.GC()
+	runtime.ReadMemStats(&m)
+	heapBefore := m.HeapAlloc
+
+	ca.Compact()
+
+	runtime.GC()
+	runtime.ReadMemStats(&m)
+	t.Logf("heap before compact %d, after %d", heapBefore, m.HeapAlloc)
+
+	require.Equal(t, 11, ca.ItemCount())
+	require.Equal(t, before, ca.Items())
+	cVal, exp := ca.Get("key-3")
+	require.Equal(t, TestStruct{Name: "John", Age: 3}, cVal)
+	require.Equal(t, before["key-3"].Expiration, exp.UnixNano())
+	cVal, exp = ca.Get("forever")
+	require.Equal(t, TestStruct{Name: "Jane", Age: 29}, cVal)
+	require.True(t, exp.IsZero())
+
+	// the store keeps working after the rebuild
+	err = ca.Set("new", TestStruct{Name: "Jill", Age: 23}, 5*time.Minute)
+	require.NoError(t, err)
+	ca.Delete("key-0")
+	require.Equal(t, 11, ca.ItemCount())
+}
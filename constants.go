@@ -12,6 +12,42 @@ const (
 	ERROR_LOADING_CACHE_FILE       string = "error loading cache file"
 	ERROR_MARSHALLING_CACHE_OBJECT string = "error marshalling object to json"
 	ERROR_UNMARSHALLING_CACHE_JSON string = "error unmarshalling json to struct"
+	ERROR_NO_MATCHING_MARSHAL_FN   string = "error no marshalling function matched cache object"
+	ERROR_KEY_NOT_FOUND            string = "error key not found"
+	ERROR_FETCHING_SOURCE          string = "error fetching value from source"
+	ERROR_WRITE_BEHIND_QUEUE_FULL  string = "error write-behind queue is full"
+	ERROR_MISSING_BUCKET           string = "missing bucket information"
+	ERROR_CLOUD_NOT_CONFIGURED     string = "error cloud storage not configured"
+	ERROR_CACHE_FULL               string = "error cache is at capacity"
+	ERROR_INVALID_CACHE_FILE_NAME  string = "error cache file name is not a valid cloud object name"
+	ERROR_MISSING_DATA_DIR         string = "missing cache data directory"
+	ERROR_MISSING_LOGGER           string = "missing cache logger"
+	ERROR_MISSING_MARSHAL_FN       string = "missing cache data marshalling function"
+	ERROR_FILE_TOO_LARGE           string = "error cache file exceeds the size limit"
+	ERROR_INCREMENT_CACHE          string = "error incrementing cache value"
+	ERROR_INVALID_PATTERN          string = "error invalid key pattern"
+	ERROR_INVALID_LOG_LEVEL        string = "error invalid log level"
+	ERROR_UNSUPPORTED_VERSION      string = "error unsupported cache file version"
+	ERROR_INVALID_CACHE_VALUE      string = "error loaded cache value failed validation"
+	ERROR_TRUNCATED_DOWNLOAD       string = "error cloud download is smaller than the object"
+	ERROR_EXPORTING_CSV            string = "error exporting cache as csv"
+	ERROR_MISSING_ENCRYPTION_KEY   string = "error sensitive values need an encryption key"
+	ERROR_INVALID_ENCRYPTION_KEY   string = "error encryption key must be 16, 24 or 32 bytes"
+	ERROR_DECRYPTING_VALUE         string = "error decrypting sensitive cache value"
+	ERROR_ENCODING_CACHE_ITEM      string = "error encoding cache item, leaving it out of the file"
+	ERROR_NOT_COUNTERS             string = "error cache value is not a counters map"
+	ERROR_NOT_FLOAT                string = "error cache value is not a float"
+	ERROR_NORMALIZING_CACHE_VALUE  string = "error marshal function rejected the cache value"
+	ERROR_INVALID_SOFT_TTL         string = "error soft ttl must be positive and no longer than the hard ttl"
+	ERROR_CLOUD_CLIENT_MISMATCH    string = "error cache is backed up through a different cloud client"
+	ERROR_FETCHING_CACHE_URL       string = "error fetching cache file from url"
+	ERROR_CHECKSUM_MISMATCH        string = "error cache file doesn't match its checksum"
+	ERROR_RATE_LIMITED             string = "error cache operation rate limited"
+	ERROR_EXPIRE_AT_IN_PAST        string = "error expiration time is in the past"
+	ERROR_KEY_EXISTS               string = "error key already exists"
+	ERROR_FREEZING_CACHE           string = "error freezing cache snapshot"
+	ERROR_FREEZE_CACHE_FILE        string = "error snapshot can't be the cache file"
+	ERROR_BINARY_RECORD_TOO_LARGE  string = "error binary cache record length exceeds the limit"
 
 	VALUE_ADDED         = "added value to cache"
 	RETURNING_VALUE     = "returning value for given key"
@@ -27,4 +63,32 @@ var (
 	ErrGetCache      = errors.NewAppError(ERROR_GET_CACHE)
 	ErrGetCacheFile  = errors.NewAppError(ERROR_GETTING_CACHE_FILE)
 	ErrSaveCacheFile = errors.NewAppError(ERROR_SAVING_CACHE_FILE)
+
+	ErrNoMatchingMarshalFn  = errors.NewAppError(ERROR_NO_MATCHING_MARSHAL_FN)
+	ErrKeyNotFound          = errors.NewAppError(ERROR_KEY_NOT_FOUND)
+	ErrWriteBehindQueueFull = errors.NewAppError(ERROR_WRITE_BEHIND_QUEUE_FULL)
+	ErrMissingBucket        = errors.NewAppError(ERROR_MISSING_BUCKET)
+	ErrCloudNotConfigured   = errors.NewAppError(ERROR_CLOUD_NOT_CONFIGURED)
+	ErrCacheFull            = errors.NewAppError(ERROR_CACHE_FULL)
+	ErrInvalidCacheFileName = errors.NewAppError(ERROR_INVALID_CACHE_FILE_NAME)
+	ErrMissingDataDir       = errors.NewAppError(ERROR_MISSING_DATA_DIR)
+	ErrMissingLogger        = errors.NewAppError(ERROR_MISSING_LOGGER)
+	ErrMissingMarshalFn     = errors.NewAppError(ERROR_MISSING_MARSHAL_FN)
+	ErrFileTooLarge         = errors.NewAppError(ERROR_FILE_TOO_LARGE)
+	ErrInvalidPattern       = errors.NewAppError(ERROR_INVALID_PATTERN)
+	ErrInvalidLogLevel      = errors.NewAppError(ERROR_INVALID_LOG_LEVEL)
+	ErrUnsupportedVersion   = errors.NewAppError(ERROR_UNSUPPORTED_VERSION)
+	ErrTruncatedDownload    = errors.NewAppError(ERROR_TRUNCATED_DOWNLOAD)
+	ErrMissingEncryptionKey = errors.NewAppError(ERROR_MISSING_ENCRYPTION_KEY)
+	ErrInvalidEncryptionKey = errors.NewAppError(ERROR_INVALID_ENCRYPTION_KEY)
+	ErrNotCounters          = errors.NewAppError(ERROR_NOT_COUNTERS)
+	ErrNotFloat             = errors.NewAppError(ERROR_NOT_FLOAT)
+	ErrInvalidSoftTTL       = errors.NewAppError(ERROR_INVALID_SOFT_TTL)
+	ErrCloudClientMismatch  = errors.NewAppError(ERROR_CLOUD_CLIENT_MISMATCH)
+	ErrChecksumMismatch     = errors.NewAppError(ERROR_CHECKSUM_MISMATCH)
+	ErrRateLimited          = errors.NewAppError(ERROR_RATE_LIMITED)
+	ErrExpireAtInPast       = errors.NewAppError(ERROR_EXPIRE_AT_IN_PAST)
+	ErrKeyExists            = errors.NewAppError(ERROR_KEY_EXISTS)
+	ErrFreezeCacheFile      = errors.NewAppError(ERROR_FREEZE_CACHE_FILE)
+	ErrBinaryRecordTooLarge = errors.NewAppError(ERROR_BINARY_RECORD_TOO_LARGE)
 )
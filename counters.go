@@ -0,0 +1,103 @@
+package cache
+
+import (
+	"encoding/json"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// MergeCounters atomically adds deltas to the map[string]int64 held by key, creating it
+// with ttl d when missing, and returns the merged counters. Updates keep the current expiration.
+func (c *cacheService) MergeCounters(key string, deltas map[string]int64, d time.Duration) (map[string]int64, error) {
+	d = c.jitterTTL(d)
+	merged := map[string]int64{}
+
+	c.storeMu.Lock()
+	val, exp, found := c.cache.GetWithExpiration(key)
+	if found {
+		current, err := c.decodeData(val)
+		if err != nil {
+			c.storeMu.Unlock()
+			return nil, err
+		}
+		counters, ok := toCounters(current)
+		if !ok {
+			c.storeMu.Unlock()
+			c.Error(ERROR_NOT_COUNTERS, zap.String("key", key))
+			return nil, ErrNotCounters
+		}
+		// copied so readers holding the previous map never see it change
+		for k, n := range counters {
+			merged[k] = n
+		}
+	}
+	for k, n := range deltas {
+		merged[k] += n
+	}
+
+	stored, err := c.encodeValue(merged)
+	if err != nil {
+		c.storeMu.Unlock()
+		c.Error(ERROR_MARSHALLING_CACHE_OBJECT, zap.Error(err), zap.String("key", key))
+		return nil, err
+	}
+	storeTTL := c.storeTTL(d)
+	if found {
+		storeTTL = NO_EXPIRATION
+		if !exp.IsZero() {
+			storeTTL = time.Until(exp)
+		}
+	} else if err := c.makeRoom(); err != nil {
+		c.storeMu.Unlock()
+		c.Error(ERROR_CACHE_FULL, zap.String("key", key), zap.Int("maxItems", c.MaxItems))
+		return nil, err
+	}
+	c.cache.Set(key, c.blobs.intern(stored), storeTTL)
+	c.updatedAt.Store(time.Now().UnixNano())
+	c.storeMu.Unlock()
+	c.trackExpiry(key, storeTTL)
+
+	c.access.touch(key)
+	if !found {
+		c.sliding.record(key, c.effectiveTTL(d))
+		c.revalidator.markFresh(key, c.effectiveTTL(d))
+	}
+	c.hot.invalidate(key)
+	c.getReplica().enqueue(replicaOp{kind: replicaSet, key: key, value: merged, d: storeTTL, sensitive: c.sensitive.has(key)})
+
+	if wb := c.getWriteBehind(); wb != nil {
+		return merged, wb.enqueue(key, merged)
+	}
+	return merged, nil
+}
+
+// toCounters reads a counters map, including the generic form it takes after a reload.
+func toCounters(v interface{}) (map[string]int64, bool) {
+	switch m := v.(type) {
+	case map[string]int64:
+		return m, true
+	case map[string]interface{}:
+		counters := make(map[string]int64, len(m))
+		for k, n := range m {
+			switch n := n.(type) {
+			case float64:
+				counters[k] = int64(n)
+			case int64:
+				counters[k] = n
+			case int:
+				counters[k] = int64(n)
+			case json.Number:
+				i, err := n.Int64()
+				if err != nil {
+					return nil, false
+				}
+				counters[k] = i
+			default:
+				return nil, false
+			}
+		}
+		return counters, true
+	}
+	return nil, false
+}
@@ -0,0 +1,71 @@
+package cache_test
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/comfforts/cache"
+	"github.com/comfforts/logger"
+)
+
+func TestMergeCounters(t *testing.T) {
+	dataDir := t.TempDir()
+	testLogger := logger.NewTestAppLogger(dataDir)
+	cacheCfg := cache.CacheConfig{
+		DataDir:   dataDir,
+		MarshalFn: UnmarshallTestStruct,
+	}
+	ca, err := cache.NewCacheService(cacheCfg, testLogger)
+	require.NoError(t, err)
+	closeOnCleanup(t, ca)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				_, err := ca.MergeCounters("visits", map[string]int64{"home": 1, "cart": 2}, 5*time.Minute)
+				require.NoError(t, err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	merged, err := ca.MergeCounters("visits", map[string]int64{"checkout": 1}, 5*time.Minute)
+	require.NoError(t, err)
+	require.Equal(t, map[string]int64{"home": 800, "cart": 1600, "checkout": 1}, merged)
+	cVal, _ := ca.Get("visits")
+	require.Equal(t, merged, cVal)
+
+	err = ca.Set("name", "John", 5*time.Minute)
+	require.NoError(t, err)
+	_, err = ca.MergeCounters("name", map[string]int64{"home": 1}, 5*time.Minute)
+	require.Equal(t, cache.ErrNotCounters, err)
+}
+
+func TestMergeCountersStoreMarshalled(t *testing.T) {
+	dataDir := t.TempDir()
+	testLogger := logger.NewTestAppLogger(dataDir)
+	cacheCfg := cache.CacheConfig{
+		DataDir:         dataDir,
+		MarshalFn:       UnmarshallTestStruct,
+		StoreMarshalled: true,
+	}
+	ca, err := cache.NewCacheService(cacheCfg, testLogger)
+	require.NoError(t, err)
+	closeOnCleanup(t, ca)
+
+	_, err = ca.MergeCounters("visits", map[string]int64{"home": 1}, 5*time.Minute)
+	require.NoError(t, err)
+	merged, err := ca.MergeCounters("visits", map[string]int64{"home": 1, "cart": 2}, 5*time.Minute)
+	require.NoError(t, err)
+	require.Equal(t, map[string]int64{"home": 2, "cart": 2}, merged)
+
+	raw, ok := ca.GetRaw("visits")
+	require.Equal(t, true, ok)
+	require.JSONEq(t, `{"home":2,"cart":2}`, string(raw))
+}
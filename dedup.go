@@ -0,0 +1,170 @@
+package cache
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"reflect"
+	"sync"
+
+	"github.com/patrickmn/go-cache"
+	"go.uber.org/zap"
+)
+
+// valueRef is stored in place of values when DedupValues is set,
+// it points at the single shared copy held by the blob store.
+type valueRef struct {
+	Hash string
+}
+
+type blobStore struct {
+	mu    sync.Mutex
+	blobs map[string]interface{}
+}
+
+// dedupFile is the persisted form of a deduplicated cache,
+// item objects hold the hash of their value in blobs.
+type dedupFile struct {
+	fileHeader
+	ContentAddressed bool                   `json:"content_addressed"`
+	Blobs            map[string]interface{} `json:"blobs"`
+	Items            map[string]fileItem    `json:"items"`
+}
+
+func newBlobStore() *blobStore {
+	return &blobStore{
+		blobs: map[string]interface{}{},
+	}
+}
+
+// contentHash covers the value's type as well as its JSON, so values that encode
+// the same but differ in type, like 1 and 1.0, don't share a blob.
+func contentHash(value interface{}) (string, bool) {
+	body, err := json.Marshal(value)
+	if err != nil {
+		return "", false
+	}
+	h := sha256.New()
+	if t := reflect.TypeOf(value); t != nil {
+		h.Write([]byte(t.PkgPath() + "." + t.String()))
+	}
+	h.Write([]byte{0})
+	h.Write(body)
+	return hex.EncodeToString(h.Sum(nil)), true
+}
+
+// intern returns the reference to store for value, values
+// that can't be serialized are stored as is.
+func (b *blobStore) intern(value interface{}) interface{} {
+	if b == nil {
+		return value
+	}
+	hash, ok := contentHash(value)
+	if !ok {
+		return value
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if _, ok := b.blobs[hash]; !ok {
+		b.blobs[hash] = value
+	}
+	return valueRef{Hash: hash}
+}
+
+func (b *blobStore) resolve(v interface{}) interface{} {
+	ref, ok := v.(valueRef)
+	if b == nil || !ok {
+		return v
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.blobs[ref.Hash]
+}
+
+// prune drops blobs no longer referenced by items, callers hold the store
+// lock exclusively so no reference can be added while it runs.
+func (b *blobStore) prune(items map[string]cache.Item) int {
+	if b == nil {
+		return 0
+	}
+	live := map[string]bool{}
+	for _, item := range items {
+		if ref, ok := item.Object.(valueRef); ok {
+			live[ref.Hash] = true
+		}
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	pruned := 0
+	for hash := range b.blobs {
+		if !live[hash] {
+			delete(b.blobs, hash)
+			pruned++
+		}
+	}
+	return pruned
+}
+
+func (b *blobStore) reset() {
+	if b == nil {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.blobs = map[string]interface{}{}
+}
+
+// fileForm builds the persisted form of items, each distinct value is written once.
+func (b *blobStore) fileForm(items map[string]cache.Item, staleAt map[string]int64) dedupFile {
+	f := dedupFile{
+		fileHeader:       newFileHeader(len(items)),
+		ContentAddressed: true,
+		Blobs:            map[string]interface{}{},
+		Items:            map[string]fileItem{},
+	}
+	for k, item := range items {
+		if ref, ok := item.Object.(valueRef); ok {
+			f.Blobs[ref.Hash] = b.resolve(ref)
+			item.Object = ref.Hash
+		}
+		f.Items[k] = newFileItem(item, staleAt[k])
+	}
+	return f
+}
+
+// decodeDedupFile expands a deduplicated cache file along with the soft ttl deadlines
+// saved in it, ok is false for any other content.
+func decodeDedupFile(raw []byte) (map[string]cache.Item, map[string]int64, bool) {
+	var f dedupFile
+	if err := json.Unmarshal(raw, &f); err != nil || !f.ContentAddressed {
+		return nil, nil, false
+	}
+
+	for k, item := range f.Items {
+		if hash, ok := item.Object.(string); ok {
+			if value, ok := f.Blobs[hash]; ok {
+				item.Object = value
+				f.Items[k] = item
+			}
+		}
+	}
+	items, staleAt := splitFileItems(f.Items)
+	return items, staleAt, true
+}
+
+// pruneBlobs releases values no item references anymore.
+func (c *cacheService) pruneBlobs() {
+	if c.blobs == nil {
+		return
+	}
+	c.storeMu.Lock()
+	pruned := c.blobs.prune(c.cache.Items())
+	c.storeMu.Unlock()
+	if pruned > 0 {
+		c.Debug("pruned unreferenced values", zap.Int("count", pruned), zap.String("cacheDir", c.DataDir))
+	}
+}
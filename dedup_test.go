@@ -0,0 +1,109 @@
+package cache_test
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/comfforts/cache"
+	"github.com/comfforts/logger"
+)
+
+func TestDedupValues(t *testing.T) {
+	dataDir := t.TempDir()
+	testLogger := logger.NewTestAppLogger(dataDir)
+	cacheCfg := cache.CacheConfig{
+		DataDir:     dataDir,
+		MarshalFn:   UnmarshallTestStruct,
+		DedupValues: true,
+	}
+	ca, err := cache.NewCacheService(cacheCfg, testLogger)
+	require.NoError(t, err)
+	closeOnCleanup(t, ca)
+
+	shared := TestStruct{Name: "Shared", Age: 1}
+	err = ca.Set("first", shared, 5*time.Minute)
+	require.NoError(t, err)
+	err = ca.Set("second", shared, 5*time.Minute)
+	require.NoError(t, err)
+	err = ca.Set("other", TestStruct{Name: "Other", Age: 2}, 5*time.Minute)
+	require.NoError(t, err)
+
+	cVal, _ := ca.Get("second")
+	require.Equal(t, shared, cVal)
+	items := ca.Items()
+	require.Equal(t, shared, items["first"].Object)
+
+	err = ca.Clear()
+	require.NoError(t, err)
+
+	body, err := os.ReadFile(filepath.Join(dataDir, "cache.json"))
+	require.NoError(t, err)
+	var persisted struct {
+		Blobs map[string]json.RawMessage `json:"blobs"`
+		Items map[string]json.RawMessage `json:"items"`
+	}
+	err = json.Unmarshal(body, &persisted)
+	require.NoError(t, err)
+	require.Equal(t, 2, len(persisted.Blobs))
+	require.Equal(t, 3, len(persisted.Items))
+
+	ca, err = cache.NewCacheService(cacheCfg, testLogger)
+	require.NoError(t, err)
+	closeOnCleanup(t, ca)
+	require.Equal(t, 3, ca.ItemCount())
+
+	cVal, _ = ca.Get("first")
+	require.Equal(t, shared, cVal)
+	cVal, _ = ca.Get("second")
+	require.Equal(t, shared, cVal)
+	cVal, _ = ca.Get("other")
+	require.Equal(t, TestStruct{Name: "Other", Age: 2}, cVal)
+
+	cacheCfg.DedupValues = false
+	ca, err = cache.NewCacheService(cacheCfg, testLogger)
+	require.NoError(t, err)
+	closeOnCleanup(t, ca)
+	cVal, _ = ca.Get("first")
+	require.Equal(t, shared, cVal)
+}
+
+type samePersonFields struct {
+	Name string
+	Age  int
+}
+
+func TestDedupValuesKeepTypes(t *testing.T) {
+	dataDir := t.TempDir()
+	testLogger := logger.NewTestAppLogger(dataDir)
+	cacheCfg := cache.CacheConfig{
+		DataDir:     dataDir,
+		MarshalFn:   UnmarshallTestStruct,
+		DedupValues: true,
+	}
+	ca, err := cache.NewCacheService(cacheCfg, testLogger)
+	require.NoError(t, err)
+	closeOnCleanup(t, ca)
+
+	err = ca.Set("int", 1, 5*time.Minute)
+	require.NoError(t, err)
+	err = ca.Set("float", 1.0, 5*time.Minute)
+	require.NoError(t, err)
+	err = ca.Set("test", TestStruct{Name: "John", Age: 34}, 5*time.Minute)
+	require.NoError(t, err)
+	err = ca.Set("same", samePersonFields{Name: "John", Age: 34}, 5*time.Minute)
+	require.NoError(t, err)
+
+	cVal, _ := ca.Get("int")
+	require.Equal(t, 1, cVal)
+	cVal, _ = ca.Get("float")
+	require.Equal(t, 1.0, cVal)
+	cVal, _ = ca.Get("test")
+	require.Equal(t, TestStruct{Name: "John", Age: 34}, cVal)
+	cVal, _ = ca.Get("same")
+	require.Equal(t, samePersonFields{Name: "John", Age: 34}, cVal)
+}
@@ -0,0 +1,109 @@
+package cache
+
+import (
+	"sync"
+	"time"
+)
+
+// DeletionReason tells why an item left the cache.
+type DeletionReason int
+
+const (
+	DeletionExplicit DeletionReason = iota
+	DeletionExpired
+	DeletionEvicted
+)
+
+func (r DeletionReason) String() string {
+	switch r {
+	case DeletionExplicit:
+		return "explicit"
+	case DeletionExpired:
+		return "expired"
+	case DeletionEvicted:
+		return "evicted"
+	}
+	return "unknown"
+}
+
+// DeletionRecord is one item removed from the cache.
+type DeletionRecord struct {
+	Key    string
+	Time   time.Time
+	Reason DeletionReason
+}
+
+// deletionHistory is a ring buffer of recent deletions, it's nil unless DeletionHistorySize is set.
+// Deletes tag the key with their reason before removing it so the eviction callback can record
+// it, untagged removals come from expired item cleanup.
+type deletionHistory struct {
+	mu      sync.Mutex
+	pending map[string]DeletionReason
+	records []DeletionRecord
+	next    int
+	full    bool
+}
+
+func newDeletionHistory(size int) *deletionHistory {
+	return &deletionHistory{
+		pending: map[string]DeletionReason{},
+		records: make([]DeletionRecord, size),
+	}
+}
+
+// expect tags the next removal of key with reason until done is called.
+func (h *deletionHistory) expect(key string, reason DeletionReason) {
+	if h == nil {
+		return
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.pending[key] = reason
+}
+
+func (h *deletionHistory) done(key string) {
+	if h == nil {
+		return
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	delete(h.pending, key)
+}
+
+func (h *deletionHistory) record(key string) {
+	if h == nil {
+		return
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	reason, ok := h.pending[key]
+	if !ok {
+		reason = DeletionExpired
+	}
+	h.records[h.next] = DeletionRecord{Key: key, Time: time.Now(), Reason: reason}
+	h.next = (h.next + 1) % len(h.records)
+	if h.next == 0 {
+		h.full = true
+	}
+}
+
+// list returns the records oldest first.
+func (h *deletionHistory) list() []DeletionRecord {
+	records := []DeletionRecord{}
+	if h == nil {
+		return records
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if h.full {
+		records = append(records, h.records[h.next:]...)
+	}
+	return append(records, h.records[:h.next]...)
+}
+
+// RecentDeletions returns up to DeletionHistorySize recent deletions, oldest first.
+func (c *cacheService) RecentDeletions() []DeletionRecord {
+	return c.deletions.list()
+}
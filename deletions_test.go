@@ -0,0 +1,73 @@
+package cache_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/comfforts/cache"
+	"github.com/comfforts/logger"
+)
+
+func TestRecentDeletions(t *testing.T) {
+	dataDir := t.TempDir()
+	testLogger := logger.NewTestAppLogger(dataDir)
+	cacheCfg := cache.CacheConfig{
+		DataDir:                dataDir,
+		MarshalFn:              UnmarshallTestStruct,
+		DefaultCleanupInterval: time.Hour,
+		MaxItems:               3,
+		DeletionHistorySize:    3,
+	}
+	ca, err := cache.NewCacheService(cacheCfg, testLogger)
+	require.NoError(t, err)
+	closeOnCleanup(t, ca)
+	require.Equal(t, 0, len(ca.RecentDeletions()))
+
+	err = ca.Set("deleted", TestStruct{Name: "John", Age: 34}, 5*time.Minute)
+	require.NoError(t, err)
+	err = ca.Set("expiring", TestStruct{Name: "Jane", Age: 29}, 20*time.Millisecond)
+	require.NoError(t, err)
+	ca.Delete("deleted")
+	// deleting a missing key removes nothing
+	ca.Delete("missing")
+
+	time.Sleep(50 * time.Millisecond)
+	ca.DeleteExpired()
+
+	reasons := func() map[string]cache.DeletionReason {
+		got := map[string]cache.DeletionReason{}
+		for _, rec := range ca.RecentDeletions() {
+			require.False(t, rec.Time.IsZero())
+			got[rec.Key] = rec.Reason
+		}
+		return got
+	}
+	require.Equal(t, map[string]cache.DeletionReason{
+		"deleted":  cache.DeletionExplicit,
+		"expiring": cache.DeletionExpired,
+	}, reasons())
+
+	for _, key := range []string{"a", "b", "c", "d", "e"} {
+		err = ca.Set(key, TestStruct{Name: key, Age: 1}, 5*time.Minute)
+		require.NoError(t, err)
+	}
+	// the evictions push the oldest record out
+	require.Equal(t, map[string]cache.DeletionReason{
+		"expiring": cache.DeletionExpired,
+		"a":        cache.DeletionEvicted,
+		"b":        cache.DeletionEvicted,
+	}, reasons())
+	recs := ca.RecentDeletions()
+	require.Equal(t, "expiring", recs[0].Key)
+	require.Equal(t, "b", recs[2].Key)
+	require.Equal(t, "evicted", recs[2].Reason.String())
+
+	cacheCfg.DeletionHistorySize = 0
+	untracked, err := cache.NewCacheService(cacheCfg, testLogger)
+	require.NoError(t, err)
+	closeOnCleanup(t, untracked)
+	untracked.Delete("a")
+	require.Equal(t, 0, len(untracked.RecentDeletions()))
+}
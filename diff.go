@@ -0,0 +1,82 @@
+package cache
+
+import (
+	"bufio"
+	"os"
+	"reflect"
+	"sort"
+
+	"github.com/patrickmn/go-cache"
+
+	"github.com/comfforts/errors"
+)
+
+// Diff lists how two cache files differ, a key present in both
+// can be in both ValueDiffers and ExpirationDiffers. Keys are sorted.
+type Diff struct {
+	OnlyInA           []string
+	OnlyInB           []string
+	ValueDiffers      []string
+	ExpirationDiffers []string
+}
+
+// DiffFiles compares the items of two cache files of any layout, expired items included.
+func DiffFiles(a, b string) (Diff, error) {
+	itemsA, err := readFileItems(a)
+	if err != nil {
+		return Diff{}, err
+	}
+	itemsB, err := readFileItems(b)
+	if err != nil {
+		return Diff{}, err
+	}
+
+	diff := Diff{
+		OnlyInA:           []string{},
+		OnlyInB:           []string{},
+		ValueDiffers:      []string{},
+		ExpirationDiffers: []string{},
+	}
+	for k, itemA := range itemsA {
+		itemB, ok := itemsB[k]
+		if !ok {
+			diff.OnlyInA = append(diff.OnlyInA, k)
+			continue
+		}
+		if !reflect.DeepEqual(itemA.Object, itemB.Object) {
+			diff.ValueDiffers = append(diff.ValueDiffers, k)
+		}
+		if itemA.Expiration != itemB.Expiration {
+			diff.ExpirationDiffers = append(diff.ExpirationDiffers, k)
+		}
+	}
+	for k := range itemsB {
+		if _, ok := itemsA[k]; !ok {
+			diff.OnlyInB = append(diff.OnlyInB, k)
+		}
+	}
+
+	sort.Strings(diff.OnlyInA)
+	sort.Strings(diff.OnlyInB)
+	sort.Strings(diff.ValueDiffers)
+	sort.Strings(diff.ExpirationDiffers)
+	return diff, nil
+}
+
+func readFileItems(filePath string) (map[string]cache.Item, error) {
+	file, err := os.Open(filePath)
+	if err != nil {
+		return nil, errors.WrapError(err, ERROR_OPENING_CACHE_FILE)
+	}
+	defer file.Close()
+
+	r, err := decompressReader(file)
+	if err != nil {
+		return nil, errors.WrapError(err, ERROR_LOADING_CACHE_FILE)
+	}
+	_, items, err := decodeAnyItems(bufio.NewReader(r))
+	if err != nil {
+		return nil, errors.WrapError(err, ERROR_LOADING_CACHE_FILE)
+	}
+	return items, nil
+}
@@ -0,0 +1,88 @@
+package cache_test
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/comfforts/cache"
+	"github.com/comfforts/logger"
+)
+
+func TestEncodeWorkers(t *testing.T) {
+	dataDir := t.TempDir()
+	testLogger := logger.NewTestAppLogger(dataDir)
+	cacheCfg := cache.CacheConfig{
+		DataDir:       dataDir,
+		MarshalFn:     UnmarshallTestStruct,
+		EncodeWorkers: 4,
+	}
+	ca, err := cache.NewCacheService(cacheCfg, testLogger)
+	require.NoError(t, err)
+	closeOnCleanup(t, ca)
+
+	expected := map[string]TestStruct{}
+	for i := 0; i < 1001; i++ {
+		key := fmt.Sprintf("key-%d", i)
+		expected[key] = TestStruct{Name: fmt.Sprintf("name-%d", i), Age: i}
+		err = ca.Set(key, expected[key], 5*time.Minute)
+		require.NoError(t, err)
+	}
+	err = ca.Set("chan", make(chan int), 5*time.Minute)
+	require.NoError(t, err)
+	err = ca.Purge()
+	require.NoError(t, err)
+
+	summary, err := cache.InspectFile(filepath.Join(dataDir, "cache.json"))
+	require.NoError(t, err)
+	require.Equal(t, len(expected), summary.Count)
+
+	loaded, err := cache.NewCacheService(cacheCfg, testLogger)
+	require.NoError(t, err)
+	closeOnCleanup(t, loaded)
+	require.Equal(t, len(expected), loaded.ItemCount())
+	for k, v := range expected {
+		cVal, _ := loaded.Get(k)
+		require.Equal(t, v, cVal, k)
+	}
+
+	cacheCfg.StrictEncoding = true
+	strict, err := cache.NewCacheService(cacheCfg, testLogger)
+	require.NoError(t, err)
+	closeOnCleanup(t, strict)
+	err = strict.Set("chan", make(chan int), 5*time.Minute)
+	require.NoError(t, err)
+	err = strict.Purge()
+	require.Error(t, err)
+}
+
+func BenchmarkEncodeWorkers(b *testing.B) {
+	for _, workers := range []int{1, 4} {
+		b.Run(fmt.Sprintf("EncodeWorkers=%d", workers), func(b *testing.B) {
+			dataDir := b.TempDir()
+			testLogger := logger.NewTestAppLogger(dataDir)
+			cacheCfg := cache.CacheConfig{
+				DataDir:       dataDir,
+				MarshalFn:     UnmarshallTestStruct,
+				EncodeWorkers: workers,
+			}
+			ca, err := cache.NewCacheService(cacheCfg, testLogger)
+			require.NoError(b, err)
+			closeOnCleanup(b, ca)
+			for i := 0; i < 100000; i++ {
+				err = ca.Set(fmt.Sprintf("key-%d", i), TestStruct{Name: strings.Repeat("x", 64), Age: i}, 5*time.Minute)
+				require.NoError(b, err)
+			}
+
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				err = ca.Purge()
+				require.NoError(b, err)
+			}
+		})
+	}
+}
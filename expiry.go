@@ -0,0 +1,152 @@
+package cache
+
+import (
+	"container/heap"
+	"runtime"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+type expiryEntry struct {
+	key string
+	at  int64
+}
+
+type expiryHeap []expiryEntry
+
+func (h expiryHeap) Len() int            { return len(h) }
+func (h expiryHeap) Less(i, j int) bool  { return h[i].at < h[j].at }
+func (h expiryHeap) Swap(i, j int)       { h[i], h[j] = h[j], h[i] }
+func (h *expiryHeap) Push(x interface{}) { *h = append(*h, x.(expiryEntry)) }
+func (h *expiryHeap) Pop() interface{} {
+	old := *h
+	e := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return e
+}
+
+// expiryIndex keeps the expiration each item was stored with until it's removed, so an
+// expired item the janitor hasn't removed yet can be told from a missing one. When batched,
+// for CleanupBatchSize, it also orders keys by expiration so the janitor can remove expired
+// items in batches. Entries superseded by a later track or removed are skipped when they
+// come due rather than taken out of the heap.
+type expiryIndex struct {
+	mu      sync.Mutex
+	batched bool
+	heap    expiryHeap
+	latest  map[string]int64
+}
+
+func newExpiryIndex(batched bool) *expiryIndex {
+	return &expiryIndex{batched: batched, latest: map[string]int64{}}
+}
+
+func (x *expiryIndex) track(key string, at int64) {
+	if x == nil {
+		return
+	}
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	x.latest[key] = at
+	if x.batched {
+		heap.Push(&x.heap, expiryEntry{key: key, at: at})
+	}
+}
+
+// expired reports whether key was stored with an expiration before now and hasn't been removed.
+func (x *expiryIndex) expired(key string, now int64) bool {
+	if x == nil {
+		return false
+	}
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	at, ok := x.latest[key]
+	return ok && at < now
+}
+
+func (x *expiryIndex) remove(key string) {
+	if x == nil {
+		return
+	}
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	delete(x.latest, key)
+}
+
+func (x *expiryIndex) reset() {
+	if x == nil {
+		return
+	}
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	x.heap = nil
+	x.latest = map[string]int64{}
+}
+
+// due pops up to n keys whose latest tracked expiration is before now.
+func (x *expiryIndex) due(now int64, n int) []string {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+
+	keys := []string{}
+	for len(keys) < n && len(x.heap) > 0 && x.heap[0].at < now {
+		e := heap.Pop(&x.heap).(expiryEntry)
+		if at, ok := x.latest[e.key]; ok && at == e.at {
+			delete(x.latest, e.key)
+			keys = append(keys, e.key)
+		}
+	}
+	return keys
+}
+
+// trackExpiry indexes key under the ttl it was stored with.
+func (c *cacheService) trackExpiry(key string, d time.Duration) {
+	if c.expiries == nil {
+		return
+	}
+	if d == USE_DEFAULT_EXPIRATION {
+		d = c.defaultExp
+	}
+	if d <= 0 {
+		c.expiries.remove(key)
+		return
+	}
+	c.expiries.track(key, time.Now().Add(d).UnixNano())
+}
+
+// cleanup is the janitor's pass, removing expired items CleanupBatchSize at a
+// time and releasing the lock between batches when a batch size is set.
+func (c *cacheService) cleanup() {
+	if c.CleanupBatchSize <= 0 {
+		c.deleteExpired()
+		return
+	}
+
+	removed := 0
+	for {
+		keys := c.expiries.due(time.Now().UnixNano(), c.CleanupBatchSize)
+		if len(keys) == 0 {
+			break
+		}
+		c.storeMu.Lock()
+		for _, k := range keys {
+			// items extended since they were indexed, by sliding expiration say, are reindexed
+			if _, exp, found := c.cache.GetWithExpiration(k); found {
+				if !exp.IsZero() {
+					c.expiries.track(k, exp.UnixNano())
+				}
+				continue
+			}
+			c.cache.Delete(k)
+			removed++
+		}
+		c.storeMu.Unlock()
+		runtime.Gosched()
+	}
+	if removed > 0 {
+		c.pruneBlobs()
+	}
+	c.Debug(DELETED_EXPIRED, zap.String("cacheDir", c.DataDir), zap.Int("count", removed))
+}
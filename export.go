@@ -0,0 +1,44 @@
+package cache
+
+import (
+	"encoding/csv"
+	"io"
+	"sort"
+
+	"go.uber.org/zap"
+
+	"github.com/comfforts/errors"
+)
+
+// ExportCSV writes live items as CSV rows sorted by key, each row is the key followed
+// by the cells columns returns for the item. The header is "key" followed by
+// the cells columns returns when called with an empty key and a nil value.
+func (c *cacheService) ExportCSV(w io.Writer, columns func(key string, value interface{}) []string) error {
+	items := c.items()
+	keys := make([]string, 0, len(items))
+	for k := range items {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	cw := csv.NewWriter(w)
+	err := cw.Write(append([]string{"key"}, columns("", nil)...))
+	if err != nil {
+		c.Error(ERROR_EXPORTING_CSV, zap.Error(err))
+		return errors.WrapError(err, ERROR_EXPORTING_CSV)
+	}
+	for _, k := range keys {
+		err = cw.Write(append([]string{k}, columns(k, items[k].Object)...))
+		if err != nil {
+			c.Error(ERROR_EXPORTING_CSV, zap.Error(err), zap.String("key", k))
+			return errors.WrapError(err, ERROR_EXPORTING_CSV)
+		}
+	}
+	cw.Flush()
+	if err := cw.Error(); err != nil {
+		c.Error(ERROR_EXPORTING_CSV, zap.Error(err))
+		return errors.WrapError(err, ERROR_EXPORTING_CSV)
+	}
+	c.Info("exported cache as csv", zap.Int("count", len(keys)), zap.String("cacheDir", c.DataDir))
+	return nil
+}
@@ -0,0 +1,166 @@
+package cache
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"io"
+	"time"
+
+	"github.com/patrickmn/go-cache"
+	"go.uber.org/zap"
+)
+
+// CACHE_FILE_VERSION is the layout version written to the cache file envelope.
+const CACHE_FILE_VERSION = 1
+
+// fileHeader leads every enveloped cache file so tooling can
+// summarize it without decoding the items.
+type fileHeader struct {
+	Version int       `json:"version"`
+	Count   int       `json:"count"`
+	SavedAt time.Time `json:"saved_at"`
+}
+
+func newFileHeader(count int) fileHeader {
+	return fileHeader{
+		Version: CACHE_FILE_VERSION,
+		Count:   count,
+		SavedAt: time.Now().UTC(),
+	}
+}
+
+// fileEnvelope is the cache file layout, files written before
+// versioning are a bare items map and still load.
+type fileEnvelope struct {
+	fileHeader
+	Items interface{} `json:"items"`
+}
+
+// fileItem is a persisted cache item, ExpiresAt and Encrypted are informational,
+// loading reads the numeric Expiration and recognizes encrypted values by shape.
+// StaleAt is the unix nano soft ttl deadline of items set with SetWithSoftHard.
+type fileItem struct {
+	Object     interface{}
+	Expiration int64
+	ExpiresAt  string `json:"expires_at,omitempty"`
+	Encrypted  bool   `json:"encrypted,omitempty"`
+	StaleAt    int64  `json:"stale_at,omitempty"`
+}
+
+func newFileItem(item cache.Item, staleAt int64) fileItem {
+	_, encrypted := item.Object.(encryptedValue)
+	return fileItem{
+		Object:     item.Object,
+		Expiration: item.Expiration,
+		ExpiresAt:  expiresAt(item.Expiration),
+		Encrypted:  encrypted,
+		StaleAt:    staleAt,
+	}
+}
+
+func fileItems(items map[string]cache.Item, staleAt map[string]int64) map[string]fileItem {
+	fi := make(map[string]fileItem, len(items))
+	for k, item := range items {
+		fi[k] = newFileItem(item, staleAt[k])
+	}
+	return fi
+}
+
+// splitFileItems returns the cache items of fi and the soft ttl deadlines saved with them.
+func splitFileItems(fi map[string]fileItem) (map[string]cache.Item, map[string]int64) {
+	items := make(map[string]cache.Item, len(fi))
+	staleAt := map[string]int64{}
+	for k, item := range fi {
+		items[k] = cache.Item{Object: item.Object, Expiration: item.Expiration}
+		if item.StaleAt > 0 {
+			staleAt[k] = item.StaleAt
+		}
+	}
+	return items, staleAt
+}
+
+// expiresAt formats a unix nano expiration as RFC3339, empty for items that never expire.
+func expiresAt(exp int64) string {
+	if exp <= 0 {
+		return ""
+	}
+	return time.Unix(0, exp).UTC().Format(time.RFC3339Nano)
+}
+
+// decodeEnvelope returns the version and raw items of an enveloped cache file, ok is false for legacy files.
+func decodeEnvelope(raw []byte) (int, json.RawMessage, bool) {
+	var env struct {
+		Version *int            `json:"version"`
+		Items   json.RawMessage `json:"items"`
+	}
+	if err := json.Unmarshal(raw, &env); err != nil || env.Version == nil || env.Items == nil {
+		return 0, nil, false
+	}
+	return *env.Version, env.Items, true
+}
+
+// rebaseExpirations shifts the expirations of items decoded from raw by the time since
+// the file was saved, when RelativeExpirations is set.
+func (c *cacheService) rebaseExpirations(raw []byte, items map[string]cache.Item) {
+	if !c.RelativeExpirations {
+		return
+	}
+	h, _ := readHeader(bufio.NewReader(bytes.NewReader(raw)))
+	if h == nil || h.SavedAt.IsZero() {
+		c.Info("cache file has no save time, loading expirations as absolute", zap.String("cacheDir", c.DataDir))
+		return
+	}
+
+	shift := time.Since(h.SavedAt).Nanoseconds()
+	for k, item := range items {
+		if item.Expiration > 0 {
+			item.Expiration += shift
+		}
+		if sv, ok := item.Object.(staleValue); ok {
+			sv.staleAt += shift
+			item.Object = sv
+		}
+		items[k] = item
+	}
+	c.Debug("rebased cache expirations", zap.String("cacheDir", c.DataDir), zap.Time("savedAt", h.SavedAt), zap.Duration("shift", time.Duration(shift)))
+}
+
+// skipUnencodable reports whether a save can go on without key after failing to encode it.
+func (c *cacheService) skipUnencodable(key string, err error) bool {
+	if c.StrictEncoding {
+		return false
+	}
+	c.Error(ERROR_ENCODING_CACHE_ITEM, zap.Error(err), zap.String("cacheDir", c.DataDir), zap.String("key", key))
+	return true
+}
+
+// encodableItems drops items the configured encoder can't encode, for formats
+// encoded in one go where a single bad value would fail the whole file.
+func (c *cacheService) encodableItems(items map[string]cache.Item) (map[string]cache.Item, error) {
+	if c.StrictEncoding {
+		return items, nil
+	}
+	for k, item := range items {
+		if err := c.newEncoder(io.Discard).Encode(c.blobs.resolve(item.Object)); err != nil {
+			c.skipUnencodable(k, err)
+			delete(items, k)
+		}
+	}
+	return items, nil
+}
+
+// fileOps is a semaphore bounding concurrent cache file saves and loads.
+type fileOps chan struct{}
+
+func newFileOps(n int) fileOps {
+	return make(fileOps, n)
+}
+
+func (f fileOps) acquire() {
+	f <- struct{}{}
+}
+
+func (f fileOps) release() {
+	<-f
+}
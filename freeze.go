@@ -0,0 +1,51 @@
+package cache
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"go.uber.org/zap"
+
+	"github.com/comfforts/errors"
+)
+
+// FROZEN_FILE_MODE is the read-only permission snapshots are written with.
+const FROZEN_FILE_MODE os.FileMode = 0444
+
+// Freeze writes the current items to a read-only snapshot at path in the cache file format.
+// Saves and clears only touch the cache file so the snapshot outlives them, and Freeze
+// itself refuses to replace an existing file.
+func (c *cacheService) Freeze(path string) error {
+	cacheFile := filepath.Join(c.DataDir, fmt.Sprintf("%s.json", c.CacheFileName))
+	if filepath.Clean(path) == filepath.Clean(cacheFile) {
+		c.Error(ERROR_FREEZE_CACHE_FILE, zap.String("path", path))
+		return ErrFreezeCacheFile
+	}
+
+	var buf bytes.Buffer
+	if err := c.encodeItems(&buf); err != nil {
+		c.Error(ERROR_FREEZING_CACHE, zap.Error(err), zap.String("path", path))
+		return errors.WrapError(err, ERROR_FREEZING_CACHE)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), os.ModePerm); err != nil {
+		return errors.WrapError(err, ERROR_CREATING_CACHE_DIR)
+	}
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, FROZEN_FILE_MODE)
+	if err != nil {
+		c.Error(ERROR_FREEZING_CACHE, zap.Error(err), zap.String("path", path))
+		return errors.WrapError(err, ERROR_FREEZING_CACHE)
+	}
+	_, err = buf.WriteTo(file)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		c.Error(ERROR_FREEZING_CACHE, zap.Error(err), zap.String("path", path))
+		return errors.WrapError(err, ERROR_FREEZING_CACHE)
+	}
+	c.Info("cache frozen", zap.String("path", path))
+	return nil
+}
@@ -0,0 +1,61 @@
+package cache_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/comfforts/cache"
+	"github.com/comfforts/logger"
+)
+
+func TestFreeze(t *testing.T) {
+	dataDir := t.TempDir()
+	testLogger := logger.NewTestAppLogger(dataDir)
+	cacheCfg := cache.CacheConfig{
+		DataDir:   dataDir,
+		MarshalFn: UnmarshallTestStruct,
+	}
+	ca, err := cache.NewCacheService(cacheCfg, testLogger)
+	require.NoError(t, err)
+	closeOnCleanup(t, ca)
+
+	err = ca.Set("john", TestStruct{Name: "John", Age: 34}, 5*time.Minute)
+	require.NoError(t, err)
+	snapshot := filepath.Join(dataDir, "audit", "snapshot.json")
+	err = ca.Freeze(snapshot)
+	require.NoError(t, err)
+
+	fStats, err := os.Stat(snapshot)
+	require.NoError(t, err)
+	require.Equal(t, os.FileMode(0444), fStats.Mode().Perm())
+
+	err = ca.Freeze(snapshot)
+	require.Error(t, err)
+	err = ca.Freeze(filepath.Join(dataDir, "cache.json"))
+	require.Equal(t, cache.ErrFreezeCacheFile, err)
+
+	err = ca.Set("jane", TestStruct{Name: "Jane", Age: 29}, 5*time.Minute)
+	require.NoError(t, err)
+	err = ca.Purge()
+	require.NoError(t, err)
+	err = ca.Clear()
+	require.NoError(t, err)
+
+	summary, err := cache.InspectFile(snapshot)
+	require.NoError(t, err)
+	require.Equal(t, 1, summary.Count)
+
+	cacheCfg.CacheFileName = "restored"
+	restored, err := cache.NewCacheService(cacheCfg, testLogger)
+	require.NoError(t, err)
+	closeOnCleanup(t, restored)
+	err = restored.LoadMerged([]string{snapshot})
+	require.NoError(t, err)
+	require.Equal(t, 1, restored.ItemCount())
+	cVal, _ := restored.Get("john")
+	require.Equal(t, TestStruct{Name: "John", Age: 34}, cVal)
+}
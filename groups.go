@@ -0,0 +1,91 @@
+package cache
+
+import (
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// groupIndex tracks which invalidation groups each item belongs to,
+// membership ends when the item is deleted, expires or is set again.
+type groupIndex struct {
+	mu      sync.Mutex
+	members map[string]map[string]struct{}
+	keys    map[string][]string
+}
+
+func newGroupIndex() *groupIndex {
+	return &groupIndex{
+		members: map[string]map[string]struct{}{},
+		keys:    map[string][]string{},
+	}
+}
+
+func (g *groupIndex) add(key string, groups []string) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	for _, group := range groups {
+		m, ok := g.members[group]
+		if !ok {
+			m = map[string]struct{}{}
+			g.members[group] = m
+		}
+		if _, ok := m[key]; !ok {
+			m[key] = struct{}{}
+			g.keys[key] = append(g.keys[key], group)
+		}
+	}
+}
+
+func (g *groupIndex) remove(key string) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	for _, group := range g.keys[key] {
+		delete(g.members[group], key)
+		if len(g.members[group]) == 0 {
+			delete(g.members, group)
+		}
+	}
+	delete(g.keys, key)
+}
+
+func (g *groupIndex) list(group string) []string {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	keys := make([]string, 0, len(g.members[group]))
+	for key := range g.members[group] {
+		keys = append(keys, key)
+	}
+	return keys
+}
+
+func (g *groupIndex) reset() {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	g.members = map[string]map[string]struct{}{}
+	g.keys = map[string][]string{}
+}
+
+// SetWithGroup sets the item and adds it to each of groups.
+func (c *cacheService) SetWithGroup(key string, value interface{}, d time.Duration, groups ...string) error {
+	if err := c.Set(key, value, d); err != nil {
+		return err
+	}
+	c.groups.add(key, groups)
+	return nil
+}
+
+// InvalidateGroup deletes every item in group and returns how many were deleted.
+func (c *cacheService) InvalidateGroup(group string) int {
+	keys := c.groups.list(group)
+	for _, key := range keys {
+		c.delete(key)
+	}
+	c.Debug("cache group invalidated", zap.String("group", group), zap.Int("count", len(keys)), zap.String("cacheDir", c.DataDir))
+	return len(keys)
+}
@@ -0,0 +1,72 @@
+package cache_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/comfforts/cache"
+	"github.com/comfforts/logger"
+)
+
+func TestInvalidateGroup(t *testing.T) {
+	dataDir := t.TempDir()
+	testLogger := logger.NewTestAppLogger(dataDir)
+	cacheCfg := cache.CacheConfig{
+		DataDir:   dataDir,
+		MarshalFn: UnmarshallTestStruct,
+	}
+	ca, err := cache.NewCacheService(cacheCfg, testLogger)
+	require.NoError(t, err)
+	closeOnCleanup(t, ca)
+
+	err = ca.SetWithGroup("order-1", TestStruct{Name: "John", Age: 1}, 5*time.Minute, "customer-1")
+	require.NoError(t, err)
+	err = ca.SetWithGroup("order-2", TestStruct{Name: "John", Age: 2}, 5*time.Minute, "customer-1", "region-west")
+	require.NoError(t, err)
+	err = ca.SetWithGroup("order-3", TestStruct{Name: "Jane", Age: 3}, 5*time.Minute, "customer-2", "region-west")
+	require.NoError(t, err)
+	err = ca.Set("ungrouped", TestStruct{Name: "Jack", Age: 4}, 5*time.Minute)
+	require.NoError(t, err)
+
+	require.Equal(t, 2, ca.InvalidateGroup("customer-1"))
+	cVal, _ := ca.Get("order-1")
+	require.Nil(t, cVal)
+	cVal, _ = ca.Get("order-2")
+	require.Nil(t, cVal)
+	cVal, _ = ca.Get("order-3")
+	require.Equal(t, TestStruct{Name: "Jane", Age: 3}, cVal)
+	cVal, _ = ca.Get("ungrouped")
+	require.Equal(t, TestStruct{Name: "Jack", Age: 4}, cVal)
+
+	// order-2 left region-west when it was deleted
+	require.Equal(t, 1, ca.InvalidateGroup("region-west"))
+	require.Equal(t, 0, ca.InvalidateGroup("customer-2"))
+	require.Equal(t, 0, ca.InvalidateGroup("unknown"))
+	require.Equal(t, 1, ca.ItemCount())
+
+	err = ca.SetWithGroup("expiring", TestStruct{Name: "Jill", Age: 5}, 50*time.Millisecond, "short")
+	require.NoError(t, err)
+	time.Sleep(100 * time.Millisecond)
+	ca.DeleteExpired()
+	require.Equal(t, 0, ca.InvalidateGroup("short"))
+
+	err = ca.SetWithGroup("deleted", TestStruct{Name: "Joe", Age: 6}, 5*time.Minute, "gone")
+	require.NoError(t, err)
+	ca.Delete("deleted")
+	require.Equal(t, 0, ca.InvalidateGroup("gone"))
+
+	// setting an item again replaces its groups
+	err = ca.SetWithGroup("moved", TestStruct{Name: "Jo", Age: 7}, 5*time.Minute, "old", "shared")
+	require.NoError(t, err)
+	err = ca.Set("moved", TestStruct{Name: "Jo", Age: 8}, 5*time.Minute)
+	require.NoError(t, err)
+	require.Equal(t, 0, ca.InvalidateGroup("old"))
+	cVal, _ = ca.Get("moved")
+	require.Equal(t, TestStruct{Name: "Jo", Age: 8}, cVal)
+	err = ca.SetWithGroup("moved", TestStruct{Name: "Jo", Age: 9}, 5*time.Minute, "new")
+	require.NoError(t, err)
+	require.Equal(t, 0, ca.InvalidateGroup("shared"))
+	require.Equal(t, 1, ca.InvalidateGroup("new"))
+}
@@ -0,0 +1,132 @@
+package cache
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// hotCache fronts the store for the most read keys. Reads are lock free,
+// promotions and invalidations serialize on mu and a generation counter
+// keeps a read that raced a write from promoting the old value. Eviction
+// is CLOCK, entries read since the hand last passed get a second chance,
+// and keys are only admitted on their second miss so one-off reads don't
+// churn the hot set.
+type hotCache struct {
+	entries sync.Map
+	mu      sync.Mutex
+	gen     atomic.Uint64
+	ring    []string
+	next    int
+	seen    map[string]struct{}
+}
+
+type hotEntry struct {
+	value interface{}
+	exp   time.Time
+	ref   atomic.Bool
+}
+
+func newHotCache(size int) *hotCache {
+	return &hotCache{
+		ring: make([]string, size),
+		seen: map[string]struct{}{},
+	}
+}
+
+func (h *hotCache) get(key string) (interface{}, time.Time, bool) {
+	if h == nil {
+		return nil, time.Time{}, false
+	}
+	v, ok := h.entries.Load(key)
+	if !ok {
+		return nil, time.Time{}, false
+	}
+	e := v.(*hotEntry)
+	if !e.exp.IsZero() && time.Now().After(e.exp) {
+		h.entries.Delete(key)
+		return nil, time.Time{}, false
+	}
+	if !e.ref.Load() {
+		e.ref.Store(true)
+	}
+	return e.value, e.exp, true
+}
+
+// generation is read before consulting the store so promote can tell whether a write happened since.
+func (h *hotCache) generation() uint64 {
+	if h == nil {
+		return 0
+	}
+	return h.gen.Load()
+}
+
+func (h *hotCache) promote(key string, value interface{}, exp time.Time, gen uint64) {
+	if h == nil {
+		return
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if gen != h.gen.Load() {
+		return
+	}
+	if _, ok := h.entries.Load(key); ok {
+		return
+	}
+	if _, ok := h.seen[key]; !ok {
+		if len(h.seen) >= 4*len(h.ring) {
+			h.seen = map[string]struct{}{}
+		}
+		h.seen[key] = struct{}{}
+		return
+	}
+	delete(h.seen, key)
+	// bounded sweep, after a full turn every reference bit is cleared
+	for i := 0; i <= len(h.ring); i++ {
+		old := h.ring[h.next]
+		if old == "" {
+			break
+		}
+		v, ok := h.entries.Load(old)
+		if !ok || !v.(*hotEntry).ref.Load() {
+			h.entries.Delete(old)
+			break
+		}
+		v.(*hotEntry).ref.Store(false)
+		h.next = (h.next + 1) % len(h.ring)
+	}
+	h.ring[h.next] = key
+	h.next = (h.next + 1) % len(h.ring)
+	h.entries.Store(key, &hotEntry{value: value, exp: exp})
+}
+
+func (h *hotCache) invalidate(key string) {
+	if h == nil {
+		return
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.gen.Add(1)
+	h.entries.Delete(key)
+}
+
+func (h *hotCache) reset() {
+	if h == nil {
+		return
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.gen.Add(1)
+	h.entries.Range(func(k, _ interface{}) bool {
+		h.entries.Delete(k)
+		return true
+	})
+	for i := range h.ring {
+		h.ring[i] = ""
+	}
+	h.next = 0
+	h.seen = map[string]struct{}{}
+}
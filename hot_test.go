@@ -0,0 +1,78 @@
+package cache_test
+
+import (
+	"fmt"
+	"math/rand"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/comfforts/cache"
+	"github.com/comfforts/logger"
+)
+
+func TestHotCache(t *testing.T) {
+	dataDir := t.TempDir()
+	testLogger := logger.NewTestAppLogger(dataDir)
+	cacheCfg := cache.CacheConfig{
+		DataDir:      dataDir,
+		MarshalFn:    UnmarshallTestStruct,
+		HotCacheSize: 2,
+	}
+	ca, err := cache.NewCacheService(cacheCfg, testLogger)
+	require.NoError(t, err)
+	closeOnCleanup(t, ca)
+
+	err = ca.Set("hot", TestStruct{Name: "John", Age: 34}, 100*time.Millisecond)
+	require.NoError(t, err)
+	for i := 0; i < 3; i++ {
+		cVal, _ := ca.Get("hot")
+		require.Equal(t, TestStruct{Name: "John", Age: 34}, cVal)
+	}
+
+	ca.Delete("hot")
+	cVal, _ := ca.Get("hot")
+	require.Nil(t, cVal)
+
+	err = ca.Set("hot", TestStruct{Name: "Jane", Age: 29}, 100*time.Millisecond)
+	require.NoError(t, err)
+	cVal, _ = ca.Get("hot")
+	require.Equal(t, TestStruct{Name: "Jane", Age: 29}, cVal)
+
+	time.Sleep(150 * time.Millisecond)
+	cVal, _ = ca.Get("hot")
+	require.Nil(t, cVal)
+}
+
+func BenchmarkSkewedGet(b *testing.B) {
+	for _, size := range []int{0, 64} {
+		b.Run(fmt.Sprintf("HotCacheSize=%d", size), func(b *testing.B) {
+			dataDir := b.TempDir()
+			testLogger := logger.NewTestAppLogger(dataDir)
+			cacheCfg := cache.CacheConfig{
+				DataDir:      dataDir,
+				MarshalFn:    UnmarshallTestStruct,
+				HotCacheSize: size,
+			}
+			ca, err := cache.NewCacheService(cacheCfg, testLogger)
+			require.NoError(b, err)
+			closeOnCleanup(b, ca)
+
+			keys := make([]string, 1000)
+			for i := range keys {
+				keys[i] = fmt.Sprintf("key-%d", i)
+				err = ca.Set(keys[i], TestStruct{Name: keys[i], Age: i}, 5*time.Minute)
+				require.NoError(b, err)
+			}
+
+			b.ResetTimer()
+			b.RunParallel(func(pb *testing.PB) {
+				zipf := rand.NewZipf(rand.New(rand.NewSource(rand.Int63())), 1.5, 1, uint64(len(keys)-1))
+				for pb.Next() {
+					ca.Get(keys[zipf.Uint64()])
+				}
+			})
+		})
+	}
+}
@@ -0,0 +1,165 @@
+package cache
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"io"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/patrickmn/go-cache"
+
+	"github.com/comfforts/errors"
+)
+
+// FileSummary describes a cache file, FromHeader is false when it
+// was built by decoding every item of a file without a header.
+type FileSummary struct {
+	Version    int
+	Count      int
+	SavedAt    time.Time
+	FromHeader bool
+}
+
+// PersistPreview is what a save would write, Keys are sorted.
+type PersistPreview struct {
+	ItemCount int
+	Bytes     int64
+	Keys      []string
+}
+
+// PreviewPersist encodes the cache as a save would without writing the file or flushing memory.
+func (c *cacheService) PreviewPersist() (PersistPreview, error) {
+	var buf bytes.Buffer
+	if err := c.encodeItems(&buf); err != nil {
+		return PersistPreview{}, errors.WrapError(err, ERROR_SAVING_CACHE_FILE)
+	}
+	size := int64(buf.Len())
+
+	// decoded back so the keys are the ones written, without any left out
+	items, err := c.decodeItems(&buf)
+	if err != nil {
+		return PersistPreview{}, errors.WrapError(err, ERROR_LOADING_CACHE_FILE)
+	}
+	keys := make([]string, 0, len(items))
+	for k := range items {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return PersistPreview{ItemCount: len(keys), Bytes: size, Keys: keys}, nil
+}
+
+// InspectFile summarizes the cache file at filePath, reading only its header when present.
+func InspectFile(filePath string) (*FileSummary, error) {
+	summary, err := inspect(filePath, readHeader)
+	if err != nil || summary != nil {
+		return summary, err
+	}
+	return inspect(filePath, summarizeItems)
+}
+
+func inspect(filePath string, fn func(r *bufio.Reader) (*FileSummary, error)) (*FileSummary, error) {
+	file, err := os.Open(filePath)
+	if err != nil {
+		return nil, errors.WrapError(err, ERROR_OPENING_CACHE_FILE)
+	}
+	defer file.Close()
+
+	r, err := decompressReader(file)
+	if err != nil {
+		return nil, errors.WrapError(err, ERROR_LOADING_CACHE_FILE)
+	}
+	summary, err := fn(bufio.NewReader(r))
+	if err != nil {
+		return nil, errors.WrapError(err, ERROR_LOADING_CACHE_FILE)
+	}
+	if summary != nil && summary.SavedAt.IsZero() {
+		if fStats, err := file.Stat(); err == nil {
+			summary.SavedAt = fStats.ModTime().UTC()
+		}
+	}
+	return summary, nil
+}
+
+// readHeader reads the leading header fields of a JSON cache file and stops at the first
+// other field, it returns nil without an error when the file has no header.
+func readHeader(r *bufio.Reader) (*FileSummary, error) {
+	if isBinary(r) {
+		return nil, nil
+	}
+
+	dec := json.NewDecoder(r)
+	if tok, err := dec.Token(); err != nil || tok != json.Delim('{') {
+		return nil, nil
+	}
+	var h struct {
+		Version *int
+		Count   *int
+		SavedAt time.Time
+	}
+	for dec.More() {
+		tok, err := dec.Token()
+		if err != nil {
+			return nil, nil
+		}
+		key, _ := tok.(string)
+		switch key {
+		case "version":
+			err = dec.Decode(&h.Version)
+		case "count":
+			err = dec.Decode(&h.Count)
+		case "saved_at":
+			err = dec.Decode(&h.SavedAt)
+		default:
+			if h.Version == nil || h.Count == nil {
+				return nil, nil
+			}
+			return &FileSummary{
+				Version:    *h.Version,
+				Count:      *h.Count,
+				SavedAt:    h.SavedAt,
+				FromHeader: true,
+			}, nil
+		}
+		if err != nil {
+			return nil, nil
+		}
+	}
+	return nil, nil
+}
+
+// summarizeItems decodes every item of files written without a header.
+func summarizeItems(r *bufio.Reader) (*FileSummary, error) {
+	version, items, err := decodeAnyItems(r)
+	if err != nil {
+		return nil, err
+	}
+	return &FileSummary{Version: version, Count: len(items)}, nil
+}
+
+// decodeAnyItems decodes a cache file of any layout without a service, values stay
+// as decoded from JSON. The version is 0 for legacy files.
+func decodeAnyItems(r *bufio.Reader) (int, map[string]cache.Item, error) {
+	if isBinary(r) {
+		return decodeBinary(r)
+	}
+
+	raw, err := io.ReadAll(r)
+	if err != nil {
+		return 0, nil, err
+	}
+	if items, _, ok := decodeDedupFile(raw); ok {
+		return CACHE_FILE_VERSION, items, nil
+	}
+	version, body, ok := decodeEnvelope(raw)
+	if !ok {
+		body = raw
+	}
+	items := map[string]cache.Item{}
+	if err := json.Unmarshal(body, &items); err != nil {
+		return 0, nil, err
+	}
+	return version, items, nil
+}
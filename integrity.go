@@ -0,0 +1,78 @@
+package cache
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"go.uber.org/zap"
+)
+
+// CHECKSUM_FILE_SUFFIX names the sidecar holding the hex sha256 of the cache file.
+const CHECKSUM_FILE_SUFFIX = ".sha256"
+
+func writeChecksum(filePath string, sum [sha256.Size]byte) error {
+	return os.WriteFile(filePath+CHECKSUM_FILE_SUFFIX, []byte(hex.EncodeToString(sum[:])), 0644)
+}
+
+// refreshChecksum rewrites the sidecar for a cache file replaced outside writeFile, like a
+// cloud download, so the check doesn't compare it with the previous save. The sidecar is
+// removed when the file can't be hashed.
+func (c *cacheService) refreshChecksum(filePath string) {
+	if c.IntegrityCheckInterval <= 0 {
+		return
+	}
+	body, err := os.ReadFile(filePath)
+	if err == nil {
+		err = writeChecksum(filePath, sha256.Sum256(body))
+	}
+	if err != nil {
+		c.Error("error saving cache file checksum", zap.Error(err), zap.String("filePath", filePath))
+		removeChecksum(filePath)
+	}
+}
+
+func removeChecksum(filePath string) {
+	_ = os.Remove(filePath + CHECKSUM_FILE_SUFFIX)
+}
+
+func (c *cacheService) startIntegrityCheck() {
+	if c.IntegrityCheckInterval <= 0 {
+		return
+	}
+	c.integrity = newJanitor(c.IntegrityCheckInterval)
+	go c.integrity.run(c.checkIntegrity)
+}
+
+// checkIntegrity compares the cache file with its checksum sidecar, there's nothing
+// to check until a save wrote both.
+func (c *cacheService) checkIntegrity() {
+	filePath := filepath.Join(c.DataDir, fmt.Sprintf("%s.json", c.CacheFileName))
+
+	// holds off saves so a half written file isn't reported
+	c.fileOps.acquire()
+	want, err := os.ReadFile(filePath + CHECKSUM_FILE_SUFFIX)
+	var body []byte
+	if err == nil {
+		body, err = os.ReadFile(filePath)
+	}
+	c.fileOps.release()
+	if err != nil {
+		if !os.IsNotExist(err) {
+			c.Error("error reading cache file for integrity check", zap.Error(err), zap.String("filePath", filePath))
+		}
+		return
+	}
+
+	sum := sha256.Sum256(body)
+	if bytes.Equal(bytes.TrimSpace(want), []byte(hex.EncodeToString(sum[:]))) {
+		return
+	}
+	c.Error(ERROR_CHECKSUM_MISMATCH, zap.String("filePath", filePath), zap.ByteString("checksum", want))
+	if c.OnIntegrityFailure != nil {
+		c.OnIntegrityFailure(filePath, ErrChecksumMismatch)
+	}
+}
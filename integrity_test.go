@@ -0,0 +1,131 @@
+package cache_test
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	gocache "github.com/patrickmn/go-cache"
+	"github.com/stretchr/testify/require"
+
+	"github.com/comfforts/cache"
+	"github.com/comfforts/logger"
+)
+
+func TestIntegrityCheck(t *testing.T) {
+	dataDir := t.TempDir()
+	testLogger := logger.NewTestAppLogger(dataDir)
+	var failures atomic.Int64
+	cacheCfg := cache.CacheConfig{
+		DataDir:                dataDir,
+		MarshalFn:              UnmarshallTestStruct,
+		IntegrityCheckInterval: 20 * time.Millisecond,
+		OnIntegrityFailure: func(filePath string, err error) {
+			require.Equal(t, cache.ErrChecksumMismatch, err)
+			failures.Add(1)
+		},
+	}
+	ca, err := cache.NewCacheService(cacheCfg, testLogger)
+	require.NoError(t, err)
+	closeOnCleanup(t, ca)
+
+	err = ca.Set("test", TestStruct{Name: "John", Age: 34}, 5*time.Minute)
+	require.NoError(t, err)
+	err = ca.Purge()
+	require.NoError(t, err)
+	filePath := filepath.Join(dataDir, "cache.json")
+	_, err = os.Stat(filePath + cache.CHECKSUM_FILE_SUFFIX)
+	require.NoError(t, err)
+
+	time.Sleep(100 * time.Millisecond)
+	require.Equal(t, int64(0), failures.Load())
+
+	body, err := os.ReadFile(filePath)
+	require.NoError(t, err)
+	body[len(body)/2] ^= 0xff
+	err = os.WriteFile(filePath, body, 0644)
+	require.NoError(t, err)
+
+	require.Eventually(t, func() bool {
+		return failures.Load() > 0
+	}, time.Second, 10*time.Millisecond)
+
+	err = ca.Reset(true)
+	require.NoError(t, err)
+	err = ca.Clear()
+	require.NoError(t, err)
+}
+
+func TestIntegrityAfterFileReplaced(t *testing.T) {
+	exp := time.Now().Add(5 * time.Minute).UnixNano()
+	body, err := json.Marshal(map[string]interface{}{
+		"version": 1,
+		"items": map[string]gocache.Item{
+			"test": {Object: TestStruct{Name: "John", Age: 34}, Expiration: exp},
+		},
+	})
+	require.NoError(t, err)
+	corrupt := append(body[:len(body)-10:len(body)-10], `{"Name":`...)
+
+	for _, name := range []string{"cloud download", "corrupt fallback", "repaired"} {
+		t.Run(name, func(t *testing.T) {
+			dataDir := t.TempDir()
+			testLogger := logger.NewTestAppLogger(dataDir)
+			var failures atomic.Int64
+			cacheCfg := cache.CacheConfig{
+				DataDir:                dataDir,
+				MarshalFn:              UnmarshallTestStruct,
+				IntegrityCheckInterval: 20 * time.Millisecond,
+				RepairOnLoad:           name == "repaired",
+				OnIntegrityFailure: func(filePath string, err error) {
+					failures.Add(1)
+				},
+			}
+			client := newFakeCloudClient()
+			client.put("test-bucket", dataDir, "cache.json", body)
+			cloudCfg := cache.CacheStorageConfig{
+				Bucket:                 "test-bucket",
+				CloudClient:            client,
+				CloudFallbackOnCorrupt: true,
+			}
+
+			// the sidecar is left from an earlier save of different contents
+			filePath := filepath.Join(dataDir, "cache.json")
+			err := os.WriteFile(filePath+cache.CHECKSUM_FILE_SUFFIX, []byte(fmt.Sprintf("%x", sha256.Sum256(nil))), 0644)
+			require.NoError(t, err)
+			if name != "cloud download" {
+				err = os.WriteFile(filePath, corrupt, 0644)
+				require.NoError(t, err)
+			}
+
+			var ca cache.CacheService
+			if name == "repaired" {
+				ca, err = cache.NewCacheService(cacheCfg, testLogger)
+			} else {
+				ca, err = cache.NewWithCloudBackup(cacheCfg, cloudCfg, testLogger)
+			}
+			require.NoError(t, err)
+			closeOnCleanup(t, ca)
+			cVal, _ := ca.Get("test")
+			if name != "repaired" {
+				require.Equal(t, TestStruct{Name: "John", Age: 34}, cVal)
+			}
+
+			loaded, err := os.ReadFile(filePath)
+			require.NoError(t, err)
+			sum := sha256.Sum256(loaded)
+			want, err := os.ReadFile(filePath + cache.CHECKSUM_FILE_SUFFIX)
+			require.NoError(t, err)
+			require.Equal(t, hex.EncodeToString(sum[:]), string(want))
+
+			time.Sleep(100 * time.Millisecond)
+			require.Equal(t, int64(0), failures.Load())
+		})
+	}
+}
@@ -0,0 +1,49 @@
+package cache
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// janitor periodically removes expired items. go-cache's own janitor is only
+// stopped by a finalizer, so the service owns and stops its janitor explicitly.
+type janitor struct {
+	interval time.Duration
+	stop     chan struct{}
+	done     chan struct{}
+	once     sync.Once
+	paused   atomic.Bool
+}
+
+func newJanitor(interval time.Duration) *janitor {
+	return &janitor{
+		interval: interval,
+		stop:     make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+}
+
+func (j *janitor) run(clean func()) {
+	defer close(j.done)
+
+	ticker := time.NewTicker(j.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			if !j.paused.Load() {
+				clean()
+			}
+		case <-j.stop:
+			return
+		}
+	}
+}
+
+func (j *janitor) close() {
+	j.once.Do(func() {
+		close(j.stop)
+	})
+	<-j.done
+}
@@ -0,0 +1,91 @@
+package cache_test
+
+import (
+	"fmt"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/comfforts/cache"
+	"github.com/comfforts/logger"
+)
+
+func TestJanitorNoGoroutineLeak(t *testing.T) {
+	dataDir := t.TempDir()
+	testLogger := logger.NewTestAppLogger(dataDir)
+	cacheCfg := cache.CacheConfig{
+		DataDir:                dataDir,
+		MarshalFn:              UnmarshallTestStruct,
+		DefaultCleanupInterval: 10 * time.Millisecond,
+	}
+
+	// the first log write starts the log file's own goroutine, warm it up
+	// before counting
+	ca, err := cache.NewCacheService(cacheCfg, testLogger)
+	require.NoError(t, err)
+	err = ca.Clear()
+	require.NoError(t, err)
+
+	baseline := runtime.NumGoroutine()
+	for i := 0; i < 50; i++ {
+		ca, err := cache.NewCacheService(cacheCfg, testLogger)
+		require.NoError(t, err)
+
+		err = ca.Clear()
+		require.NoError(t, err)
+	}
+
+	deadline := time.Now().Add(time.Second)
+	for runtime.NumGoroutine() > baseline && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	require.LessOrEqual(t, runtime.NumGoroutine(), baseline)
+}
+
+func TestCleanupBatchSize(t *testing.T) {
+	dataDir := t.TempDir()
+	testLogger := logger.NewTestAppLogger(dataDir)
+	cacheCfg := cache.CacheConfig{
+		DataDir:                dataDir,
+		MarshalFn:              UnmarshallTestStruct,
+		DefaultCleanupInterval: 20 * time.Millisecond,
+		CleanupBatchSize:       100,
+		DeletionHistorySize:    5000,
+	}
+	ca, err := cache.NewCacheService(cacheCfg, testLogger)
+	require.NoError(t, err)
+	closeOnCleanup(t, ca)
+
+	ca.PauseCleanup()
+	for i := 0; i < 5000; i++ {
+		err = ca.Set(fmt.Sprintf("key-%d", i), TestStruct{Name: "John", Age: i}, 50*time.Millisecond)
+		require.NoError(t, err)
+	}
+	err = ca.Set("forever", TestStruct{Name: "Jane", Age: 29}, cache.NO_EXPIRATION)
+	require.NoError(t, err)
+	err = ca.Set("later", TestStruct{Name: "Jack", Age: 41}, 5*time.Minute)
+	require.NoError(t, err)
+	time.Sleep(60 * time.Millisecond)
+	require.Equal(t, 2, ca.ItemCount())
+	require.Equal(t, 0, len(ca.RecentDeletions()))
+
+	// readers keep getting through while the expired items are removed
+	var longest time.Duration
+	ca.ResumeCleanup()
+	deadline := time.Now().Add(5 * time.Second)
+	for len(ca.RecentDeletions()) < 5000 && time.Now().Before(deadline) {
+		start := time.Now()
+		_, _, ok := ca.Peek("forever")
+		require.True(t, ok)
+		if took := time.Since(start); took > longest {
+			longest = took
+		}
+	}
+	require.Equal(t, 2, ca.ItemCount())
+	t.Logf("longest read during cleanup %s", longest)
+	require.Less(t, longest, 100*time.Millisecond)
+	cVal, _ := ca.Get("later")
+	require.Equal(t, TestStruct{Name: "Jack", Age: 41}, cVal)
+}
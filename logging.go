@@ -0,0 +1,40 @@
+package cache
+
+import (
+	"go.uber.org/zap/zapcore"
+
+	"github.com/comfforts/logger"
+)
+
+// LogConfig is the minimal logging setup for callers that don't build their own logger.
+// Level is one of debug, info, warn or error and defaults to debug.
+type LogConfig struct {
+	Level    string
+	FilePath string
+}
+
+func newLogger(logCfg LogConfig) (logger.AppLogger, error) {
+	level := logger.DEFAULT_LOG_LEVEL
+	if logCfg.Level != "" {
+		var err error
+		level, err = zapcore.ParseLevel(logCfg.Level)
+		if err != nil {
+			return nil, ErrInvalidLogLevel
+		}
+	}
+
+	return logger.NewAppLogger(&logger.AppLoggerConfig{
+		FilePath: logCfg.FilePath,
+		Name:     "cache",
+		Level:    level,
+	}), nil
+}
+
+// NewCacheServiceWithLogConfig builds the logger from logCfg, otherwise it's NewCacheService.
+func NewCacheServiceWithLogConfig(cfg CacheConfig, logCfg LogConfig) (*cacheService, error) {
+	l, err := newLogger(logCfg)
+	if err != nil {
+		return nil, err
+	}
+	return NewCacheService(cfg, l)
+}
@@ -0,0 +1,146 @@
+package cache
+
+import (
+	"container/list"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// accessTracker keeps keys in least recently used order, it's only
+// allocated when MaxItems is set so a nil tracker is a valid no-op.
+type accessTracker struct {
+	mu    sync.Mutex
+	order *list.List
+	index map[string]*list.Element
+}
+
+type accessEntry struct {
+	key string
+	at  time.Time
+}
+
+func newAccessTracker() *accessTracker {
+	return &accessTracker{
+		order: list.New(),
+		index: map[string]*list.Element{},
+	}
+}
+
+func (a *accessTracker) touch(key string) {
+	if a == nil {
+		return
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if el, ok := a.index[key]; ok {
+		el.Value.(*accessEntry).at = time.Now()
+		a.order.MoveToBack(el)
+		return
+	}
+	a.index[key] = a.order.PushBack(&accessEntry{key: key, at: time.Now()})
+}
+
+func (a *accessTracker) remove(key string) {
+	if a == nil {
+		return
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if el, ok := a.index[key]; ok {
+		a.order.Remove(el)
+		delete(a.index, key)
+	}
+}
+
+func (a *accessTracker) oldest() (string, bool) {
+	if a == nil {
+		return "", false
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	el := a.order.Front()
+	if el == nil {
+		return "", false
+	}
+	return el.Value.(*accessEntry).key, true
+}
+
+func (a *accessTracker) lastAccess(key string) (time.Time, bool) {
+	if a == nil {
+		return time.Time{}, false
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	el, ok := a.index[key]
+	if !ok {
+		return time.Time{}, false
+	}
+	return el.Value.(*accessEntry).at, true
+}
+
+func (a *accessTracker) reset() {
+	if a == nil {
+		return
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	a.order.Init()
+	a.index = map[string]*list.Element{}
+}
+
+// setBounded holds the store exclusively so the capacity check
+// and the add can't interleave with other writers.
+func (c *cacheService) setBounded(key string, value interface{}, d time.Duration, onlyNew bool) error {
+	c.storeMu.Lock()
+	defer c.storeMu.Unlock()
+
+	if _, found := c.cache.Get(key); !found {
+		if err := c.makeRoom(); err != nil {
+			return err
+		}
+	}
+
+	err := c.storeItem(key, c.blobs.intern(value), c.storeTTL(d), onlyNew)
+	if err != nil {
+		return err
+	}
+	c.access.touch(key)
+	return nil
+}
+
+// makeRoom evicts least recently used items until a new key fits under MaxItems,
+// callers hold storeMu exclusively.
+func (c *cacheService) makeRoom() error {
+	if c.MaxItems <= 0 || c.cache.ItemCount() < c.MaxItems {
+		return nil
+	}
+	c.cache.DeleteExpired()
+	for c.cache.ItemCount() >= c.MaxItems {
+		if c.RejectOnFull {
+			return ErrCacheFull
+		}
+		oldest, ok := c.access.oldest()
+		if !ok {
+			break
+		}
+		c.deletions.expect(oldest, DeletionEvicted)
+		c.cache.Delete(oldest)
+		c.deletions.done(oldest)
+		// eviction callback only fires for keys still in the store
+		c.access.remove(oldest)
+		c.Debug("evicted least recently used item", zap.String("key", oldest), zap.String("cacheDir", c.DataDir))
+	}
+	return nil
+}
+
+// LastAccess returns when key was last set or read, it's only tracked when MaxItems is set.
+func (c *cacheService) LastAccess(key string) (time.Time, bool) {
+	return c.access.lastAccess(key)
+}
@@ -0,0 +1,119 @@
+package cache_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/comfforts/cache"
+	"github.com/comfforts/logger"
+)
+
+func TestMaxItems(t *testing.T) {
+	t.Run("evicts least recently used", func(t *testing.T) {
+		dataDir := t.TempDir()
+		testLogger := logger.NewTestAppLogger(dataDir)
+		cacheCfg := cache.CacheConfig{
+			DataDir:   dataDir,
+			MarshalFn: UnmarshallTestStruct,
+			MaxItems:  2,
+		}
+		ca, err := cache.NewCacheService(cacheCfg, testLogger)
+		require.NoError(t, err)
+		closeOnCleanup(t, ca)
+
+		err = ca.Set("john", TestStruct{Name: "John", Age: 34}, 5*time.Minute)
+		require.NoError(t, err)
+		err = ca.Set("jane", TestStruct{Name: "Jane", Age: 29}, 5*time.Minute)
+		require.NoError(t, err)
+
+		cVal, _ := ca.Get("john")
+		require.Equal(t, TestStruct{Name: "John", Age: 34}, cVal)
+
+		err = ca.Set("jim", TestStruct{Name: "Jim", Age: 41}, 5*time.Minute)
+		require.NoError(t, err)
+		require.Equal(t, 2, ca.ItemCount())
+
+		cVal, _ = ca.Get("jane")
+		require.Nil(t, cVal)
+		cVal, _ = ca.Get("john")
+		require.Equal(t, TestStruct{Name: "John", Age: 34}, cVal)
+	})
+
+	t.Run("rejects when full", func(t *testing.T) {
+		dataDir := t.TempDir()
+		testLogger := logger.NewTestAppLogger(dataDir)
+		cacheCfg := cache.CacheConfig{
+			DataDir:      dataDir,
+			MarshalFn:    UnmarshallTestStruct,
+			MaxItems:     2,
+			RejectOnFull: true,
+		}
+		ca, err := cache.NewCacheService(cacheCfg, testLogger)
+		require.NoError(t, err)
+		closeOnCleanup(t, ca)
+
+		err = ca.Set("john", TestStruct{Name: "John", Age: 34}, 5*time.Minute)
+		require.NoError(t, err)
+		err = ca.Set("jane", TestStruct{Name: "Jane", Age: 29}, 5*time.Minute)
+		require.NoError(t, err)
+
+		err = ca.Set("jim", TestStruct{Name: "Jim", Age: 41}, 5*time.Minute)
+		require.Equal(t, cache.ErrCacheFull, err)
+		require.Equal(t, 2, ca.ItemCount())
+
+		cVal, _ := ca.Get("jim")
+		require.Nil(t, cVal)
+		cVal, _ = ca.Get("john")
+		require.Equal(t, TestStruct{Name: "John", Age: 34}, cVal)
+		cVal, _ = ca.Get("jane")
+		require.Equal(t, TestStruct{Name: "Jane", Age: 29}, cVal)
+
+		ca.Delete("john")
+		err = ca.Set("jim", TestStruct{Name: "Jim", Age: 41}, 5*time.Minute)
+		require.NoError(t, err)
+	})
+}
+
+func TestLastAccess(t *testing.T) {
+	dataDir := t.TempDir()
+	testLogger := logger.NewTestAppLogger(dataDir)
+	cacheCfg := cache.CacheConfig{
+		DataDir:   dataDir,
+		MarshalFn: UnmarshallTestStruct,
+		MaxItems:  10,
+	}
+	ca, err := cache.NewCacheService(cacheCfg, testLogger)
+	require.NoError(t, err)
+	closeOnCleanup(t, ca)
+
+	err = ca.Set("test", TestStruct{Name: "John", Age: 34}, 5*time.Minute)
+	require.NoError(t, err)
+	setAt, ok := ca.LastAccess("test")
+	require.Equal(t, true, ok)
+
+	time.Sleep(10 * time.Millisecond)
+	cVal, _ := ca.Get("test")
+	require.Equal(t, TestStruct{Name: "John", Age: 34}, cVal)
+	readAt, ok := ca.LastAccess("test")
+	require.Equal(t, true, ok)
+	require.Equal(t, true, readAt.After(setAt))
+
+	_, _, ok = ca.Peek("test")
+	require.Equal(t, true, ok)
+	peekedAt, _ := ca.LastAccess("test")
+	require.Equal(t, readAt, peekedAt)
+
+	_, ok = ca.LastAccess("missing")
+	require.Equal(t, false, ok)
+
+	cacheCfg.MaxItems = 0
+	ca, err = cache.NewCacheService(cacheCfg, logger.NewTestAppLogger(t.TempDir()))
+	require.NoError(t, err)
+	closeOnCleanup(t, ca)
+	err = ca.Set("test", TestStruct{Name: "John", Age: 34}, 5*time.Minute)
+	require.NoError(t, err)
+	_, ok = ca.LastAccess("test")
+	require.Equal(t, false, ok)
+}
@@ -0,0 +1,223 @@
+package cache
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"strconv"
+	"sync"
+
+	"github.com/patrickmn/go-cache"
+	"go.uber.org/zap"
+
+	"github.com/comfforts/errors"
+)
+
+// marshalledValue holds a value encoded by Set when StoreMarshalled is set,
+// it encodes as the raw JSON so saves don't marshal it again.
+type marshalledValue []byte
+
+func (m marshalledValue) MarshalJSON() ([]byte, error) {
+	return m, nil
+}
+
+func (c *cacheService) encodeValue(value interface{}) (interface{}, error) {
+	if !c.StoreMarshalled {
+		return value, nil
+	}
+	body, err := json.Marshal(value)
+	if err != nil {
+		return nil, errors.WrapError(err, ERROR_MARSHALLING_CACHE_OBJECT)
+	}
+	return marshalledValue(body), nil
+}
+
+// resolve turns a stored value back into what the caller set.
+func (c *cacheService) resolve(v interface{}) interface{} {
+	val, err := c.decodeStored(v)
+	if err != nil {
+		c.Error("error decoding stored value", zap.Error(err))
+		return nil
+	}
+	return val
+}
+
+func (c *cacheService) decodeStored(v interface{}) (interface{}, error) {
+	v = c.blobs.resolve(v)
+	if _, ok := v.(marshalledValue); !ok {
+		return v, nil
+	}
+
+	p, err := c.decodeData(v)
+	if err != nil {
+		return nil, err
+	}
+	return c.marshal(p)
+}
+
+// decodeData turns a stored value back into plain data without the MarshalFn,
+// for values the cache updates itself like floats and counters.
+func (c *cacheService) decodeData(v interface{}) (interface{}, error) {
+	v = c.blobs.resolve(v)
+	m, ok := v.(marshalledValue)
+	if !ok {
+		return v, nil
+	}
+
+	var p interface{}
+	if err := json.Unmarshal(m, &p); err != nil {
+		return nil, errors.WrapError(err, ERROR_UNMARSHALLING_CACHE_JSON)
+	}
+	return p, nil
+}
+
+// GetRaw returns key's value as JSON, the stored encoding as is when StoreMarshalled is set.
+func (c *cacheService) GetRaw(key string) (json.RawMessage, bool) {
+	c.storeMu.RLock()
+	val, ok := c.cache.Get(key)
+	c.storeMu.RUnlock()
+	if !ok {
+		return nil, false
+	}
+
+	val = c.blobs.resolve(val)
+	if m, ok := val.(marshalledValue); ok {
+		return json.RawMessage(m), true
+	}
+	body, err := json.Marshal(val)
+	if err != nil {
+		c.Error(ERROR_MARSHALLING_CACHE_OBJECT, zap.Error(err), zap.String("key", key))
+		return nil, false
+	}
+	return body, true
+}
+
+// LazyItems returns live items with values decoded only when their thunk is called,
+// so iterating keys doesn't pay for decoding values that are stored marshalled.
+func (c *cacheService) LazyItems() map[string]func() (interface{}, error) {
+	c.storeMu.RLock()
+	items := c.cache.Items()
+	c.storeMu.RUnlock()
+
+	thunks := make(map[string]func() (interface{}, error), len(items))
+	for k, item := range items {
+		obj := item.Object
+		thunks[k] = func() (interface{}, error) {
+			return c.decodeStored(obj)
+		}
+	}
+	return thunks
+}
+
+// writeMarshalled writes the envelope the way encoding/json would, encoding values
+// one at a time so those that fail can be left out, and copying already encoded ones.
+func (c *cacheService) writeMarshalled(w io.Writer, items map[string]cache.Item, staleAt map[string]int64) error {
+	entries, err := c.encodeEntries(items)
+	if err != nil {
+		return err
+	}
+
+	header, err := json.Marshal(newFileHeader(len(entries)))
+	if err != nil {
+		return err
+	}
+	buf := bufio.NewWriter(w)
+	// reopen the header object to append the items
+	buf.Write(header[:len(header)-1])
+	buf.WriteString(`,"items":{`)
+	for i, e := range entries {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		buf.Write(e.key)
+		buf.WriteString(`:{"Object":`)
+		buf.Write(e.body)
+		buf.WriteString(`,"Expiration":`)
+		buf.WriteString(strconv.FormatInt(e.item.Expiration, 10))
+		if exp := expiresAt(e.item.Expiration); exp != "" {
+			buf.WriteString(`,"expires_at":"`)
+			buf.WriteString(exp)
+			buf.WriteByte('"')
+		}
+		if _, ok := e.item.Object.(encryptedValue); ok {
+			buf.WriteString(`,"encrypted":true`)
+		}
+		if at := staleAt[e.name]; at > 0 {
+			buf.WriteString(`,"stale_at":`)
+			buf.WriteString(strconv.FormatInt(at, 10))
+		}
+		buf.WriteByte('}')
+	}
+	buf.WriteString("}}\n")
+	return buf.Flush()
+}
+
+type encodedEntry struct {
+	name      string
+	key, body []byte
+	item      cache.Item
+	err       error
+}
+
+func encodeEntry(k string, item cache.Item) encodedEntry {
+	e := encodedEntry{name: k, item: item}
+	body, ok := item.Object.(marshalledValue)
+	if !ok {
+		body, e.err = json.Marshal(item.Object)
+		if e.err != nil {
+			return e
+		}
+	}
+	e.body = body
+	e.key, e.err = json.Marshal(k)
+	return e
+}
+
+// encodeEntries encodes items across EncodeWorkers goroutines, each taking a
+// contiguous chunk, entries keep the order of the keys whatever the worker count.
+func (c *cacheService) encodeEntries(items map[string]cache.Item) ([]encodedEntry, error) {
+	keys := make([]string, 0, len(items))
+	for k := range items {
+		keys = append(keys, k)
+	}
+	encoded := make([]encodedEntry, len(keys))
+
+	workers := c.EncodeWorkers
+	if workers > len(keys) {
+		workers = len(keys)
+	}
+	if workers <= 1 {
+		for i, k := range keys {
+			encoded[i] = encodeEntry(k, items[k])
+		}
+	} else {
+		chunk := (len(keys) + workers - 1) / workers
+		var wg sync.WaitGroup
+		for start := 0; start < len(keys); start += chunk {
+			end := start + chunk
+			if end > len(keys) {
+				end = len(keys)
+			}
+			wg.Add(1)
+			go func(start, end int) {
+				defer wg.Done()
+				for i := start; i < end; i++ {
+					encoded[i] = encodeEntry(keys[i], items[keys[i]])
+				}
+			}(start, end)
+		}
+		wg.Wait()
+	}
+
+	entries := encoded[:0]
+	for i, e := range encoded {
+		if e.err != nil {
+			if c.skipUnencodable(keys[i], e.err) {
+				continue
+			}
+			return nil, e.err
+		}
+		entries = append(entries, e)
+	}
+	return entries, nil
+}
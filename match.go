@@ -0,0 +1,56 @@
+package cache
+
+import (
+	"path"
+	"sort"
+
+	"go.uber.org/zap"
+)
+
+// Keys returns the sorted live keys, expired items the janitor hasn't
+// removed yet are left out as Get wouldn't return them.
+func (c *cacheService) Keys() []string {
+	return c.liveKeys(func(string) bool { return true })
+}
+
+// KeysMatching returns the sorted live keys matching a path.Match glob.
+func (c *cacheService) KeysMatching(pattern string) ([]string, error) {
+	if _, err := path.Match(pattern, ""); err != nil {
+		c.Error(ERROR_INVALID_PATTERN, zap.Error(err), zap.String("pattern", pattern))
+		return nil, ErrInvalidPattern
+	}
+
+	return c.liveKeys(func(k string) bool {
+		ok, _ := path.Match(pattern, k)
+		return ok
+	}), nil
+}
+
+func (c *cacheService) liveKeys(match func(key string) bool) []string {
+	c.storeMu.RLock()
+	items := c.cache.Items()
+	c.storeMu.RUnlock()
+
+	keys := []string{}
+	for k := range items {
+		if !match(k) {
+			continue
+		}
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// DeleteMatching deletes the keys matching a path.Match glob, returning how many it deleted.
+func (c *cacheService) DeleteMatching(pattern string) (int, error) {
+	keys, err := c.KeysMatching(pattern)
+	if err != nil {
+		return 0, err
+	}
+	for _, k := range keys {
+		c.delete(k)
+	}
+	c.Info("deleted matching keys", zap.String("pattern", pattern), zap.Int("count", len(keys)))
+	return len(keys), nil
+}
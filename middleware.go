@@ -0,0 +1,127 @@
+package cache
+
+import (
+	"sync/atomic"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/comfforts/logger"
+)
+
+// Middleware wraps a CacheService, typically embedding next and overriding
+// the operations it intercepts, an override can short-circuit by not calling next.
+// Reads are intercepted through GetWithFound, which Get goes through. A wrapper that
+// may have Use called on it overrides Use as well so it stays in the chain, as the
+// built-in ones do.
+type Middleware func(next CacheService) CacheService
+
+// Use wraps the cache in mws, the first middleware is outermost and sees operations first.
+func (c *cacheService) Use(mws ...Middleware) CacheService {
+	return wrap(c, mws)
+}
+
+func wrap(c CacheService, mws []Middleware) CacheService {
+	for i := len(mws) - 1; i >= 0; i-- {
+		c = mws[i](c)
+	}
+	return c
+}
+
+type loggingService struct {
+	CacheService
+	logger.AppLogger
+}
+
+// LoggingMiddleware logs Get, Set and Delete calls with how long they took.
+func LoggingMiddleware(l logger.AppLogger) Middleware {
+	return func(next CacheService) CacheService {
+		return &loggingService{CacheService: next, AppLogger: l}
+	}
+}
+
+func (s *loggingService) Use(mws ...Middleware) CacheService {
+	return wrap(s, mws)
+}
+
+func (s *loggingService) Get(key string) (interface{}, time.Time) {
+	val, exp, _ := s.GetWithFound(key)
+	return val, exp
+}
+
+func (s *loggingService) GetWithFound(key string) (interface{}, time.Time, bool) {
+	start := time.Now()
+	val, exp, found := s.CacheService.GetWithFound(key)
+	s.Debug("cache get", zap.String("key", key), zap.Bool("hit", found), zap.Duration("took", time.Since(start)))
+	return val, exp, found
+}
+
+func (s *loggingService) Set(key string, value interface{}, d time.Duration) error {
+	start := time.Now()
+	err := s.CacheService.Set(key, value, d)
+	if err != nil {
+		s.Error("cache set", zap.String("key", key), zap.Error(err), zap.Duration("took", time.Since(start)))
+		return err
+	}
+	s.Debug("cache set", zap.String("key", key), zap.Duration("took", time.Since(start)))
+	return nil
+}
+
+func (s *loggingService) Delete(key string) {
+	start := time.Now()
+	s.CacheService.Delete(key)
+	s.Debug("cache delete", zap.String("key", key), zap.Duration("took", time.Since(start)))
+}
+
+// OpMetrics counts the operations seen by MetricsMiddleware.
+type OpMetrics struct {
+	Gets      atomic.Int64
+	Hits      atomic.Int64
+	Sets      atomic.Int64
+	SetErrors atomic.Int64
+	Deletes   atomic.Int64
+}
+
+type metricsService struct {
+	CacheService
+	metrics *OpMetrics
+}
+
+// MetricsMiddleware counts Get, Set and Delete calls into m.
+func MetricsMiddleware(m *OpMetrics) Middleware {
+	return func(next CacheService) CacheService {
+		return &metricsService{CacheService: next, metrics: m}
+	}
+}
+
+func (s *metricsService) Use(mws ...Middleware) CacheService {
+	return wrap(s, mws)
+}
+
+func (s *metricsService) Get(key string) (interface{}, time.Time) {
+	val, exp, _ := s.GetWithFound(key)
+	return val, exp
+}
+
+func (s *metricsService) GetWithFound(key string) (interface{}, time.Time, bool) {
+	val, exp, found := s.CacheService.GetWithFound(key)
+	s.metrics.Gets.Add(1)
+	if found {
+		s.metrics.Hits.Add(1)
+	}
+	return val, exp, found
+}
+
+func (s *metricsService) Set(key string, value interface{}, d time.Duration) error {
+	err := s.CacheService.Set(key, value, d)
+	s.metrics.Sets.Add(1)
+	if err != nil {
+		s.metrics.SetErrors.Add(1)
+	}
+	return err
+}
+
+func (s *metricsService) Delete(key string) {
+	s.CacheService.Delete(key)
+	s.metrics.Deletes.Add(1)
+}
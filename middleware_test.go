@@ -0,0 +1,101 @@
+package cache_test
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+
+	"github.com/comfforts/cache"
+	"github.com/comfforts/logger"
+)
+
+var errBlocked = errors.New("blocked key")
+
+// guardService rejects sets of blocked keys and records the keys it sees.
+type guardService struct {
+	cache.CacheService
+	seen *[]string
+}
+
+func (g *guardService) Set(key string, value interface{}, d time.Duration) error {
+	*g.seen = append(*g.seen, "set:"+key)
+	if strings.HasPrefix(key, "blocked:") {
+		return errBlocked
+	}
+	return g.CacheService.Set(key, value, d)
+}
+
+func (g *guardService) Get(key string) (interface{}, time.Time) {
+	val, exp, _ := g.GetWithFound(key)
+	return val, exp
+}
+
+func (g *guardService) GetWithFound(key string) (interface{}, time.Time, bool) {
+	*g.seen = append(*g.seen, "get:"+key)
+	return g.CacheService.GetWithFound(key)
+}
+
+func TestMiddleware(t *testing.T) {
+	dataDir := t.TempDir()
+	testLogger := logger.NewTestAppLogger(dataDir)
+	cacheCfg := cache.CacheConfig{
+		DataDir:   dataDir,
+		MarshalFn: UnmarshallTestStruct,
+	}
+	ca, err := cache.NewCacheService(cacheCfg, testLogger)
+	require.NoError(t, err)
+	closeOnCleanup(t, ca)
+
+	core, logs := observer.New(zapcore.DebugLevel)
+	metrics := &cache.OpMetrics{}
+	seen := []string{}
+	guard := func(next cache.CacheService) cache.CacheService {
+		return &guardService{CacheService: next, seen: &seen}
+	}
+	wrapped := ca.Use(cache.MetricsMiddleware(metrics), cache.LoggingMiddleware(zap.New(core)), guard)
+
+	err = wrapped.Set("user:1", TestStruct{Name: "John", Age: 34}, 5*time.Minute)
+	require.NoError(t, err)
+	err = wrapped.Set("blocked:1", TestStruct{Name: "Jane", Age: 29}, 5*time.Minute)
+	require.Equal(t, errBlocked, err)
+	_, _, ok := ca.Peek("blocked:1")
+	require.False(t, ok)
+
+	cVal, _ := wrapped.Get("user:1")
+	require.Equal(t, TestStruct{Name: "John", Age: 34}, cVal)
+	cVal, _ = wrapped.Get("user:2")
+	require.Nil(t, cVal)
+	wrapped.Delete("user:1")
+	_, _, ok = ca.Peek("user:1")
+	require.False(t, ok)
+
+	require.Equal(t, []string{"set:user:1", "set:blocked:1", "get:user:1", "get:user:2"}, seen)
+	require.Equal(t, int64(2), metrics.Sets.Load())
+	require.Equal(t, int64(1), metrics.SetErrors.Load())
+	require.Equal(t, int64(2), metrics.Gets.Load())
+	require.Equal(t, int64(1), metrics.Hits.Load())
+	require.Equal(t, int64(1), metrics.Deletes.Load())
+	require.Equal(t, 5, logs.Len())
+	require.Equal(t, 1, logs.FilterLevelExact(zapcore.ErrorLevel).Len())
+
+	// operations without overrides reach the cache untouched
+	require.Equal(t, 0, wrapped.ItemCount())
+
+	// a cached nil is a hit, and wrapping again keeps the existing chain
+	outer := &cache.OpMetrics{}
+	rewrapped := wrapped.Use(cache.MetricsMiddleware(outer))
+	err = rewrapped.Set("nothing", nil, 5*time.Minute)
+	require.NoError(t, err)
+	cVal, _ = rewrapped.Get("nothing")
+	require.Nil(t, cVal)
+	require.Equal(t, int64(1), outer.Hits.Load())
+	require.Equal(t, int64(3), metrics.Gets.Load())
+	require.Equal(t, int64(2), metrics.Hits.Load())
+	require.Equal(t, "get:nothing", seen[len(seen)-1])
+}
@@ -0,0 +1,53 @@
+package cache
+
+import (
+	"encoding/json"
+
+	"go.uber.org/zap"
+
+	"github.com/comfforts/errors"
+)
+
+// MarshalErrorPolicy is what Set does with a value NormalizeOnSet can't marshal.
+type MarshalErrorPolicy int
+
+const (
+	// Reject fails the Set.
+	Reject MarshalErrorPolicy = iota
+	// StoreRaw stores the value as given.
+	StoreRaw
+	// Skip drops the value without failing the Set.
+	Skip
+)
+
+// typed runs v through MarshalFn in the generic form it's decoded to on reload.
+func (c *cacheService) typed(v interface{}) (interface{}, error) {
+	body, err := json.Marshal(v)
+	if err != nil {
+		return nil, errors.WrapError(err, ERROR_MARSHALLING_CACHE_OBJECT)
+	}
+	var p interface{}
+	if err := json.Unmarshal(body, &p); err != nil {
+		return nil, errors.WrapError(err, ERROR_UNMARSHALLING_CACHE_JSON)
+	}
+	return c.marshal(p)
+}
+
+// normalize returns the value Set stores, ok is false when OnMarshalError says not to store it.
+func (c *cacheService) normalize(key string, value interface{}) (interface{}, bool, error) {
+	obj, err := c.typed(value)
+	if err == nil {
+		return obj, true, nil
+	}
+
+	switch c.OnMarshalError {
+	case StoreRaw:
+		c.Debug("storing value marshal function rejected as is", zap.Error(err), zap.String("key", key))
+		return value, true, nil
+	case Skip:
+		c.Error(ERROR_NORMALIZING_CACHE_VALUE, zap.Error(err), zap.String("key", key))
+		return nil, false, nil
+	}
+	c.Error(ERROR_NORMALIZING_CACHE_VALUE, zap.Error(err), zap.String("key", key))
+	return nil, false, errors.WrapError(err, ERROR_NORMALIZING_CACHE_VALUE)
+}
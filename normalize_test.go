@@ -0,0 +1,63 @@
+package cache_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/comfforts/cache"
+	"github.com/comfforts/logger"
+)
+
+func TestNormalizeOnSet(t *testing.T) {
+	dataDir := t.TempDir()
+	testLogger := logger.NewTestAppLogger(dataDir)
+	cacheCfg := cache.CacheConfig{
+		DataDir:        dataDir,
+		MarshalFn:      UnmarshallTestStruct,
+		NormalizeOnSet: true,
+	}
+	ca, err := cache.NewCacheService(cacheCfg, testLogger)
+	require.NoError(t, err)
+	closeOnCleanup(t, ca)
+
+	err = ca.Set("jane", map[string]interface{}{"name": "Jane", "age": 29}, 5*time.Minute)
+	require.NoError(t, err)
+	cVal, _ := ca.Get("jane")
+	require.Equal(t, TestStruct{Name: "Jane", Age: 29}, cVal)
+}
+
+func TestOnMarshalError(t *testing.T) {
+	for _, tc := range []struct {
+		policy  cache.MarshalErrorPolicy
+		wantErr bool
+		want    interface{}
+	}{
+		{policy: cache.Reject, wantErr: true},
+		{policy: cache.StoreRaw, want: "John"},
+		{policy: cache.Skip},
+	} {
+		dataDir := t.TempDir()
+		testLogger := logger.NewTestAppLogger(dataDir)
+		cacheCfg := cache.CacheConfig{
+			DataDir:        dataDir,
+			MarshalFn:      UnmarshallTestStruct,
+			NormalizeOnSet: true,
+			OnMarshalError: tc.policy,
+		}
+		ca, err := cache.NewCacheService(cacheCfg, testLogger)
+		require.NoError(t, err)
+		closeOnCleanup(t, ca)
+
+		// a bare string doesn't unmarshal into TestStruct
+		err = ca.Set("name", "John", 5*time.Minute)
+		if tc.wantErr {
+			require.Error(t, err)
+		} else {
+			require.NoError(t, err)
+		}
+		cVal, _ := ca.Get("name")
+		require.Equal(t, tc.want, cVal)
+	}
+}
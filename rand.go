@@ -0,0 +1,40 @@
+package cache
+
+import (
+	"math/rand"
+	"sync"
+	"time"
+)
+
+// lockedRand is the per-instance random source behind jitter and backoff,
+// rand.Rand isn't safe for concurrent use on its own.
+type lockedRand struct {
+	mu sync.Mutex
+	r  *rand.Rand
+}
+
+func newLockedRand(src rand.Source) *lockedRand {
+	if src == nil {
+		src = rand.NewSource(time.Now().UnixNano())
+	}
+	return &lockedRand{r: rand.New(src)}
+}
+
+// duration returns a random duration in [0, d).
+func (l *lockedRand) duration(d time.Duration) time.Duration {
+	if d <= 0 {
+		return 0
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return time.Duration(l.r.Int63n(int64(d)))
+}
+
+// jitterTTL spreads expirations over ExpirationJitter so items set together don't expire together.
+func (c *cacheService) jitterTTL(d time.Duration) time.Duration {
+	d = ttl(d)
+	if c.ExpirationJitter <= 0 || d == NO_EXPIRATION {
+		return d
+	}
+	return c.effectiveTTL(d) + c.rand.duration(c.ExpirationJitter)
+}
@@ -0,0 +1,64 @@
+package cache
+
+import (
+	"sync"
+	"time"
+)
+
+// tokenBucket refills rate tokens a second up to a second's worth, it's only
+// allocated when a limit is set so a nil bucket allows everything.
+type tokenBucket struct {
+	mu     sync.Mutex
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+	wait   time.Duration
+}
+
+func newTokenBucket(rate float64, wait time.Duration) *tokenBucket {
+	if rate <= 0 {
+		return nil
+	}
+	burst := rate
+	if burst < 1 {
+		burst = 1
+	}
+	return &tokenBucket{
+		rate:   rate,
+		burst:  burst,
+		tokens: burst,
+		last:   time.Now(),
+		wait:   wait,
+	}
+}
+
+// take spends a token, waiting up to the configured wait for one to refill.
+func (b *tokenBucket) take() bool {
+	if b == nil {
+		return true
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	now := time.Now()
+	b.tokens += now.Sub(b.last).Seconds() * b.rate
+	if b.tokens > b.burst {
+		b.tokens = b.burst
+	}
+	b.last = now
+	if b.tokens >= 1 {
+		b.tokens--
+		return true
+	}
+
+	// waiting under the lock queues later callers behind this one
+	need := time.Duration((1 - b.tokens) / b.rate * float64(time.Second))
+	if need > b.wait {
+		return false
+	}
+	time.Sleep(need)
+	b.last = b.last.Add(need)
+	b.tokens = 0
+	return true
+}
@@ -0,0 +1,72 @@
+package cache_test
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/comfforts/cache"
+	"github.com/comfforts/logger"
+)
+
+func TestRateLimits(t *testing.T) {
+	dataDir := t.TempDir()
+	testLogger := logger.NewTestAppLogger(dataDir)
+	cacheCfg := cache.CacheConfig{
+		DataDir:       dataDir,
+		MarshalFn:     UnmarshallTestStruct,
+		MaxSetsPerSec: 5,
+		MaxGetsPerSec: 5,
+	}
+	ca, err := cache.NewCacheService(cacheCfg, testLogger)
+	require.NoError(t, err)
+	closeOnCleanup(t, ca)
+
+	// a second's worth of burst passes, the next call is limited
+	for i := 0; i < 5; i++ {
+		err = ca.Set(fmt.Sprintf("key-%d", i), TestStruct{Name: "John", Age: i}, 5*time.Minute)
+		require.NoError(t, err)
+	}
+	err = ca.Set("key-5", TestStruct{Name: "John", Age: 5}, 5*time.Minute)
+	require.Equal(t, cache.ErrRateLimited, err)
+
+	ctx := context.Background()
+	for i := 0; i < 5; i++ {
+		_, _, err = ca.GetWithContext(ctx, fmt.Sprintf("key-%d", i))
+		require.NoError(t, err)
+	}
+	_, _, err = ca.GetWithContext(ctx, "key-0")
+	require.Equal(t, cache.ErrRateLimited, err)
+
+	// paced traffic passes once the bucket refills
+	time.Sleep(250 * time.Millisecond)
+	err = ca.Set("key-5", TestStruct{Name: "John", Age: 5}, 5*time.Minute)
+	require.NoError(t, err)
+	_, _, err = ca.GetWithContext(ctx, "key-5")
+	require.NoError(t, err)
+}
+
+func TestRateLimitWait(t *testing.T) {
+	dataDir := t.TempDir()
+	testLogger := logger.NewTestAppLogger(dataDir)
+	cacheCfg := cache.CacheConfig{
+		DataDir:       dataDir,
+		MarshalFn:     UnmarshallTestStruct,
+		MaxSetsPerSec: 10,
+		RateLimitWait: time.Second,
+	}
+	ca, err := cache.NewCacheService(cacheCfg, testLogger)
+	require.NoError(t, err)
+	closeOnCleanup(t, ca)
+
+	start := time.Now()
+	for i := 0; i < 15; i++ {
+		err = ca.Set(fmt.Sprintf("key-%d", i), TestStruct{Name: "John", Age: i}, 5*time.Minute)
+		require.NoError(t, err)
+	}
+	// the 5 calls past the burst wait for refills
+	require.GreaterOrEqual(t, time.Since(start), 400*time.Millisecond)
+}
@@ -0,0 +1,41 @@
+package cache
+
+import "time"
+
+// Reason tells why GetWithReason did or didn't return a value.
+type Reason int
+
+const (
+	Hit Reason = iota
+	Expired
+	Missing
+)
+
+func (r Reason) String() string {
+	switch r {
+	case Hit:
+		return "hit"
+	case Expired:
+		return "expired"
+	case Missing:
+		return "missing"
+	}
+	return "unknown"
+}
+
+// GetWithReason returns the cached value, telling items that expired apart from ones that
+// were never set. It doesn't consult the source. An expired item is reported as Expired
+// until the janitor removes it, Missing after that.
+func (c *cacheService) GetWithReason(key string) (interface{}, Reason) {
+	if val, _, ok := c.lookup(key); ok {
+		if until, tracked := c.revalidator.freshUntil(key); tracked && time.Now().After(until) {
+			c.revalidate(key)
+		}
+		return val, Hit
+	}
+
+	if c.expiries.expired(key, time.Now().UnixNano()) {
+		return nil, Expired
+	}
+	return nil, Missing
+}
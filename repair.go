@@ -0,0 +1,205 @@
+package cache
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/json"
+	"io"
+	"os"
+
+	"github.com/patrickmn/go-cache"
+	"go.uber.org/zap"
+
+	"github.com/comfforts/errors"
+)
+
+// CORRUPT_FILE_SUFFIX is appended to a local cache file set aside for the cloud backup.
+const CORRUPT_FILE_SUFFIX = ".corrupt"
+
+// loadCloudFallback sets aside a local cache file that failed to load and loads the
+// cloud backup in its place, loadErr is returned when the file can't be set aside.
+func (c *cacheService) loadCloudFallback(filePath string, loadErr error) (bool, error) {
+	c.Error("error loading local cache file, falling back to cloud backup", zap.Error(loadErr), zap.String("filePath", filePath))
+	if err := os.Rename(filePath, filePath+CORRUPT_FILE_SUFFIX); err != nil {
+		c.Error("error setting aside corrupt cache file", zap.Error(err), zap.String("filePath", filePath))
+		return false, loadErr
+	}
+	return c.readFile(filePath)
+}
+
+// repairFile salvages what it can from a cache file that failed to decode,
+// the decode error is returned when nothing could be recovered.
+func (c *cacheService) repairFile(filePath string, decodeErr error) (map[string]cache.Item, error) {
+	c.Error("error decoding cache file, attempting repair", zap.Error(decodeErr), zap.String("filePath", filePath))
+
+	file, err := os.Open(filePath)
+	if err != nil {
+		return nil, errors.WrapError(err, ERROR_OPENING_CACHE_FILE)
+	}
+	defer func() {
+		if err := file.Close(); err != nil {
+			c.Error("error closing file after repair", zap.Error(err))
+		}
+	}()
+
+	items, lost := salvageItems(file)
+	if len(items) == 0 {
+		c.Error("no cache items recovered", zap.String("filePath", filePath), zap.Int("lost", lost))
+		return nil, decodeErr
+	}
+	c.Info("cache file repaired", zap.String("filePath", filePath), zap.Int("recovered", len(items)), zap.Int("lost", lost))
+	return items, nil
+}
+
+// salvageItems streams a damaged cache file keeping every entry that still decodes.
+// It stops at the first syntax error, lost counts the entries seen but dropped.
+func salvageItems(r io.Reader) (map[string]cache.Item, int) {
+	items := map[string]cache.Item{}
+	r, err := decompressReader(r)
+	if err != nil {
+		return items, 0
+	}
+	br := bufio.NewReader(r)
+	if isBinary(br) {
+		return salvageBinary(br, items)
+	}
+
+	dec := json.NewDecoder(br)
+	if tok, err := dec.Token(); err != nil || tok != json.Delim('{') {
+		return items, 0
+	}
+
+	lost := 0
+	var blobs map[string]interface{}
+	for dec.More() {
+		tok, err := dec.Token()
+		if err != nil {
+			return items, lost
+		}
+		key, _ := tok.(string)
+		switch key {
+		case "version", "count", "saved_at", "content_addressed":
+			var skip json.RawMessage
+			if err := dec.Decode(&skip); err != nil {
+				return items, lost
+			}
+		case "blobs":
+			if err := dec.Decode(&blobs); err != nil {
+				return items, lost
+			}
+		case "items":
+			if tok, err := dec.Token(); err != nil || tok != json.Delim('{') {
+				return items, lost
+			}
+			done, n := salvageEntries(dec, items, blobs)
+			lost += n
+			if !done {
+				return items, lost
+			}
+			if _, err := dec.Token(); err != nil {
+				return items, lost
+			}
+		default:
+			// legacy files are a bare items map
+			kept, ok := salvageEntry(dec, key, items, blobs)
+			if !kept {
+				lost++
+			}
+			if !ok {
+				return items, lost
+			}
+		}
+	}
+	return items, lost
+}
+
+// salvageEntries reads entries up to the end of the current object, done is false
+// when a syntax error cut it short.
+func salvageEntries(dec *json.Decoder, items map[string]cache.Item, blobs map[string]interface{}) (bool, int) {
+	lost := 0
+	for dec.More() {
+		tok, err := dec.Token()
+		if err != nil {
+			return false, lost
+		}
+		key, _ := tok.(string)
+		kept, ok := salvageEntry(dec, key, items, blobs)
+		if !kept {
+			lost++
+		}
+		if !ok {
+			return false, lost
+		}
+	}
+	return true, lost
+}
+
+// salvageEntry reports whether the entry was kept, ok is false once the decoder hit a
+// syntax error and can't go on.
+func salvageEntry(dec *json.Decoder, key string, items map[string]cache.Item, blobs map[string]interface{}) (kept bool, ok bool) {
+	var raw json.RawMessage
+	if err := dec.Decode(&raw); err != nil {
+		return false, false
+	}
+	var item cache.Item
+	if err := json.Unmarshal(raw, &item); err != nil || item.Object == nil {
+		return false, true
+	}
+	if blobs != nil {
+		hash, isHash := item.Object.(string)
+		value, found := blobs[hash]
+		if !isHash || !found {
+			return false, true
+		}
+		item.Object = value
+	}
+	items[key] = item
+	return true, true
+}
+
+func salvageBinary(br *bufio.Reader, items map[string]cache.Item) (map[string]cache.Item, int) {
+	if _, err := br.Discard(len(binaryMagic)); err != nil {
+		return items, 0
+	}
+	if _, err := binary.ReadUvarint(br); err != nil {
+		return items, 0
+	}
+
+	lost := 0
+	for {
+		keyLen, err := binary.ReadUvarint(br)
+		if err != nil {
+			return items, lost
+		}
+		key, err := readRecord(br, keyLen)
+		if err != nil {
+			return items, lost + 1
+		}
+		exp, err := binary.ReadVarint(br)
+		if err != nil {
+			return items, lost + 1
+		}
+		valLen, err := binary.ReadUvarint(br)
+		if err != nil {
+			return items, lost + 1
+		}
+		body, err := readRecord(br, valLen)
+		if err != nil {
+			return items, lost + 1
+		}
+
+		var obj interface{}
+		if err := json.Unmarshal(body, &obj); err != nil {
+			lost++
+			continue
+		}
+		items[string(key)] = cache.Item{Object: obj, Expiration: exp}
+	}
+}
+
+// rewriteRepaired saves a cache salvaged by RepairOnLoad so the next load reads a clean file.
+func (c *cacheService) rewriteRepaired(filePath string) {
+	if err := c.saveFile(); err != nil {
+		c.Error("error rewriting repaired cache file", zap.Error(err), zap.String("filePath", filePath))
+	}
+}
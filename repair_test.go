@@ -0,0 +1,61 @@
+package cache_test
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/comfforts/cache"
+	"github.com/comfforts/logger"
+)
+
+func TestRepairOnLoad(t *testing.T) {
+	dataDir := t.TempDir()
+	testLogger := logger.NewTestAppLogger(dataDir)
+	cacheCfg := cache.CacheConfig{
+		DataDir:   dataDir,
+		MarshalFn: UnmarshallTestStruct,
+	}
+
+	exp := time.Now().Add(5 * time.Minute).UnixNano()
+	entry := func(name string, age int) string {
+		return fmt.Sprintf(`{"Object":{"Name":%q,"Age":%d},"Expiration":%d}`, name, age, exp)
+	}
+	corrupt := fmt.Sprintf(`{"version":1,"count":6,"items":{"first":%s,"bad":"garbage","second":%s,"wrong":{"Object":{"Name":"x"},"Expiration":"soon"},"third":%s,"truncated":{"Object":{"Na`,
+		entry("John", 34), entry("Jane", 29), entry("Jack", 41))
+	filePath := filepath.Join(dataDir, "cache.json")
+	err := os.WriteFile(filePath, []byte(corrupt), 0644)
+	require.NoError(t, err)
+
+	ca, err := cache.NewCacheService(cacheCfg, testLogger)
+	require.NoError(t, err)
+	closeOnCleanup(t, ca)
+	require.Equal(t, 0, ca.ItemCount())
+
+	cacheCfg.RepairOnLoad = true
+	ca, err = cache.NewCacheService(cacheCfg, testLogger)
+	require.NoError(t, err)
+	closeOnCleanup(t, ca)
+	require.Equal(t, 3, ca.ItemCount())
+	cVal, _ := ca.Get("first")
+	require.Equal(t, TestStruct{Name: "John", Age: 34}, cVal)
+	cVal, _ = ca.Get("second")
+	require.Equal(t, TestStruct{Name: "Jane", Age: 29}, cVal)
+	cVal, _ = ca.Get("third")
+	require.Equal(t, TestStruct{Name: "Jack", Age: 41}, cVal)
+	require.Equal(t, false, ca.Updated())
+
+	// the rewritten file decodes cleanly without repair
+	summary, err := cache.InspectFile(filePath)
+	require.NoError(t, err)
+	require.Equal(t, 3, summary.Count)
+	cacheCfg.RepairOnLoad = false
+	ca, err = cache.NewCacheService(cacheCfg, testLogger)
+	require.NoError(t, err)
+	closeOnCleanup(t, ca)
+	require.Equal(t, 3, ca.ItemCount())
+}
@@ -0,0 +1,160 @@
+package cache
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/comfforts/logger"
+)
+
+const DEFAULT_REPLICATION_QUEUE_SIZE = 1000
+
+type replicaOpKind int
+
+const (
+	replicaSet replicaOpKind = iota
+	replicaDelete
+	replicaIncrement
+	replicaFlush
+)
+
+type replicaOp struct {
+	kind  replicaOpKind
+	key   string
+	value interface{}
+	d     time.Duration
+	n     float64
+	// sensitive values stay encrypted when the standby persists them
+	sensitive bool
+}
+
+// replicator forwards mutations to a standby cache in the background, ops that
+// don't fit the queue are dropped rather than slowing down the primary.
+type replicator struct {
+	target  CacheService
+	queue   chan replicaOp
+	dropped atomic.Int64
+	stop    chan struct{}
+	done    chan struct{}
+	once    sync.Once
+	// closed is set under mu before stop closes, so no enqueue lands after run drained the queue
+	mu     sync.RWMutex
+	closed bool
+	logger.AppLogger
+}
+
+// replicaTarget is implemented by caches that can store a replicated value under the
+// exact ttl the primary stored it with, other targets get a plain Set or SetSensitive.
+type replicaTarget interface {
+	setReplicated(key string, value interface{}, d time.Duration, sensitive bool) error
+}
+
+func newReplicator(target CacheService, l logger.AppLogger) *replicator {
+	return &replicator{
+		target:    target,
+		queue:     make(chan replicaOp, DEFAULT_REPLICATION_QUEUE_SIZE),
+		stop:      make(chan struct{}),
+		done:      make(chan struct{}),
+		AppLogger: l,
+	}
+}
+
+// enqueue queues the op, once the queue is closed it's applied inline instead
+// as the target was still set when the op was made.
+func (r *replicator) enqueue(op replicaOp) {
+	if r == nil {
+		return
+	}
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	if r.closed {
+		r.apply(op)
+		return
+	}
+	select {
+	case r.queue <- op:
+	default:
+		r.dropped.Add(1)
+		r.Error("replication queue full, dropping op", zap.String("key", op.key))
+	}
+}
+
+func (r *replicator) run() {
+	defer close(r.done)
+
+	for {
+		select {
+		case op := <-r.queue:
+			r.apply(op)
+		case <-r.stop:
+			for {
+				select {
+				case op := <-r.queue:
+					r.apply(op)
+				default:
+					return
+				}
+			}
+		}
+	}
+}
+
+func (r *replicator) apply(op replicaOp) {
+	var err error
+	switch op.kind {
+	case replicaSet:
+		if t, ok := r.target.(replicaTarget); ok {
+			err = t.setReplicated(op.key, op.value, op.d, op.sensitive)
+		} else if op.sensitive {
+			err = r.target.SetSensitive(op.key, op.value, op.d)
+		} else {
+			err = r.target.Set(op.key, op.value, op.d)
+		}
+	case replicaDelete:
+		r.target.Delete(op.key)
+	case replicaIncrement:
+		_, err = r.target.IncrementFloat(op.key, op.n)
+	case replicaFlush:
+		err = r.target.Reset(false)
+	}
+	if err != nil {
+		r.Error("error replicating to standby", zap.Error(err), zap.String("key", op.key))
+	}
+}
+
+func (r *replicator) close() {
+	r.once.Do(func() {
+		r.mu.Lock()
+		r.closed = true
+		r.mu.Unlock()
+		close(r.stop)
+	})
+	<-r.done
+}
+
+// ReplicateTo streams Set, Delete, IncrementFloat and flushes (Reset, ReplaceAll) to target
+// on a best-effort basis, a nil target stops replicating. Clear stops replication
+// without flushing the standby.
+func (c *cacheService) ReplicateTo(target CacheService) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.replica != nil {
+		c.replica.close()
+		c.replica = nil
+	}
+	if target != nil {
+		c.replica = newReplicator(target, c.AppLogger)
+		go c.replica.run()
+	}
+}
+
+func (c *cacheService) getReplica() *replicator {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.replica
+}
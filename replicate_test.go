@@ -0,0 +1,87 @@
+package cache_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/comfforts/cache"
+	"github.com/comfforts/logger"
+)
+
+func TestReplicateTo(t *testing.T) {
+	newCache := func() cache.CacheService {
+		dataDir := t.TempDir()
+		cacheCfg := cache.CacheConfig{
+			DataDir:   dataDir,
+			MarshalFn: UnmarshallTestStruct,
+		}
+		ca, err := cache.NewCacheService(cacheCfg, logger.NewTestAppLogger(dataDir))
+		require.NoError(t, err)
+		closeOnCleanup(t, ca)
+		return ca
+	}
+	primary, standby := newCache(), newCache()
+	primary.ReplicateTo(standby)
+
+	err := primary.Set("first", TestStruct{Name: "John", Age: 34}, 5*time.Minute)
+	require.NoError(t, err)
+	err = primary.Set("second", TestStruct{Name: "Jane", Age: 29}, 5*time.Minute)
+	require.NoError(t, err)
+	err = primary.Set("counter", 1.5, 5*time.Minute)
+	require.NoError(t, err)
+	_, err = primary.IncrementFloat("counter", 2)
+	require.NoError(t, err)
+	primary.Delete("first")
+
+	require.Eventually(t, func() bool {
+		counter, _, _ := standby.Peek("counter")
+		return standby.ItemCount() == 2 && counter == 3.5
+	}, time.Second, 10*time.Millisecond)
+	cVal, _ := standby.Get("second")
+	require.Equal(t, TestStruct{Name: "Jane", Age: 29}, cVal)
+	cVal, _ = standby.Get("first")
+	require.Nil(t, cVal)
+
+	err = primary.Reset(false)
+	require.NoError(t, err)
+	require.Eventually(t, func() bool {
+		return standby.ItemCount() == 0
+	}, time.Second, 10*time.Millisecond)
+
+	primary.ReplicateTo(nil)
+	err = primary.Set("unreplicated", TestStruct{Name: "Jack", Age: 41}, 5*time.Minute)
+	require.NoError(t, err)
+	time.Sleep(50 * time.Millisecond)
+	require.Equal(t, 0, standby.ItemCount())
+}
+
+func TestReplicateKeepsExpiration(t *testing.T) {
+	newCache := func() cache.CacheService {
+		dataDir := t.TempDir()
+		cacheCfg := cache.CacheConfig{
+			DataDir:          dataDir,
+			MarshalFn:        UnmarshallTestStruct,
+			ExpirationJitter: time.Hour,
+		}
+		ca, err := cache.NewCacheService(cacheCfg, logger.NewTestAppLogger(dataDir))
+		require.NoError(t, err)
+		closeOnCleanup(t, ca)
+		return ca
+	}
+	primary, standby := newCache(), newCache()
+	primary.ReplicateTo(standby)
+
+	err := primary.Set("test", TestStruct{Name: "John", Age: 34}, 5*time.Minute)
+	require.NoError(t, err)
+	_, want, _ := primary.Peek("test")
+
+	// the standby stores the primary's jittered ttl rather than jittering it again
+	require.Eventually(t, func() bool {
+		_, _, ok := standby.Peek("test")
+		return ok
+	}, time.Second, 10*time.Millisecond)
+	_, got, _ := standby.Peek("test")
+	require.WithinDuration(t, want, got, 50*time.Millisecond)
+}
@@ -0,0 +1,137 @@
+package cache
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// revalidator tracks when items turn stale, items stay in the store for
+// the stale window past that so reads can serve them while a refresh runs.
+type revalidator struct {
+	window   time.Duration
+	mu       sync.Mutex
+	staleAt  map[string]time.Time
+	inflight map[string]bool
+}
+
+func newRevalidator(window time.Duration) *revalidator {
+	return &revalidator{
+		window:   window,
+		staleAt:  map[string]time.Time{},
+		inflight: map[string]bool{},
+	}
+}
+
+func (r *revalidator) markFresh(key string, d time.Duration) {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if d <= 0 {
+		delete(r.staleAt, key)
+		return
+	}
+	r.staleAt[key] = time.Now().Add(d)
+}
+
+func (r *revalidator) freshUntil(key string) (time.Time, bool) {
+	if r == nil {
+		return time.Time{}, false
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	at, ok := r.staleAt[key]
+	return at, ok
+}
+
+func (r *revalidator) remove(key string) {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	delete(r.staleAt, key)
+}
+
+func (r *revalidator) reset() {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.staleAt = map[string]time.Time{}
+}
+
+// begin claims the refresh for key, only one refresh per key runs at a time.
+func (r *revalidator) begin(key string) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.inflight[key] {
+		return false
+	}
+	r.inflight[key] = true
+	return true
+}
+
+func (r *revalidator) end(key string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	delete(r.inflight, key)
+}
+
+// storeTTL is the ttl items are stored with, stale items
+// are kept around for the revalidation window.
+func (c *cacheService) storeTTL(d time.Duration) time.Duration {
+	d = ttl(d)
+	if c.revalidator == nil || d == NO_EXPIRATION {
+		return d
+	}
+	return c.effectiveTTL(d) + c.revalidator.window
+}
+
+func (c *cacheService) revalidate(key string) {
+	src := c.getSource()
+	if src == nil || !c.revalidator.begin(key) {
+		return
+	}
+
+	go func() {
+		defer c.revalidator.end(key)
+
+		val, d, found, err := c.fetch(context.Background(), src, key, "cache.source.revalidate")
+		if err != nil {
+			c.Error("error revalidating stale value", zap.Error(err), zap.String("key", key))
+			return
+		}
+		if !found {
+			return
+		}
+
+		stored, err := c.encodeValue(val)
+		if err != nil {
+			c.Error(ERROR_MARSHALLING_CACHE_OBJECT, zap.Error(err), zap.String("key", key))
+			return
+		}
+
+		c.storeMu.RLock()
+		c.cache.Set(key, c.blobs.intern(stored), c.storeTTL(d))
+		c.storeMu.RUnlock()
+		c.trackExpiry(key, c.storeTTL(d))
+		c.revalidator.markFresh(key, c.effectiveTTL(d))
+		c.sliding.record(key, c.effectiveTTL(d))
+		c.hot.invalidate(key)
+		c.updatedAt.Store(time.Now().UnixNano())
+		c.getReplica().enqueue(replicaOp{kind: replicaSet, key: key, value: val, d: d, sensitive: c.sensitive.has(key)})
+		c.Debug("stale value revalidated", zap.String("key", key))
+	}()
+}
@@ -0,0 +1,165 @@
+package cache
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/patrickmn/go-cache"
+	"go.uber.org/zap"
+
+	"github.com/comfforts/errors"
+)
+
+// ENCRYPTED_VALUE_FIELD holds the ciphertext of a sensitive value in the cache file.
+const ENCRYPTED_VALUE_FIELD = "__encrypted__"
+
+// encryptedValue replaces a sensitive value in the cache file, the nonce leads the ciphertext.
+type encryptedValue struct {
+	Ciphertext string `json:"__encrypted__"`
+}
+
+// sensitiveKeys tracks the items encrypted when persisted, it's nil unless EncryptionKey is set.
+type sensitiveKeys struct {
+	mu   sync.Mutex
+	keys map[string]struct{}
+}
+
+func newSensitiveKeys() *sensitiveKeys {
+	return &sensitiveKeys{
+		keys: map[string]struct{}{},
+	}
+}
+
+func (s *sensitiveKeys) add(key string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.keys[key] = struct{}{}
+}
+
+func (s *sensitiveKeys) has(key string) bool {
+	if s == nil {
+		return false
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, ok := s.keys[key]
+	return ok
+}
+
+func (s *sensitiveKeys) remove(key string) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.keys, key)
+}
+
+func (s *sensitiveKeys) reset() {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.keys = map[string]struct{}{}
+}
+
+func newAEAD(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// SetSensitive sets the item and encrypts its value whenever the cache is persisted.
+func (c *cacheService) SetSensitive(key string, value interface{}, d time.Duration) error {
+	if c.aead == nil {
+		c.Error(ERROR_MISSING_ENCRYPTION_KEY, zap.String("key", key))
+		return ErrMissingEncryptionKey
+	}
+	if !c.setLimit.take() {
+		c.Error(ERROR_RATE_LIMITED, zap.String("key", key), zap.String("op", "set"))
+		return ErrRateLimited
+	}
+	return c.putSensitive(key, value, d, setOptions{})
+}
+
+// putSensitive marks key before storing it, so a save made in between doesn't
+// persist the value in plaintext. The mark is dropped again if the store fails.
+func (c *cacheService) putSensitive(key string, value interface{}, d time.Duration, opts setOptions) error {
+	marked := c.sensitive.has(key)
+	c.sensitive.add(key)
+	if err := c.put(key, value, d, opts); err != nil {
+		if !marked {
+			c.sensitive.remove(key)
+		}
+		return err
+	}
+	return nil
+}
+
+// sealSensitive returns items with the values of sensitive keys encrypted.
+func (c *cacheService) sealSensitive(items map[string]cache.Item) (map[string]cache.Item, error) {
+	if c.sensitive == nil {
+		return items, nil
+	}
+	for k, item := range items {
+		if !c.sensitive.has(k) {
+			continue
+		}
+		obj := c.blobs.resolve(item.Object)
+		body, ok := obj.(marshalledValue)
+		if !ok {
+			var err error
+			body, err = json.Marshal(obj)
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		nonce := make([]byte, c.aead.NonceSize())
+		if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+			return nil, err
+		}
+		sealed := c.aead.Seal(nonce, nonce, body, nil)
+		item.Object = encryptedValue{Ciphertext: base64.StdEncoding.EncodeToString(sealed)}
+		items[k] = item
+	}
+	return items, nil
+}
+
+// openSensitive decrypts a value sealed by sealSensitive, sensitive is false for plain values.
+func (c *cacheService) openSensitive(obj interface{}) (value interface{}, sensitive bool, err error) {
+	m, ok := obj.(map[string]interface{})
+	if !ok || len(m) != 1 {
+		return obj, false, nil
+	}
+	text, ok := m[ENCRYPTED_VALUE_FIELD].(string)
+	if !ok {
+		return obj, false, nil
+	}
+	if c.aead == nil {
+		return nil, true, ErrMissingEncryptionKey
+	}
+
+	sealed, err := base64.StdEncoding.DecodeString(text)
+	if err != nil || len(sealed) < c.aead.NonceSize() {
+		return nil, true, errors.NewAppError(ERROR_DECRYPTING_VALUE)
+	}
+	nonce, ciphertext := sealed[:c.aead.NonceSize()], sealed[c.aead.NonceSize():]
+	body, err := c.aead.Open(nil, nonce, ciphertext, nil)
+	if err != nil {
+		return nil, true, errors.WrapError(err, ERROR_DECRYPTING_VALUE)
+	}
+	if err := json.Unmarshal(body, &value); err != nil {
+		return nil, true, errors.WrapError(err, ERROR_DECRYPTING_VALUE)
+	}
+	return value, true, nil
+}
@@ -0,0 +1,123 @@
+package cache_test
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/comfforts/cache"
+	"github.com/comfforts/logger"
+)
+
+func TestSetSensitive(t *testing.T) {
+	dataDir := t.TempDir()
+	testLogger := logger.NewTestAppLogger(dataDir)
+	cacheCfg := cache.CacheConfig{
+		DataDir:   dataDir,
+		MarshalFn: UnmarshallTestStruct,
+	}
+	ca, err := cache.NewCacheService(cacheCfg, testLogger)
+	require.NoError(t, err)
+	closeOnCleanup(t, ca)
+	err = ca.SetSensitive("secret", TestStruct{Name: "Agent", Age: 7}, 5*time.Minute)
+	require.Equal(t, cache.ErrMissingEncryptionKey, err)
+
+	cacheCfg.EncryptionKey = []byte("short")
+	_, err = cache.NewCacheService(cacheCfg, testLogger)
+	require.Equal(t, cache.ErrInvalidEncryptionKey, err)
+
+	cacheCfg.EncryptionKey = []byte("0123456789abcdef0123456789abcdef")
+	ca, err = cache.NewCacheService(cacheCfg, testLogger)
+	require.NoError(t, err)
+	closeOnCleanup(t, ca)
+	err = ca.SetSensitive("secret", TestStruct{Name: "Agent", Age: 7}, 5*time.Minute)
+	require.NoError(t, err)
+	err = ca.Set("public", TestStruct{Name: "John", Age: 34}, 5*time.Minute)
+	require.NoError(t, err)
+	cVal, _ := ca.Get("secret")
+	require.Equal(t, TestStruct{Name: "Agent", Age: 7}, cVal)
+
+	err = ca.Clear()
+	require.NoError(t, err)
+
+	body, err := os.ReadFile(filepath.Join(dataDir, "cache.json"))
+	require.NoError(t, err)
+	require.Equal(t, false, strings.Contains(string(body), "Agent"))
+	var persisted struct {
+		Items map[string]struct {
+			Object    json.RawMessage
+			Encrypted bool `json:"encrypted"`
+		} `json:"items"`
+	}
+	err = json.Unmarshal(body, &persisted)
+	require.NoError(t, err)
+	require.Equal(t, true, persisted.Items["secret"].Encrypted)
+	require.Equal(t, false, persisted.Items["public"].Encrypted)
+	var public TestStruct
+	err = json.Unmarshal(persisted.Items["public"].Object, &public)
+	require.NoError(t, err)
+	require.Equal(t, TestStruct{Name: "John", Age: 34}, public)
+
+	ca, err = cache.NewCacheService(cacheCfg, testLogger)
+	require.NoError(t, err)
+	closeOnCleanup(t, ca)
+	cVal, _ = ca.Get("secret")
+	require.Equal(t, TestStruct{Name: "Agent", Age: 7}, cVal)
+	cVal, _ = ca.Get("public")
+	require.Equal(t, TestStruct{Name: "John", Age: 34}, cVal)
+
+	// values loaded sensitive stay encrypted on the next save
+	err = ca.Set("other", TestStruct{Name: "Jane", Age: 29}, 5*time.Minute)
+	require.NoError(t, err)
+	err = ca.Purge()
+	require.NoError(t, err)
+	body, err = os.ReadFile(filepath.Join(dataDir, "cache.json"))
+	require.NoError(t, err)
+	require.Equal(t, true, strings.Contains(string(body), "Jane"))
+	require.Equal(t, false, strings.Contains(string(body), "Agent"))
+
+	// without the key the sensitive item can't be restored
+	cacheCfg.EncryptionKey = nil
+	ca, err = cache.NewCacheService(cacheCfg, testLogger)
+	require.NoError(t, err)
+	closeOnCleanup(t, ca)
+	require.Equal(t, 2, ca.ItemCount())
+	cVal, _ = ca.Get("secret")
+	require.Nil(t, cVal)
+}
+
+func TestReplicateSensitive(t *testing.T) {
+	newCache := func(dataDir string) cache.CacheService {
+		cacheCfg := cache.CacheConfig{
+			DataDir:       dataDir,
+			MarshalFn:     UnmarshallTestStruct,
+			EncryptionKey: []byte("0123456789abcdef0123456789abcdef"),
+		}
+		ca, err := cache.NewCacheService(cacheCfg, logger.NewTestAppLogger(dataDir))
+		require.NoError(t, err)
+		closeOnCleanup(t, ca)
+		return ca
+	}
+	standbyDir := t.TempDir()
+	primary, standby := newCache(t.TempDir()), newCache(standbyDir)
+	primary.ReplicateTo(standby)
+
+	err := primary.SetSensitive("secret", TestStruct{Name: "Agent", Age: 7}, 5*time.Minute)
+	require.NoError(t, err)
+	require.Eventually(t, func() bool {
+		_, _, ok := standby.Peek("secret")
+		return ok
+	}, time.Second, 10*time.Millisecond)
+
+	// the standby keeps the value encrypted when it saves
+	err = standby.Clear()
+	require.NoError(t, err)
+	body, err := os.ReadFile(filepath.Join(standbyDir, "cache.json"))
+	require.NoError(t, err)
+	require.Equal(t, false, strings.Contains(string(body), "Agent"))
+}
@@ -0,0 +1,105 @@
+package cache
+
+import (
+	"sync"
+	"time"
+)
+
+// slidingTTLs remembers the ttl each item was set with so reads can
+// push its expiration forward, it's nil unless SlidingExpiration is set.
+type slidingTTLs struct {
+	mu   sync.Mutex
+	ttls map[string]time.Duration
+}
+
+func newSlidingTTLs() *slidingTTLs {
+	return &slidingTTLs{
+		ttls: map[string]time.Duration{},
+	}
+}
+
+func (s *slidingTTLs) record(key string, d time.Duration) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if d <= 0 {
+		delete(s.ttls, key)
+		return
+	}
+	s.ttls[key] = d
+}
+
+func (s *slidingTTLs) get(key string) (time.Duration, bool) {
+	if s == nil {
+		return 0, false
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	d, ok := s.ttls[key]
+	return d, ok
+}
+
+func (s *slidingTTLs) remove(key string) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.ttls, key)
+}
+
+func (s *slidingTTLs) reset() {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.ttls = map[string]time.Duration{}
+}
+
+// effectiveTTL resolves go-cache's duration conventions to the ttl an item actually gets.
+func (c *cacheService) effectiveTTL(d time.Duration) time.Duration {
+	d = ttl(d)
+	if d == USE_DEFAULT_EXPIRATION {
+		return c.defaultExp
+	}
+	return d
+}
+
+// lookup is the read path for Get, it counts as an access
+// for LRU ordering and sliding expiration.
+func (c *cacheService) lookup(key string) (interface{}, time.Time, bool) {
+	if c.sliding == nil {
+		if val, exp, ok := c.hot.get(key); ok {
+			return val, exp, true
+		}
+		gen := c.hot.generation()
+		val, exp, ok := c.getWithExpiration(key)
+		if ok {
+			c.access.touch(key)
+			c.hot.promote(key, val, exp, gen)
+		}
+		return val, exp, ok
+	}
+
+	c.storeMu.Lock()
+	defer c.storeMu.Unlock()
+
+	val, exp, ok := c.cache.GetWithExpiration(key)
+	if !ok {
+		return val, exp, ok
+	}
+	if d, ok := c.sliding.get(key); ok {
+		if err := c.cache.Replace(key, val, d); err == nil {
+			exp = time.Now().Add(d)
+		}
+	}
+	c.access.touch(key)
+	return c.resolve(val), exp, true
+}
@@ -0,0 +1,50 @@
+package cache_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/comfforts/cache"
+	"github.com/comfforts/logger"
+)
+
+func TestPeekSlidingExpiration(t *testing.T) {
+	dataDir := t.TempDir()
+	testLogger := logger.NewTestAppLogger(dataDir)
+	cacheCfg := cache.CacheConfig{
+		DataDir:           dataDir,
+		MarshalFn:         UnmarshallTestStruct,
+		SlidingExpiration: true,
+	}
+	ca, err := cache.NewCacheService(cacheCfg, testLogger)
+	require.NoError(t, err)
+	closeOnCleanup(t, ca)
+
+	ttl := 400 * time.Millisecond
+	err = ca.Set("peeked", TestStruct{Name: "John", Age: 34}, ttl)
+	require.NoError(t, err)
+	err = ca.Set("read", TestStruct{Name: "Jane", Age: 29}, ttl)
+	require.NoError(t, err)
+	_, peekedExp, ok := ca.Peek("peeked")
+	require.Equal(t, true, ok)
+
+	time.Sleep(250 * time.Millisecond)
+
+	cVal, exp, ok := ca.Peek("peeked")
+	require.Equal(t, true, ok)
+	require.Equal(t, TestStruct{Name: "John", Age: 34}, cVal)
+	require.Equal(t, peekedExp, exp)
+
+	cVal, _ = ca.Get("read")
+	require.Equal(t, TestStruct{Name: "Jane", Age: 29}, cVal)
+
+	time.Sleep(250 * time.Millisecond)
+
+	_, _, ok = ca.Peek("peeked")
+	require.Equal(t, false, ok)
+	cVal, _, ok = ca.Peek("read")
+	require.Equal(t, true, ok)
+	require.Equal(t, TestStruct{Name: "Jane", Age: 29}, cVal)
+}
@@ -0,0 +1,107 @@
+package cache
+
+import (
+	"sync"
+	"time"
+
+	"github.com/patrickmn/go-cache"
+	"go.uber.org/zap"
+)
+
+// softTTLs tracks when items set with SetWithSoftHard go stale,
+// the mark ends when the item is deleted or expires.
+type softTTLs struct {
+	mu         sync.Mutex
+	staleAfter map[string]time.Time
+}
+
+func newSoftTTLs() *softTTLs {
+	return &softTTLs{
+		staleAfter: map[string]time.Time{},
+	}
+}
+
+func (s *softTTLs) record(key string, at time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.staleAfter[key] = at
+}
+
+func (s *softTTLs) stale(key string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	at, ok := s.staleAfter[key]
+	return ok && !time.Now().Before(at)
+}
+
+func (s *softTTLs) remove(key string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.staleAfter, key)
+}
+
+func (s *softTTLs) reset() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.staleAfter = map[string]time.Time{}
+}
+
+// snapshot returns the soft ttl deadlines as unix nanos, for saving them with the items.
+func (s *softTTLs) snapshot() map[string]int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	staleAt := make(map[string]int64, len(s.staleAfter))
+	for k, at := range s.staleAfter {
+		staleAt[k] = at.UnixNano()
+	}
+	return staleAt
+}
+
+// staleValue carries the soft ttl deadline saved with an item from decoding the file to restoring it.
+type staleValue struct {
+	value   interface{}
+	staleAt int64
+}
+
+// markStale wraps the values of items that were saved with a soft ttl deadline.
+func markStale(items map[string]cache.Item, staleAt map[string]int64) {
+	for k, at := range staleAt {
+		if item, ok := items[k]; ok && at > 0 {
+			item.Object = staleValue{value: item.Object, staleAt: at}
+			items[k] = item
+		}
+	}
+}
+
+// unwrapStale returns a loaded value and the soft ttl deadline it was saved with, 0 when it has none.
+func unwrapStale(v interface{}) (interface{}, int64) {
+	if s, ok := v.(staleValue); ok {
+		return s.value, s.staleAt
+	}
+	return v, 0
+}
+
+// SetWithSoftHard sets an item that reads as stale after soft and expires after hard,
+// hard follows the ttl conventions of Set.
+func (c *cacheService) SetWithSoftHard(key string, value interface{}, soft, hard time.Duration) error {
+	resolved := c.effectiveTTL(hard)
+	if soft <= 0 || (resolved != NO_EXPIRATION && soft > resolved) {
+		c.Error(ERROR_INVALID_SOFT_TTL, zap.String("key", key), zap.Duration("soft", soft), zap.Duration("hard", hard))
+		return ErrInvalidSoftTTL
+	}
+	if err := c.Set(key, value, hard); err != nil {
+		return err
+	}
+	c.softTTLs.record(key, time.Now().Add(soft))
+	return nil
+}
+
+// GetWithStaleness returns the value and whether it's past the soft ttl it was set with,
+// items set without one are never stale.
+func (c *cacheService) GetWithStaleness(key string) (interface{}, bool, bool) {
+	val, _, found := c.GetWithFound(key)
+	if !found {
+		return nil, false, false
+	}
+	return val, c.softTTLs.stale(key), true
+}
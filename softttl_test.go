@@ -0,0 +1,119 @@
+package cache_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/comfforts/cache"
+	"github.com/comfforts/logger"
+)
+
+func TestSetWithSoftHard(t *testing.T) {
+	dataDir := t.TempDir()
+	testLogger := logger.NewTestAppLogger(dataDir)
+	cacheCfg := cache.CacheConfig{
+		DataDir:   dataDir,
+		MarshalFn: UnmarshallTestStruct,
+	}
+	ca, err := cache.NewCacheService(cacheCfg, testLogger)
+	require.NoError(t, err)
+	closeOnCleanup(t, ca)
+
+	err = ca.SetWithSoftHard("test", TestStruct{Name: "John", Age: 34}, 50*time.Millisecond, 300*time.Millisecond)
+	require.NoError(t, err)
+	err = ca.Set("plain", TestStruct{Name: "Jane", Age: 29}, 5*time.Minute)
+	require.NoError(t, err)
+
+	val, stale, ok := ca.GetWithStaleness("test")
+	require.Equal(t, true, ok)
+	require.Equal(t, false, stale)
+	require.Equal(t, TestStruct{Name: "John", Age: 34}, val)
+
+	time.Sleep(100 * time.Millisecond)
+	val, stale, ok = ca.GetWithStaleness("test")
+	require.Equal(t, true, ok)
+	require.Equal(t, true, stale)
+	require.Equal(t, TestStruct{Name: "John", Age: 34}, val)
+	_, stale, ok = ca.GetWithStaleness("plain")
+	require.Equal(t, true, ok)
+	require.Equal(t, false, stale)
+
+	// a cached nil is found, as with GetWithFound
+	err = ca.SetWithSoftHard("nothing", nil, 50*time.Millisecond, 5*time.Minute)
+	require.NoError(t, err)
+	val, stale, ok = ca.GetWithStaleness("nothing")
+	require.Equal(t, true, ok)
+	require.Equal(t, false, stale)
+	require.Nil(t, val)
+	_, _, ok = ca.GetWithStaleness("missing")
+	require.Equal(t, false, ok)
+
+	time.Sleep(250 * time.Millisecond)
+	_, _, ok = ca.GetWithStaleness("test")
+	require.Equal(t, false, ok)
+
+	err = ca.SetWithSoftHard("invalid", TestStruct{Name: "Jack", Age: 40}, time.Minute, time.Second)
+	require.Equal(t, cache.ErrInvalidSoftTTL, err)
+}
+
+func TestSoftTTLConventions(t *testing.T) {
+	dataDir := t.TempDir()
+	testLogger := logger.NewTestAppLogger(dataDir)
+	cacheCfg := cache.CacheConfig{
+		DataDir:           dataDir,
+		MarshalFn:         UnmarshallTestStruct,
+		DefaultExpiration: time.Minute,
+	}
+	ca, err := cache.NewCacheService(cacheCfg, testLogger)
+	require.NoError(t, err)
+	closeOnCleanup(t, ca)
+
+	err = ca.SetWithSoftHard("default", TestStruct{Name: "John", Age: 34}, 30*time.Second, cache.USE_DEFAULT_EXPIRATION)
+	require.NoError(t, err)
+	err = ca.SetWithSoftHard("forever", TestStruct{Name: "Jane", Age: 29}, time.Hour, cache.NO_EXPIRATION)
+	require.NoError(t, err)
+	err = ca.SetWithSoftHard("too-soft", TestStruct{Name: "Jack", Age: 40}, 2*time.Minute, cache.USE_DEFAULT_EXPIRATION)
+	require.Equal(t, cache.ErrInvalidSoftTTL, err)
+}
+
+func TestSoftTTLSurvivesReload(t *testing.T) {
+	for name, cfg := range map[string]cache.CacheConfig{
+		"plain": {},
+		"dedup": {DedupValues: true},
+	} {
+		t.Run(name, func(t *testing.T) {
+			dataDir := t.TempDir()
+			testLogger := logger.NewTestAppLogger(dataDir)
+			cfg.DataDir = dataDir
+			cfg.MarshalFn = UnmarshallTestStruct
+			ca, err := cache.NewCacheService(cfg, testLogger)
+			require.NoError(t, err)
+			closeOnCleanup(t, ca)
+
+			err = ca.SetWithSoftHard("soon", TestStruct{Name: "John", Age: 34}, 200*time.Millisecond, 5*time.Minute)
+			require.NoError(t, err)
+			err = ca.SetWithSoftHard("later", TestStruct{Name: "Jane", Age: 29}, time.Minute, 5*time.Minute)
+			require.NoError(t, err)
+			err = ca.Clear()
+			require.NoError(t, err)
+
+			ca, err = cache.NewCacheService(cfg, testLogger)
+			require.NoError(t, err)
+			closeOnCleanup(t, ca)
+			_, stale, ok := ca.GetWithStaleness("soon")
+			require.Equal(t, true, ok)
+			require.Equal(t, false, stale)
+
+			time.Sleep(250 * time.Millisecond)
+			_, stale, ok = ca.GetWithStaleness("soon")
+			require.Equal(t, true, ok)
+			require.Equal(t, true, stale)
+			val, stale, ok := ca.GetWithStaleness("later")
+			require.Equal(t, true, ok)
+			require.Equal(t, false, stale)
+			require.Equal(t, TestStruct{Name: "Jane", Age: 29}, val)
+		})
+	}
+}
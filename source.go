@@ -0,0 +1,98 @@
+package cache
+
+import (
+	"context"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.uber.org/zap"
+
+	"github.com/comfforts/errors"
+)
+
+// Source is a backing store consulted on cache misses. Fetch returns found as false
+// when the key doesn't exist in the source, a non-nil error signals a source failure.
+type Source interface {
+	Fetch(ctx context.Context, key string) (interface{}, time.Duration, bool, error)
+}
+
+// BatchSource is implemented by sources that can fetch several keys in one call,
+// keys missing from the result are treated as not found.
+type BatchSource interface {
+	FetchMany(ctx context.Context, keys []string) (map[string]interface{}, error)
+}
+
+// NamedSource is implemented by sources that want their fetches
+// reported under their own name in Stats.
+type NamedSource interface {
+	Source
+	Name() string
+}
+
+// fetch calls the source, tracing it under spanName and recording its latency in Stats.
+func (c *cacheService) fetch(ctx context.Context, src Source, key, spanName string) (interface{}, time.Duration, bool, error) {
+	ctx, span := c.startSpan(ctx, spanName, attribute.String("key", key))
+	start := time.Now()
+	val, d, found, err := src.Fetch(ctx, key)
+	c.stats.recordLoad(loaderName(src), time.Since(start), err)
+	span.SetAttributes(attribute.Bool("hit", found))
+	endSpan(span, err)
+	return val, d, found, err
+}
+
+// GetMany returns the cached values for keys, fetching the misses from the source
+// in a single call when it implements BatchSource.
+func (c *cacheService) GetMany(ctx context.Context, keys []string) (map[string]interface{}, error) {
+	values := map[string]interface{}{}
+	missing := []string{}
+	for _, key := range keys {
+		if val, _, ok := c.lookup(key); ok {
+			values[key] = val
+		} else {
+			missing = append(missing, key)
+		}
+	}
+
+	src := c.getSource()
+	if len(missing) == 0 || src == nil {
+		return values, nil
+	}
+
+	batch, ok := src.(BatchSource)
+	if !ok {
+		for _, key := range missing {
+			val, _, err := c.GetWithContext(ctx, key)
+			if err == ErrKeyNotFound {
+				continue
+			}
+			if err != nil {
+				return values, err
+			}
+			values[key] = val
+		}
+		return values, nil
+	}
+
+	ctx, span := c.startSpan(ctx, "cache.source.fetch_many", attribute.Int("keys", len(missing)))
+	start := time.Now()
+	fetched, err := batch.FetchMany(ctx, missing)
+	c.stats.recordLoad(loaderName(src), time.Since(start), err)
+	span.SetAttributes(attribute.Int("found", len(fetched)))
+	endSpan(span, err)
+	if err != nil {
+		c.Error("error fetching values from source", zap.Error(err), zap.Int("keys", len(missing)))
+		return values, errors.WrapError(err, ERROR_FETCHING_SOURCE)
+	}
+
+	for _, key := range missing {
+		val, ok := fetched[key]
+		if !ok {
+			continue
+		}
+		if err := c.setFromSource(key, val, USE_DEFAULT_EXPIRATION); err != nil {
+			c.Error("error caching source value", zap.Error(err), zap.String("key", key))
+		}
+		values[key] = val
+	}
+	return values, nil
+}
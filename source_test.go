@@ -0,0 +1,277 @@
+package cache_test
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/comfforts/cache"
+	"github.com/comfforts/logger"
+)
+
+type fakeSource struct {
+	mu     sync.Mutex
+	values map[string]interface{}
+	err    error
+	calls  int
+	delay  time.Duration
+}
+
+func (s *fakeSource) Fetch(ctx context.Context, key string) (interface{}, time.Duration, bool, error) {
+	time.Sleep(s.delay)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.calls++
+	if s.err != nil {
+		return nil, 0, false, s.err
+	}
+	val, ok := s.values[key]
+	return val, 5 * time.Minute, ok, nil
+}
+
+func (s *fakeSource) Calls() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.calls
+}
+
+func setupSourceTest(t *testing.T) (cache.CacheService, *fakeSource) {
+	t.Helper()
+
+	dataDir := t.TempDir()
+	testLogger := logger.NewTestAppLogger(dataDir)
+	cacheCfg := cache.CacheConfig{
+		DataDir:   dataDir,
+		MarshalFn: UnmarshallTestStruct,
+	}
+	ca, err := cache.NewCacheService(cacheCfg, testLogger)
+	require.NoError(t, err)
+	closeOnCleanup(t, ca)
+
+	src := &fakeSource{
+		values: map[string]interface{}{
+			"source": TestStruct{Name: "Jane", Age: 29},
+		},
+	}
+	ca.SetSource(src)
+	return ca, src
+}
+
+func TestReadThroughSource(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("cache hit skips source", func(t *testing.T) {
+		ca, src := setupSourceTest(t)
+		val := TestStruct{Name: "John", Age: 34}
+		err := ca.Set("cached", val, 5*time.Minute)
+		require.NoError(t, err)
+
+		cVal, _, err := ca.GetWithContext(ctx, "cached")
+		require.NoError(t, err)
+		require.Equal(t, val, cVal)
+		require.Equal(t, 0, src.Calls())
+	})
+
+	t.Run("source hit is cached", func(t *testing.T) {
+		ca, src := setupSourceTest(t)
+		now := time.Now().Unix()
+		cVal, exp := ca.Get("source")
+		require.Equal(t, TestStruct{Name: "Jane", Age: 29}, cVal)
+		require.Equal(t, int64(300), exp.Unix()-now)
+		require.Equal(t, 1, src.Calls())
+
+		cVal, _, err := ca.GetWithContext(ctx, "source")
+		require.NoError(t, err)
+		require.Equal(t, TestStruct{Name: "Jane", Age: 29}, cVal)
+		require.Equal(t, 1, src.Calls())
+		require.Equal(t, 1, ca.ItemCount())
+	})
+
+	t.Run("source miss", func(t *testing.T) {
+		ca, src := setupSourceTest(t)
+		cVal, _, err := ca.GetWithContext(ctx, "missing")
+		require.Equal(t, true, errors.Is(err, cache.ErrKeyNotFound))
+		require.Nil(t, cVal)
+		require.Equal(t, 1, src.Calls())
+		require.Equal(t, 0, ca.ItemCount())
+	})
+
+	t.Run("source error", func(t *testing.T) {
+		ca, src := setupSourceTest(t)
+		src.err = errors.New("source unavailable")
+
+		cVal, _, err := ca.GetWithContext(ctx, "source")
+		require.Error(t, err)
+		require.Equal(t, false, errors.Is(err, cache.ErrKeyNotFound))
+		require.Nil(t, cVal)
+
+		cVal, _ = ca.Get("source")
+		require.Nil(t, cVal)
+		require.Equal(t, 0, ca.ItemCount())
+	})
+}
+
+func TestStaleWhileRevalidate(t *testing.T) {
+	dataDir := t.TempDir()
+	testLogger := logger.NewTestAppLogger(dataDir)
+	cacheCfg := cache.CacheConfig{
+		DataDir:              dataDir,
+		MarshalFn:            UnmarshallTestStruct,
+		StaleWhileRevalidate: time.Minute,
+	}
+	ca, err := cache.NewCacheService(cacheCfg, testLogger)
+	require.NoError(t, err)
+	closeOnCleanup(t, ca)
+
+	src := &fakeSource{
+		values: map[string]interface{}{
+			"key": TestStruct{Name: "Fresh", Age: 2},
+		},
+		delay: 200 * time.Millisecond,
+	}
+	ca.SetSource(src)
+
+	err = ca.Set("key", TestStruct{Name: "Stale", Age: 1}, 50*time.Millisecond)
+	require.NoError(t, err)
+	time.Sleep(100 * time.Millisecond)
+
+	for i := 0; i < 3; i++ {
+		start := time.Now()
+		cVal, exp := ca.Get("key")
+		require.Less(t, time.Since(start), src.delay)
+		require.Equal(t, TestStruct{Name: "Stale", Age: 1}, cVal)
+		require.Equal(t, true, exp.Before(time.Now()))
+	}
+
+	require.Eventually(t, func() bool {
+		cVal, _ := ca.Get("key")
+		return cVal == TestStruct{Name: "Fresh", Age: 2}
+	}, 2*time.Second, 20*time.Millisecond)
+	require.Equal(t, 1, src.Calls())
+
+	_, exp := ca.Get("key")
+	require.WithinDuration(t, time.Now().Add(5*time.Minute), exp, time.Second)
+}
+
+type namedSource struct {
+	*fakeSource
+	name string
+}
+
+func (s *namedSource) Name() string {
+	return s.name
+}
+
+func TestLoaderStats(t *testing.T) {
+	ca, src := setupSourceTest(t)
+	src.delay = 20 * time.Millisecond
+	ca.SetSource(&namedSource{fakeSource: src, name: "users"})
+
+	cVal, _ := ca.Get("source")
+	require.Equal(t, TestStruct{Name: "Jane", Age: 29}, cVal)
+	cVal, _ = ca.Get("missing")
+	require.Nil(t, cVal)
+
+	src.mu.Lock()
+	src.err = errors.New("backend unavailable")
+	src.mu.Unlock()
+	cVal, _ = ca.Get("other")
+	require.Nil(t, cVal)
+
+	stats, ok := ca.Stats().Loaders["users"]
+	require.Equal(t, true, ok)
+	require.Equal(t, int64(3), stats.Calls)
+	require.Equal(t, int64(1), stats.Errors)
+	require.GreaterOrEqual(t, stats.TotalLatency, 3*src.delay)
+	require.GreaterOrEqual(t, stats.MaxLatency, src.delay)
+	require.GreaterOrEqual(t, stats.AvgLatency(), src.delay)
+
+	_, ok = ca.Stats().Loaders[cache.DEFAULT_LOADER_NAME]
+	require.Equal(t, false, ok)
+}
+
+type fakeBatchSource struct {
+	*fakeSource
+	requested [][]string
+}
+
+func (s *fakeBatchSource) FetchMany(ctx context.Context, keys []string) (map[string]interface{}, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.requested = append(s.requested, keys)
+	values := map[string]interface{}{}
+	for _, key := range keys {
+		if val, ok := s.values[key]; ok {
+			values[key] = val
+		}
+	}
+	return values, nil
+}
+
+func TestGetManyBatchSource(t *testing.T) {
+	ca, src := setupSourceTest(t)
+	src.values["batch"] = TestStruct{Name: "Jim", Age: 41}
+	batch := &fakeBatchSource{fakeSource: src}
+	ca.SetSource(batch)
+
+	err := ca.Set("cached", TestStruct{Name: "John", Age: 34}, 5*time.Minute)
+	require.NoError(t, err)
+
+	values, err := ca.GetMany(context.Background(), []string{"cached", "source", "batch", "missing"})
+	require.NoError(t, err)
+	require.Equal(t, map[string]interface{}{
+		"cached": TestStruct{Name: "John", Age: 34},
+		"source": TestStruct{Name: "Jane", Age: 29},
+		"batch":  TestStruct{Name: "Jim", Age: 41},
+	}, values)
+	require.Equal(t, [][]string{{"source", "batch", "missing"}}, batch.requested)
+	require.Equal(t, 0, src.Calls())
+
+	values, err = ca.GetMany(context.Background(), []string{"source", "batch"})
+	require.NoError(t, err)
+	require.Equal(t, 2, len(values))
+	require.Equal(t, 1, len(batch.requested))
+}
+
+func TestSourceFillsSkipSink(t *testing.T) {
+	dataDir := t.TempDir()
+	testLogger := logger.NewTestAppLogger(dataDir)
+	cacheCfg := cache.CacheConfig{
+		DataDir:             dataDir,
+		MarshalFn:           UnmarshallTestStruct,
+		WriteBehindInterval: 10 * time.Millisecond,
+	}
+	ca, err := cache.NewCacheService(cacheCfg, testLogger)
+	require.NoError(t, err)
+	closeOnCleanup(t, ca)
+
+	src := &fakeSource{
+		values: map[string]interface{}{
+			"source": TestStruct{Name: "Jane", Age: 29},
+			"batch":  TestStruct{Name: "Jim", Age: 41},
+		},
+	}
+	ca.SetSource(src)
+	sink := newFakeSink(0)
+	ca.SetSink(sink)
+
+	cVal, _ := ca.Get("source")
+	require.Equal(t, TestStruct{Name: "Jane", Age: 29}, cVal)
+	ca.SetSource(&fakeBatchSource{fakeSource: src})
+	values, err := ca.GetMany(context.Background(), []string{"batch"})
+	require.NoError(t, err)
+	require.Equal(t, 1, len(values))
+
+	// only the write made through the cache reaches the sink
+	err = ca.Set("cached", TestStruct{Name: "John", Age: 34}, 5*time.Minute)
+	require.NoError(t, err)
+	require.Eventually(t, func() bool {
+		return sink.Len() == 1
+	}, time.Second, 10*time.Millisecond)
+	time.Sleep(50 * time.Millisecond)
+	require.Equal(t, 1, sink.Len())
+}
@@ -0,0 +1,170 @@
+package cache
+
+import (
+	"encoding/json"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const DEFAULT_LOADER_NAME = "default"
+
+// where the cache was last restored from, empty until a load succeeds
+const (
+	LOAD_SOURCE_LOCAL = "local"
+	LOAD_SOURCE_CLOUD = "cloud"
+	LOAD_SOURCE_URL   = "url"
+)
+
+// Stats is a point in time snapshot of the cache's counters, Hits and Misses
+// count reads answered from memory or not, whether or not a source filled them.
+type Stats struct {
+	Hits           int64
+	Misses         int64
+	LastLoadSource string
+	Loaders        map[string]LoaderStats
+}
+
+// LoaderStats covers source fetches, Errors counts failed fetches, not misses.
+type LoaderStats struct {
+	Calls        int64
+	Errors       int64
+	TotalLatency time.Duration
+	MaxLatency   time.Duration
+}
+
+func (s LoaderStats) AvgLatency() time.Duration {
+	if s.Calls == 0 {
+		return 0
+	}
+	return s.TotalLatency / time.Duration(s.Calls)
+}
+
+type loaderCounters struct {
+	calls   atomic.Int64
+	errors  atomic.Int64
+	total   atomic.Int64
+	maxNano atomic.Int64
+}
+
+type cacheStats struct {
+	hits       atomic.Int64
+	misses     atomic.Int64
+	loadSource atomic.Value
+	loaders    sync.Map
+}
+
+func (s *cacheStats) recordRead(hit bool) {
+	if hit {
+		s.hits.Add(1)
+	} else {
+		s.misses.Add(1)
+	}
+}
+
+// hitRatio is hits over all reads, 0 before the first read.
+func (s *cacheStats) hitRatio() float64 {
+	hits, misses := s.hits.Load(), s.misses.Load()
+	if hits+misses == 0 {
+		return 0
+	}
+	return float64(hits) / float64(hits+misses)
+}
+
+func (s *cacheStats) recordLoadSource(source string) {
+	s.loadSource.Store(source)
+}
+
+func (s *cacheStats) recordLoad(name string, dur time.Duration, err error) {
+	v, _ := s.loaders.LoadOrStore(name, &loaderCounters{})
+	lc := v.(*loaderCounters)
+	lc.calls.Add(1)
+	if err != nil {
+		lc.errors.Add(1)
+	}
+	lc.total.Add(int64(dur))
+	for {
+		max := lc.maxNano.Load()
+		if int64(dur) <= max || lc.maxNano.CompareAndSwap(max, int64(dur)) {
+			break
+		}
+	}
+}
+
+func (s *cacheStats) snapshot() Stats {
+	stats := Stats{
+		Hits:    s.hits.Load(),
+		Misses:  s.misses.Load(),
+		Loaders: map[string]LoaderStats{},
+	}
+	stats.LastLoadSource, _ = s.loadSource.Load().(string)
+	s.loaders.Range(func(k, v interface{}) bool {
+		lc := v.(*loaderCounters)
+		stats.Loaders[k.(string)] = LoaderStats{
+			Calls:        lc.calls.Load(),
+			Errors:       lc.errors.Load(),
+			TotalLatency: time.Duration(lc.total.Load()),
+			MaxLatency:   time.Duration(lc.maxNano.Load()),
+		}
+		return true
+	})
+	return stats
+}
+
+func loaderName(src Source) string {
+	if named, ok := src.(NamedSource); ok && named.Name() != "" {
+		return named.Name()
+	}
+	return DEFAULT_LOADER_NAME
+}
+
+func (c *cacheService) Stats() Stats {
+	return c.stats.snapshot()
+}
+
+// metricsJSON is the MetricsJSON document, durations are in milliseconds.
+type metricsJSON struct {
+	Hits           int64                 `json:"hits"`
+	Misses         int64                 `json:"misses"`
+	ItemCount      int                   `json:"item_count"`
+	BackupAgeMs    *int64                `json:"backup_age_ms"`
+	LastLoadSource string                `json:"last_load_source"`
+	Loaders        map[string]loaderJSON `json:"loaders"`
+}
+
+type loaderJSON struct {
+	Calls        int64 `json:"calls"`
+	Errors       int64 `json:"errors"`
+	AvgLatencyMs int64 `json:"avg_latency_ms"`
+	MaxLatencyMs int64 `json:"max_latency_ms"`
+}
+
+// MetricsJSON returns the cache's stats as JSON for debug endpoints,
+// backup_age_ms is null until a cloud upload succeeds.
+func (c *cacheService) MetricsJSON() ([]byte, error) {
+	stats := c.Stats()
+	m := metricsJSON{
+		Hits:           stats.Hits,
+		Misses:         stats.Misses,
+		ItemCount:      c.count(),
+		LastLoadSource: stats.LastLoadSource,
+		Loaders:        map[string]loaderJSON{},
+	}
+	if age, ok := c.BackupAge(); ok {
+		ms := age.Milliseconds()
+		m.BackupAgeMs = &ms
+	}
+	for name, ls := range stats.Loaders {
+		m.Loaders[name] = loaderJSON{
+			Calls:        ls.Calls,
+			Errors:       ls.Errors,
+			AvgLatencyMs: ls.AvgLatency().Milliseconds(),
+			MaxLatencyMs: ls.MaxLatency.Milliseconds(),
+		}
+	}
+	return json.Marshal(m)
+}
+
+func (c *cacheService) HitRatio() float64 {
+	return c.stats.hitRatio()
+}
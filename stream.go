@@ -0,0 +1,204 @@
+package cache
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"path/filepath"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.uber.org/zap"
+
+	"github.com/comfforts/cloudstorage"
+	"github.com/comfforts/errors"
+)
+
+// limitedWriter fails writes once more than max bytes went through it.
+type limitedWriter struct {
+	w       io.Writer
+	max     int64
+	written int64
+}
+
+func (l *limitedWriter) Write(p []byte) (int, error) {
+	l.written += int64(len(p))
+	if l.written > l.max {
+		return 0, ErrFileTooLarge
+	}
+	return l.w.Write(p)
+}
+
+// streamCloudCache encodes the items straight into the cloud upload, for SkipLocalFile.
+func (c *cacheService) streamCloudCache(force bool) (err error) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var n int64
+	skipped := false
+	start := time.Now()
+	ctx, span := c.startSpan(ctx, "cache.cloud.upload", attribute.Bool("stream", true))
+	defer func() {
+		if !skipped {
+			if err == nil {
+				c.lastUploadAt.Store(time.Now().UnixNano())
+			}
+			c.recordCloudSync(CLOUD_OP_UPLOAD, start, n, err)
+		}
+		endSpan(span, err)
+	}()
+
+	if c.StoreConfig.CloudClient == nil {
+		c.Error("missing cloud storage client")
+		return errors.NewAppError("missing cloud storage client")
+	}
+
+	cacheFile := filepath.Join(c.DataDir, fmt.Sprintf("%s.json", c.CacheFileName))
+	localMod := time.Unix(0, c.updatedAt.Load())
+	cfr, err := cloudstorage.NewCloudFileRequest(
+		c.cloudBucket(),
+		filepath.Base(cacheFile),
+		filepath.Dir(cacheFile),
+		localMod.Unix(),
+	)
+	if err != nil {
+		c.Error("error creating file upload request", zap.Error(err), zap.String("filepath", cacheFile))
+		return err
+	}
+
+	decision := c.uploadDecision(ctx, cfr, localMod, force, cacheFile)
+	span.SetAttributes(attribute.String("decision", decision))
+	if decision == UPLOAD_DECISION_SKIPPED_UNCHANGED {
+		skipped = true
+		return nil
+	}
+
+	pr, pw := io.Pipe()
+	go func() {
+		var w io.Writer = pw
+		if c.MaxFileBytes > 0 {
+			w = &limitedWriter{w: pw, max: c.MaxFileBytes}
+		}
+		pw.CloseWithError(c.encodeItems(w))
+	}()
+	// streamed saves don't know their size so they're chunked whenever chunking is set up
+	n, err = c.putCloudObject(ctx, pr, cfr, time.Now(), -1)
+	// unblocks the encoder when the client stops reading early
+	pr.Close()
+	if err != nil {
+		c.Error("error streaming cache to cloud", zap.Error(err), zap.String("filepath", cacheFile))
+		return err
+	}
+	span.SetAttributes(attribute.Int64("bytes", n))
+	c.Info("streamed cache to cloud",
+		zap.String("file", filepath.Base(cacheFile)),
+		zap.String("path", filepath.Dir(cacheFile)),
+		zap.Int64("bytes", n),
+	)
+	return nil
+}
+
+// loadCloudStream restores the cloud backup into memory without writing it locally, for SkipLocalFile.
+func (c *cacheService) loadCloudStream(filePath string) error {
+	buf, err := c.downloadCloudBytes(context.Background())
+	if err != nil {
+		return errors.WrapError(err, "error getting cache file from storage")
+	}
+
+	repaired, err := c.load(buf, filePath)
+	if err != nil {
+		return errors.WrapError(err, ERROR_LOADING_CACHE_FILE)
+	}
+	c.stats.recordLoadSource(LOAD_SOURCE_CLOUD)
+	if repaired {
+		c.rewriteRepaired(filePath)
+	}
+	return nil
+}
+
+// FetchFromCloud reads key from the cloud backup and restores it into memory,
+// false if the backup doesn't hold an unexpired copy.
+func (c *cacheService) FetchFromCloud(ctx context.Context, key string) (interface{}, bool, error) {
+	if c.StoreConfig.CloudClient == nil {
+		return nil, false, ErrCloudNotConfigured
+	}
+
+	buf, err := c.downloadCloudBytes(ctx)
+	if err != nil {
+		return nil, false, err
+	}
+	items, err := c.decodeItems(buf)
+	if err != nil {
+		return nil, false, errors.WrapError(err, ERROR_LOADING_CACHE_FILE)
+	}
+	item, ok := items[key]
+	if !ok || item.Expired() {
+		return nil, false, nil
+	}
+
+	saved, staleAt := unwrapStale(item.Object)
+	plain, isSensitive, err := c.openSensitive(saved)
+	if err != nil {
+		return nil, false, err
+	}
+	obj, err := c.marshal(plain)
+	if err != nil {
+		return nil, false, err
+	}
+
+	d, ok := restoreTTL(item)
+	if !ok {
+		return nil, false, nil
+	}
+	// restored like a load, so a fetch isn't held to the Set rate limit
+	_, err = c.restoreItem(key, obj, d, false)
+	if err != nil {
+		return nil, false, err
+	}
+	if isSensitive {
+		c.sensitive.add(key)
+	}
+	if staleAt > 0 {
+		c.softTTLs.record(key, time.Unix(0, staleAt))
+	}
+	c.updatedAt.Store(time.Now().UnixNano())
+	return obj, true, nil
+}
+
+// downloadCloudBytes reads the whole cloud backup into memory.
+func (c *cacheService) downloadCloudBytes(ctx context.Context) (buf *bytes.Buffer, err error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var n int64
+	start := time.Now()
+	ctx, span := c.startSpan(ctx, "cache.cloud.download", attribute.Bool("stream", true))
+	defer func() {
+		c.recordCloudSync(CLOUD_OP_DOWNLOAD, start, n, err)
+		endSpan(span, err)
+	}()
+
+	cacheFile := filepath.Join(c.DataDir, fmt.Sprintf("%s.json", c.CacheFileName))
+	cfr, err := cloudstorage.NewCloudFileRequest(
+		c.cloudBucket(),
+		filepath.Base(cacheFile),
+		filepath.Dir(cacheFile),
+		0,
+	)
+	if err != nil {
+		c.Error("error creating cloud download request", zap.Error(err), zap.String("filepath", cacheFile))
+		return nil, err
+	}
+
+	buf = &bytes.Buffer{}
+	n, err = c.StoreConfig.CloudClient.DownloadFile(ctx, buf, cfr)
+	if err != nil {
+		c.Error("error downloading file", zap.Error(err), zap.String("filepath", cacheFile))
+		return nil, err
+	}
+	if err = c.checkDownloadSize(ctx, cfr, n, cacheFile); err != nil {
+		return nil, err
+	}
+	return buf, nil
+}
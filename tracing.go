@@ -0,0 +1,28 @@
+package cache
+
+import (
+	"context"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const TRACER_NAME = "github.com/comfforts/cache"
+
+// startSpan starts a span when a TracerProvider is configured,
+// otherwise it returns the non-recording span already in context.
+func (c *cacheService) startSpan(ctx context.Context, name string, attrs ...attribute.KeyValue) (context.Context, trace.Span) {
+	if c.TracerProvider == nil {
+		return ctx, trace.SpanFromContext(ctx)
+	}
+	return c.TracerProvider.Tracer(TRACER_NAME).Start(ctx, name, trace.WithAttributes(attrs...))
+}
+
+func endSpan(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
@@ -0,0 +1,61 @@
+package cache_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+
+	"github.com/comfforts/cache"
+	"github.com/comfforts/logger"
+)
+
+func TestTracingSpans(t *testing.T) {
+	dataDir := t.TempDir()
+	testLogger := logger.NewTestAppLogger(dataDir)
+
+	recorder := tracetest.NewSpanRecorder()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+
+	cacheCfg := cache.CacheConfig{
+		DataDir:        dataDir,
+		MarshalFn:      UnmarshallTestStruct,
+		TracerProvider: provider,
+	}
+	client := newFakeCloudClient()
+	cloudCfg := cache.CacheStorageConfig{
+		Bucket:      "test-bucket",
+		CloudClient: client,
+	}
+	ca, err := cache.NewWithCloudBackup(cacheCfg, cloudCfg, testLogger)
+	require.NoError(t, err)
+	closeOnCleanup(t, ca)
+
+	err = ca.Set("test", TestStruct{Name: "John", Age: 34}, 5*time.Minute)
+	require.NoError(t, err)
+
+	err = ca.Clear()
+	require.NoError(t, err)
+
+	spans := map[string]sdktrace.ReadOnlySpan{}
+	for _, span := range recorder.Ended() {
+		spans[span.Name()] = span
+	}
+
+	_, ok := spans["cache.load"]
+	require.Equal(t, true, ok)
+	_, ok = spans["cache.cloud.download"]
+	require.Equal(t, true, ok)
+
+	upload, ok := spans["cache.cloud.upload"]
+	require.Equal(t, true, ok)
+	var bytes int64
+	for _, attr := range upload.Attributes() {
+		if attr.Key == "bytes" {
+			bytes = attr.Value.AsInt64()
+		}
+	}
+	require.Greater(t, bytes, int64(0))
+}
@@ -0,0 +1,66 @@
+package cache
+
+import (
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// TransformAll replaces the value of every live item for which fn returns true with the value
+// fn returns, keeping expirations, and returns how many it replaced. The store is locked
+// throughout so fn sees a consistent view, it must not call back into the cache.
+func (c *cacheService) TransformAll(fn func(key string, value interface{}) (interface{}, bool)) int {
+	type change struct {
+		key   string
+		value interface{}
+		exp   int64
+	}
+	changes := []change{}
+
+	c.storeMu.Lock()
+	c.cache.DeleteExpired()
+	items := c.cache.Items()
+	for k, item := range items {
+		value, ok := fn(k, c.resolve(item.Object))
+		if !ok {
+			continue
+		}
+		stored, err := c.encodeValue(value)
+		if err != nil {
+			c.Error(ERROR_MARSHALLING_CACHE_OBJECT, zap.Error(err), zap.String("key", k))
+			continue
+		}
+		item.Object = c.blobs.intern(stored)
+		items[k] = item
+		changes = append(changes, change{key: k, value: value, exp: item.Expiration})
+	}
+	if len(changes) > 0 {
+		// rebuilding keeps expirations exact where a Set would take a duration
+		c.cache = c.newStoreFrom(items)
+		// hot entries go while the lock is held so no reader sees them next to the new values
+		for _, ch := range changes {
+			c.hot.invalidate(ch.key)
+		}
+		c.updatedAt.Store(time.Now().UnixNano())
+	}
+	c.storeMu.Unlock()
+	if len(changes) > 0 {
+		c.pruneBlobs()
+	}
+
+	wb := c.getWriteBehind()
+	for _, ch := range changes {
+		d := NO_EXPIRATION
+		if ch.exp > 0 {
+			d = time.Until(time.Unix(0, ch.exp))
+		}
+		c.getReplica().enqueue(replicaOp{kind: replicaSet, key: ch.key, value: ch.value, d: d, sensitive: c.sensitive.has(ch.key)})
+		if wb != nil {
+			if err := wb.enqueue(ch.key, ch.value); err != nil {
+				c.Error("error queueing transformed value", zap.Error(err), zap.String("key", ch.key))
+			}
+		}
+	}
+	c.Info("transformed cache values", zap.Int("count", len(changes)), zap.String("cacheDir", c.DataDir))
+	return len(changes)
+}
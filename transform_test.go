@@ -0,0 +1,66 @@
+package cache_test
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/comfforts/cache"
+	"github.com/comfforts/logger"
+)
+
+func TestTransformAll(t *testing.T) {
+	for _, storeMarshalled := range []bool{false, true} {
+		t.Run(fmt.Sprintf("StoreMarshalled=%t", storeMarshalled), func(t *testing.T) {
+			dataDir := t.TempDir()
+			testLogger := logger.NewTestAppLogger(dataDir)
+			cacheCfg := cache.CacheConfig{
+				DataDir:         dataDir,
+				MarshalFn:       UnmarshallTestStruct,
+				StoreMarshalled: storeMarshalled,
+			}
+			ca, err := cache.NewCacheService(cacheCfg, testLogger)
+			require.NoError(t, err)
+			closeOnCleanup(t, ca)
+
+			for i := 0; i < 10; i++ {
+				err = ca.Set(fmt.Sprintf("user:%d", i), TestStruct{Name: "john", Age: i}, time.Duration(i+1)*time.Minute)
+				require.NoError(t, err)
+			}
+			err = ca.Set("config", TestStruct{Name: "settings", Age: 0}, cache.NO_EXPIRATION)
+			require.NoError(t, err)
+			before := ca.Items()
+
+			changed := ca.TransformAll(func(key string, value interface{}) (interface{}, bool) {
+				if !strings.HasPrefix(key, "user:") {
+					return nil, false
+				}
+				v := value.(TestStruct)
+				v.Name = strings.ToUpper(v.Name)
+				v.Age += 100
+				return v, true
+			})
+			require.Equal(t, 10, changed)
+
+			after := ca.Items()
+			require.Equal(t, len(before), len(after))
+			for i := 0; i < 10; i++ {
+				key := fmt.Sprintf("user:%d", i)
+				cVal, _ := ca.Get(key)
+				require.Equal(t, TestStruct{Name: "JOHN", Age: i + 100}, cVal)
+				require.Equal(t, before[key].Expiration, after[key].Expiration)
+			}
+			cVal, exp := ca.Get("config")
+			require.Equal(t, TestStruct{Name: "settings", Age: 0}, cVal)
+			require.True(t, exp.IsZero())
+
+			changed = ca.TransformAll(func(key string, value interface{}) (interface{}, bool) {
+				return nil, false
+			})
+			require.Equal(t, 0, changed)
+		})
+	}
+}
@@ -0,0 +1,126 @@
+package cache
+
+import (
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// CacheTx buffers the sets and deletes of a Transaction.
+type CacheTx interface {
+	Set(key string, value interface{}, d time.Duration) error
+	Delete(key string)
+}
+
+type txOp struct {
+	key string
+	set *pendingSet
+}
+
+type cacheTx struct {
+	c   *cacheService
+	ops []txOp
+}
+
+// Set readies value as Set would, so encoding errors fail the transaction early.
+func (tx *cacheTx) Set(key string, value interface{}, d time.Duration) error {
+	p, err := tx.c.prepareSet(key, value, d, setOptions{})
+	if err != nil {
+		return err
+	}
+	if p != nil {
+		tx.ops = append(tx.ops, txOp{key: key, set: p})
+	}
+	return nil
+}
+
+func (tx *cacheTx) Delete(key string) {
+	tx.ops = append(tx.ops, txOp{key: key})
+}
+
+// Transaction applies the sets and deletes fn buffers all at once, readers see either none or
+// all of them. Nothing is applied when fn returns an error.
+func (c *cacheService) Transaction(fn func(tx CacheTx) error) error {
+	tx := &cacheTx{c: c}
+	if err := fn(tx); err != nil {
+		c.Debug("discarded cache transaction", zap.Error(err), zap.Int("ops", len(tx.ops)))
+		return err
+	}
+	if len(tx.ops) == 0 {
+		return nil
+	}
+
+	if err := c.applyTx(tx.ops); err != nil {
+		c.Error(ERROR_CACHE_FULL, zap.Int("ops", len(tx.ops)), zap.Int("maxItems", c.MaxItems))
+		return err
+	}
+
+	// side effects follow only the last op on each key, what the transaction left behind
+	last := map[string]int{}
+	for i, op := range tx.ops {
+		last[op.key] = i
+	}
+	var wbErr error
+	for i, op := range tx.ops {
+		if last[op.key] != i {
+			continue
+		}
+		if op.set == nil {
+			c.getReplica().enqueue(replicaOp{kind: replicaDelete, key: op.key})
+			continue
+		}
+		if err := c.setDone(op.set); err != nil && wbErr == nil {
+			wbErr = err
+		}
+	}
+	c.Debug("applied cache transaction", zap.Int("ops", len(tx.ops)))
+	return wbErr
+}
+
+// applyTx stores ops under the exclusive lock, checking up front that
+// they fit under MaxItems so they're applied all or not at all.
+func (c *cacheService) applyTx(ops []txOp) error {
+	c.storeMu.Lock()
+	defer c.storeMu.Unlock()
+
+	if c.MaxItems > 0 && c.RejectOnFull {
+		c.cache.DeleteExpired()
+		present := map[string]bool{}
+		count := c.cache.ItemCount()
+		for _, op := range ops {
+			was, seen := present[op.key]
+			if !seen {
+				_, was = c.cache.Get(op.key)
+			}
+			is := op.set != nil
+			present[op.key] = is
+			if is && !was {
+				count++
+			} else if !is && was {
+				count--
+			}
+		}
+		if count > c.MaxItems {
+			return ErrCacheFull
+		}
+	}
+
+	for _, op := range ops {
+		// hot entries go while the lock is held so no reader sees them next to the new values
+		c.hot.invalidate(op.key)
+		if op.set == nil {
+			c.deletions.expect(op.key, DeletionExplicit)
+			c.cache.Delete(op.key)
+			c.deletions.done(op.key)
+			continue
+		}
+		if _, found := c.cache.Get(op.key); !found {
+			// can't fail, RejectOnFull was checked above
+			_ = c.makeRoom()
+		}
+		c.cache.Set(op.key, c.blobs.intern(op.set.stored), c.storeTTL(op.set.d))
+		c.access.touch(op.key)
+	}
+	c.updatedAt.Store(time.Now().UnixNano())
+	return nil
+}
@@ -0,0 +1,181 @@
+package cache_test
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/comfforts/cache"
+	"github.com/comfforts/logger"
+)
+
+func TestTransaction(t *testing.T) {
+	dataDir := t.TempDir()
+	testLogger := logger.NewTestAppLogger(dataDir)
+	cacheCfg := cache.CacheConfig{
+		DataDir:   dataDir,
+		MarshalFn: UnmarshallTestStruct,
+	}
+	ca, err := cache.NewCacheService(cacheCfg, testLogger)
+	require.NoError(t, err)
+	closeOnCleanup(t, ca)
+
+	err = ca.Set("john", TestStruct{Name: "John", Age: 34}, 5*time.Minute)
+	require.NoError(t, err)
+	err = ca.Set("jane", TestStruct{Name: "Jane", Age: 29}, 5*time.Minute)
+	require.NoError(t, err)
+
+	errAbort := errors.New("abort")
+	err = ca.Transaction(func(tx cache.CacheTx) error {
+		require.NoError(t, tx.Set("john", TestStruct{Name: "John", Age: 35}, 5*time.Minute))
+		require.NoError(t, tx.Set("jack", TestStruct{Name: "Jack", Age: 41}, 5*time.Minute))
+		tx.Delete("jane")
+		return errAbort
+	})
+	require.Equal(t, errAbort, err)
+	require.Equal(t, 2, ca.ItemCount())
+	cVal, _ := ca.Get("john")
+	require.Equal(t, TestStruct{Name: "John", Age: 34}, cVal)
+	cVal, _ = ca.Get("jane")
+	require.Equal(t, TestStruct{Name: "Jane", Age: 29}, cVal)
+
+	err = ca.Transaction(func(tx cache.CacheTx) error {
+		if err := tx.Set("john", TestStruct{Name: "John", Age: 35}, 5*time.Minute); err != nil {
+			return err
+		}
+		if err := tx.Set("jack", TestStruct{Name: "Jack", Age: 41}, 5*time.Minute); err != nil {
+			return err
+		}
+		tx.Delete("jane")
+		return nil
+	})
+	require.NoError(t, err)
+	require.Equal(t, 2, ca.ItemCount())
+	cVal, _ = ca.Get("john")
+	require.Equal(t, TestStruct{Name: "John", Age: 35}, cVal)
+	cVal, _ = ca.Get("jack")
+	require.Equal(t, TestStruct{Name: "Jack", Age: 41}, cVal)
+	cVal, _ = ca.Get("jane")
+	require.Nil(t, cVal)
+}
+
+func TestTransactionAtomic(t *testing.T) {
+	dataDir := t.TempDir()
+	testLogger := logger.NewTestAppLogger(dataDir)
+	cacheCfg := cache.CacheConfig{
+		DataDir:   dataDir,
+		MarshalFn: UnmarshallTestStruct,
+	}
+	ca, err := cache.NewCacheService(cacheCfg, testLogger)
+	require.NoError(t, err)
+	closeOnCleanup(t, ca)
+
+	setBoth := func(age int) error {
+		return ca.Transaction(func(tx cache.CacheTx) error {
+			if err := tx.Set("from", TestStruct{Name: "from", Age: age}, 5*time.Minute); err != nil {
+				return err
+			}
+			return tx.Set("to", TestStruct{Name: "to", Age: age}, 5*time.Minute)
+		})
+	}
+	require.NoError(t, setBoth(0))
+
+	done := make(chan struct{})
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for {
+			select {
+			case <-done:
+				return
+			default:
+			}
+			items := ca.Items()
+			require.Equal(t, items["from"].Object.(TestStruct).Age, items["to"].Object.(TestStruct).Age)
+		}
+	}()
+	for i := 1; i <= 200; i++ {
+		require.NoError(t, setBoth(i))
+	}
+	close(done)
+	wg.Wait()
+}
+
+func TestTransactionRejectOnFull(t *testing.T) {
+	dataDir := t.TempDir()
+	testLogger := logger.NewTestAppLogger(dataDir)
+	cacheCfg := cache.CacheConfig{
+		DataDir:      dataDir,
+		MarshalFn:    UnmarshallTestStruct,
+		MaxItems:     2,
+		RejectOnFull: true,
+	}
+	ca, err := cache.NewCacheService(cacheCfg, testLogger)
+	require.NoError(t, err)
+	closeOnCleanup(t, ca)
+
+	err = ca.Set("john", TestStruct{Name: "John", Age: 34}, 5*time.Minute)
+	require.NoError(t, err)
+	err = ca.Transaction(func(tx cache.CacheTx) error {
+		if err := tx.Set("jane", TestStruct{Name: "Jane", Age: 29}, 5*time.Minute); err != nil {
+			return err
+		}
+		return tx.Set("jack", TestStruct{Name: "Jack", Age: 41}, 5*time.Minute)
+	})
+	require.Equal(t, cache.ErrCacheFull, err)
+	require.Equal(t, 1, ca.ItemCount())
+
+	// deleting in the same transaction makes room
+	err = ca.Transaction(func(tx cache.CacheTx) error {
+		tx.Delete("john")
+		if err := tx.Set("jane", TestStruct{Name: "Jane", Age: 29}, 5*time.Minute); err != nil {
+			return err
+		}
+		return tx.Set("jack", TestStruct{Name: "Jack", Age: 41}, 5*time.Minute)
+	})
+	require.NoError(t, err)
+	require.Equal(t, 2, ca.ItemCount())
+	cVal, _ := ca.Get("jack")
+	require.Equal(t, TestStruct{Name: "Jack", Age: 41}, cVal)
+}
+
+func TestTransactionSetThenDelete(t *testing.T) {
+	newCache := func() cache.CacheService {
+		dataDir := t.TempDir()
+		cacheCfg := cache.CacheConfig{
+			DataDir:             dataDir,
+			MarshalFn:           UnmarshallTestStruct,
+			WriteBehindInterval: 10 * time.Millisecond,
+		}
+		ca, err := cache.NewCacheService(cacheCfg, logger.NewTestAppLogger(dataDir))
+		require.NoError(t, err)
+		closeOnCleanup(t, ca)
+		return ca
+	}
+	ca, standby := newCache(), newCache()
+	sink := newFakeSink(0)
+	ca.SetSink(sink)
+	ca.ReplicateTo(standby)
+
+	err := ca.Transaction(func(tx cache.CacheTx) error {
+		require.NoError(t, tx.Set("temp", TestStruct{Name: "Temp", Age: 1}, 5*time.Minute))
+		require.NoError(t, tx.Set("kept", TestStruct{Name: "John", Age: 34}, 5*time.Minute))
+		tx.Delete("temp")
+		return nil
+	})
+	require.NoError(t, err)
+	require.Equal(t, 1, ca.ItemCount())
+
+	// the deleted key's set never reaches the sink or the standby
+	require.Eventually(t, func() bool {
+		_, _, ok := standby.Peek("kept")
+		return ok && sink.Len() == 1
+	}, time.Second, 10*time.Millisecond)
+	time.Sleep(50 * time.Millisecond)
+	require.Equal(t, 1, sink.Len())
+	require.Equal(t, 1, standby.ItemCount())
+}
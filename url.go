@@ -0,0 +1,65 @@
+package cache
+
+import (
+	"compress/gzip"
+	"context"
+	"io"
+	"net/http"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/comfforts/errors"
+)
+
+// LoadFromURL loads a cache file served over HTTP into the cache, a non 200 response
+// is an error. Bodies sent gzip encoded are decompressed whether or not the client asked for it.
+func (c *cacheService) LoadFromURL(ctx context.Context, url string) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		c.Error(ERROR_FETCHING_CACHE_URL, zap.Error(err), zap.String("url", url))
+		return errors.WrapError(err, ERROR_FETCHING_CACHE_URL)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		c.Error(ERROR_FETCHING_CACHE_URL, zap.Error(err), zap.String("url", url))
+		return errors.WrapError(err, ERROR_FETCHING_CACHE_URL)
+	}
+	defer func() {
+		if err := resp.Body.Close(); err != nil {
+			c.Error("error closing response body", zap.Error(err), zap.String("url", url))
+		}
+	}()
+	if resp.StatusCode != http.StatusOK {
+		c.Error(ERROR_FETCHING_CACHE_URL, zap.String("url", url), zap.Int("status", resp.StatusCode))
+		return errors.NewAppError("%s: %s", ERROR_FETCHING_CACHE_URL, resp.Status)
+	}
+
+	var body io.Reader = resp.Body
+	// the transport only decodes gzip it asked for itself
+	if resp.Header.Get("Content-Encoding") == "gzip" && !resp.Uncompressed {
+		gz, err := gzip.NewReader(resp.Body)
+		if err != nil {
+			c.Error("error decompressing cache url response", zap.Error(err), zap.String("url", url))
+			return errors.WrapError(err, ERROR_LOADING_CACHE_FILE)
+		}
+		defer gz.Close()
+		body = gz
+	}
+
+	items, err := c.decodeItems(body)
+	if err == ErrUnsupportedVersion {
+		return err
+	}
+	if err != nil {
+		c.Error("error decoding cache url response", zap.Error(err), zap.String("url", url))
+		return errors.WrapError(err, ERROR_LOADING_CACHE_FILE)
+	}
+	if err := c.restoreItems(items, false); err != nil {
+		return err
+	}
+	c.setLoadedAt(time.Now().UnixNano())
+	c.stats.recordLoadSource(LOAD_SOURCE_URL)
+	c.Info("cache loaded from url", zap.String("url", url), zap.Int("items", len(items)))
+	return nil
+}
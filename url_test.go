@@ -0,0 +1,66 @@
+package cache_test
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	gocache "github.com/patrickmn/go-cache"
+	"github.com/stretchr/testify/require"
+
+	"github.com/comfforts/cache"
+	"github.com/comfforts/logger"
+)
+
+func TestLoadFromURL(t *testing.T) {
+	exp := time.Now().Add(5 * time.Minute).UnixNano()
+	body, err := json.Marshal(map[string]interface{}{
+		"version": 1,
+		"items": map[string]gocache.Item{
+			"test": {Object: TestStruct{Name: "John", Age: 34}, Expiration: exp},
+		},
+	})
+	require.NoError(t, err)
+	var gzipped bytes.Buffer
+	gz := gzip.NewWriter(&gzipped)
+	_, err = gz.Write(body)
+	require.NoError(t, err)
+	require.NoError(t, gz.Close())
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/cache.json", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write(body)
+	})
+	mux.HandleFunc("/cache.json.gz", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Encoding", "gzip")
+		_, _ = w.Write(gzipped.Bytes())
+	})
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	for _, path := range []string{"/cache.json", "/cache.json.gz"} {
+		dataDir := t.TempDir()
+		testLogger := logger.NewTestAppLogger(dataDir)
+		cacheCfg := cache.CacheConfig{
+			DataDir:   dataDir,
+			MarshalFn: UnmarshallTestStruct,
+		}
+		ca, err := cache.NewCacheService(cacheCfg, testLogger)
+		require.NoError(t, err)
+		closeOnCleanup(t, ca)
+
+		err = ca.LoadFromURL(context.Background(), srv.URL+path)
+		require.NoError(t, err)
+		cVal, _ := ca.Get("test")
+		require.Equal(t, TestStruct{Name: "John", Age: 34}, cVal)
+		require.Equal(t, cache.LOAD_SOURCE_URL, ca.Stats().LastLoadSource)
+
+		err = ca.LoadFromURL(context.Background(), srv.URL+"/missing.json")
+		require.Error(t, err)
+	}
+}
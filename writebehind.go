@@ -0,0 +1,201 @@
+package cache
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/comfforts/logger"
+)
+
+const (
+	DEFAULT_WRITE_BEHIND_QUEUE_SIZE = 1000
+	DEFAULT_WRITE_BEHIND_BATCH_SIZE = 100
+	DEFAULT_WRITE_BEHIND_INTERVAL   = time.Second
+	DEFAULT_WRITE_BEHIND_RETRIES    = 3
+	WRITE_BEHIND_RETRY_BACKOFF      = 50 * time.Millisecond
+)
+
+// Sink is a backing store receiving cache writes asynchronously in write-behind mode.
+type Sink interface {
+	Store(ctx context.Context, key string, value interface{}) error
+}
+
+// BatchSink is implemented by sinks that can store a batch of writes at once.
+type BatchSink interface {
+	StoreBatch(ctx context.Context, values map[string]interface{}) error
+}
+
+type writeOp struct {
+	key   string
+	value interface{}
+}
+
+type writeBehind struct {
+	sink      Sink
+	queue     chan writeOp
+	pending   atomic.Int64
+	batchSize int
+	interval  time.Duration
+	retries   int
+	rand      *lockedRand
+	stop      chan struct{}
+	done      chan struct{}
+	once      sync.Once
+	// closed is set under mu before stop closes, so no enqueue lands after run drained the queue
+	mu     sync.RWMutex
+	closed bool
+	logger.AppLogger
+}
+
+func newWriteBehind(sink Sink, cfg CacheConfig, rnd *lockedRand, l logger.AppLogger) *writeBehind {
+	queueSize := cfg.WriteBehindQueueSize
+	if queueSize <= 0 {
+		queueSize = DEFAULT_WRITE_BEHIND_QUEUE_SIZE
+	}
+	batchSize := cfg.WriteBehindBatchSize
+	if batchSize <= 0 {
+		batchSize = DEFAULT_WRITE_BEHIND_BATCH_SIZE
+	}
+	interval := cfg.WriteBehindInterval
+	if interval <= 0 {
+		interval = DEFAULT_WRITE_BEHIND_INTERVAL
+	}
+	retries := cfg.WriteBehindRetries
+	if retries <= 0 {
+		retries = DEFAULT_WRITE_BEHIND_RETRIES
+	}
+
+	return &writeBehind{
+		sink:      sink,
+		queue:     make(chan writeOp, queueSize),
+		batchSize: batchSize,
+		interval:  interval,
+		retries:   retries,
+		rand:      rnd,
+		stop:      make(chan struct{}),
+		done:      make(chan struct{}),
+		AppLogger: l,
+	}
+}
+
+// enqueue queues the write, once the queue is closed it's stored inline instead
+// as the sink was still set when the write was made.
+func (w *writeBehind) enqueue(key string, value interface{}) error {
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+
+	w.pending.Add(1)
+	if w.closed {
+		w.flush([]writeOp{{key: key, value: value}})
+		return nil
+	}
+	select {
+	case w.queue <- writeOp{key: key, value: value}:
+		return nil
+	default:
+		w.pending.Add(-1)
+		w.Error(ERROR_WRITE_BEHIND_QUEUE_FULL, zap.String("key", key))
+		return ErrWriteBehindQueueFull
+	}
+}
+
+func (w *writeBehind) run() {
+	defer close(w.done)
+
+	ticker := time.NewTicker(w.interval)
+	defer ticker.Stop()
+
+	batch := make([]writeOp, 0, w.batchSize)
+	for {
+		select {
+		case op := <-w.queue:
+			batch = append(batch, op)
+			if len(batch) >= w.batchSize {
+				w.flush(batch)
+				batch = batch[:0]
+			}
+		case <-ticker.C:
+			if len(batch) > 0 {
+				w.flush(batch)
+				batch = batch[:0]
+			}
+		case <-w.stop:
+			for {
+				select {
+				case op := <-w.queue:
+					batch = append(batch, op)
+					if len(batch) >= w.batchSize {
+						w.flush(batch)
+						batch = batch[:0]
+					}
+				default:
+					if len(batch) > 0 {
+						w.flush(batch)
+					}
+					return
+				}
+			}
+		}
+	}
+}
+
+func (w *writeBehind) flush(batch []writeOp) {
+	defer w.pending.Add(-int64(len(batch)))
+
+	values := map[string]interface{}{}
+	for _, op := range batch {
+		values[op.key] = op.value
+	}
+
+	if bs, ok := w.sink.(BatchSink); ok {
+		err := w.retry(func(ctx context.Context) error {
+			return bs.StoreBatch(ctx, values)
+		})
+		if err != nil {
+			w.Error("error storing write-behind batch", zap.Error(err), zap.Int("size", len(values)))
+		}
+		return
+	}
+
+	for k, v := range values {
+		key, value := k, v
+		err := w.retry(func(ctx context.Context) error {
+			return w.sink.Store(ctx, key, value)
+		})
+		if err != nil {
+			w.Error("error storing write-behind value", zap.Error(err), zap.String("key", key))
+		}
+	}
+}
+
+func (w *writeBehind) retry(fn func(ctx context.Context) error) error {
+	var err error
+	backoff := WRITE_BEHIND_RETRY_BACKOFF
+	for attempt := 0; attempt <= w.retries; attempt++ {
+		if attempt > 0 {
+			// up to half the backoff again keeps retrying writers from syncing up
+			time.Sleep(backoff + w.rand.duration(backoff/2))
+			backoff *= 2
+		}
+		err = fn(context.Background())
+		if err == nil {
+			return nil
+		}
+		w.Debug("write-behind attempt failed", zap.Error(err), zap.Int("attempt", attempt))
+	}
+	return err
+}
+
+func (w *writeBehind) close() {
+	w.once.Do(func() {
+		w.mu.Lock()
+		w.closed = true
+		w.mu.Unlock()
+		close(w.stop)
+	})
+	<-w.done
+}
@@ -0,0 +1,131 @@
+package cache_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/comfforts/cache"
+	"github.com/comfforts/logger"
+)
+
+type fakeSink struct {
+	mu       sync.Mutex
+	values   map[string]interface{}
+	failures int
+}
+
+func newFakeSink(failures int) *fakeSink {
+	return &fakeSink{
+		values:   map[string]interface{}{},
+		failures: failures,
+	}
+}
+
+func (s *fakeSink) Store(ctx context.Context, key string, value interface{}) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.failures > 0 {
+		s.failures--
+		return errors.New("sink unavailable")
+	}
+	s.values[key] = value
+	return nil
+}
+
+func (s *fakeSink) Len() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.values)
+}
+
+type fakeBatchSink struct {
+	*fakeSink
+	batches []int
+}
+
+func (s *fakeBatchSink) StoreBatch(ctx context.Context, values map[string]interface{}) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.batches = append(s.batches, len(values))
+	for k, v := range values {
+		s.values[k] = v
+	}
+	return nil
+}
+
+func (s *fakeBatchSink) Batches() []int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]int{}, s.batches...)
+}
+
+func TestWriteBehind(t *testing.T) {
+	dataDir := t.TempDir()
+	testLogger := logger.NewTestAppLogger(dataDir)
+
+	t.Run("sets reach sink with retries", func(t *testing.T) {
+		cacheCfg := cache.CacheConfig{
+			DataDir:             dataDir,
+			CacheFileName:       "write-behind",
+			MarshalFn:           UnmarshallTestStruct,
+			WriteBehindInterval: 10 * time.Millisecond,
+		}
+		ca, err := cache.NewCacheService(cacheCfg, testLogger)
+		require.NoError(t, err)
+		closeOnCleanup(t, ca)
+
+		sink := newFakeSink(2)
+		ca.SetSink(sink)
+
+		for i := 0; i < 5; i++ {
+			err = ca.Set(fmt.Sprintf("key-%d", i), TestStruct{Name: "John", Age: i}, 5*time.Minute)
+			require.NoError(t, err)
+		}
+
+		require.Eventually(t, func() bool {
+			return sink.Len() == 5 && ca.Pending() == 0
+		}, 2*time.Second, 10*time.Millisecond)
+
+		err = ca.Clear()
+		require.NoError(t, err)
+	})
+
+	t.Run("batches writes and drains on clear", func(t *testing.T) {
+		cacheCfg := cache.CacheConfig{
+			DataDir:              dataDir,
+			CacheFileName:        "write-behind-batch",
+			MarshalFn:            UnmarshallTestStruct,
+			WriteBehindBatchSize: 10,
+			WriteBehindInterval:  time.Minute,
+		}
+		ca, err := cache.NewCacheService(cacheCfg, testLogger)
+		require.NoError(t, err)
+		closeOnCleanup(t, ca)
+
+		sink := &fakeBatchSink{fakeSink: newFakeSink(0)}
+		ca.SetSink(sink)
+
+		for i := 0; i < 25; i++ {
+			err = ca.Set(fmt.Sprintf("key-%d", i), TestStruct{Name: "John", Age: i}, 5*time.Minute)
+			require.NoError(t, err)
+		}
+
+		require.Eventually(t, func() bool {
+			return sink.Len() == 20 && ca.Pending() == 5
+		}, time.Second, 10*time.Millisecond)
+		require.Equal(t, []int{10, 10}, sink.Batches())
+
+		err = ca.Clear()
+		require.NoError(t, err)
+
+		require.Equal(t, 25, sink.Len())
+		require.Equal(t, []int{10, 10, 5}, sink.Batches())
+		require.Equal(t, 0, ca.Pending())
+	})
+}